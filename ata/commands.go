@@ -18,6 +18,7 @@ package ata
 
 const (
 	// ATA commands
+	ATA_READ_LOG_EXT    = 0x2f
 	ATA_SMART           = 0xb0
 	ATA_IDENTIFY_DEVICE = 0xec
 
@@ -25,4 +26,7 @@ const (
 	SMART_READ_DATA     = 0xd0
 	SMART_READ_LOG      = 0xd5
 	SMART_RETURN_STATUS = 0xda
+
+	// GP log address of the extended comprehensive SMART error log
+	EXT_ERROR_LOG = 0x03
 )
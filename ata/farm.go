@@ -0,0 +1,274 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Seagate Field Accessible Reliability Metrics (FARM) log.
+
+package ata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// FARM GP log address
+	FARM_LOG = 0xa6
+
+	// Size of a FARM log page, and number of pages read by default
+	FARM_PAGE_SIZE = 16384
+	FARM_PAGES     = 6
+
+	// "FARM" in ASCII, as found in the first field of the header page
+	FARM_SIGNATURE = 0x00004641524d
+
+	// FARM page numbers
+	FARM_PAGE_HEADER      = 0
+	FARM_PAGE_DRIVE_INFO  = 1
+	FARM_PAGE_WORKLOAD    = 2
+	FARM_PAGE_ERRORS      = 3
+	FARM_PAGE_ENVIRONMENT = 4
+	FARM_PAGE_RELIABILITY = 5
+)
+
+// FarmValue is a single 64-bit FARM field. The two most significant bits indicate whether the field
+// is supported and valid, and the least significant 56 bits hold the value.
+type FarmValue uint64
+
+func (v FarmValue) Supported() bool {
+	return v&(1<<63) != 0
+}
+
+func (v FarmValue) Valid() bool {
+	return v&(1<<62) != 0
+}
+
+// Value returns the value of the field, sign extended from 56 bits.
+func (v FarmValue) Value() int64 {
+	return int64(v<<8) >> 8
+}
+
+// FarmPage is a FARM log page, split into its 64-bit fields.
+type FarmPage []FarmValue
+
+// Field returns the value of the field at the specified index, and whether it is supported and
+// valid.
+func (p FarmPage) Field(index int) (int64, bool) {
+	if index < 0 || index >= len(p) || !p[index].Supported() || !p[index].Valid() {
+		return 0, false
+	}
+
+	return p[index].Value(), true
+}
+
+// FarmLayout describes the location of fields within FARM pages, which differs between the ATA and
+// SCSI flavours of the log. Indices are zero-based field numbers within a page.
+type FarmLayout struct {
+	Heads           int // Number of heads (drive information page)
+	PowerOnHours    int
+	HeadFlightHours int
+	HeadLoadEvents  int
+	PowerCycles     int
+	TempDivisor     int64 // Divisor of temperatures to obtain °C
+}
+
+// ATAFarmLayout is the layout of the ATA FARM log (GP log A6h).
+var ATAFarmLayout = FarmLayout{
+	Heads:           11,
+	PowerOnHours:    19,
+	HeadFlightHours: 21,
+	HeadLoadEvents:  22,
+	PowerCycles:     23,
+	TempDivisor:     1,
+}
+
+// FarmLog is a decoded FARM log. Fields which are not supported by the drive are zero. Pages are
+// keyed by page number for the ATA log, and by parameter code for the SCSI log page, where
+// statistics by head are additional pages.
+type FarmLog struct {
+	MajorRev       int64
+	MinorRev       int64
+	PagesSupported int64
+	HeadsSupported int64
+	Heads          int64
+
+	PowerOnHours    int64
+	HeadFlightHours int64
+	HeadLoadEvents  int64
+	PowerCycles     int64
+
+	ReadCommands       int64
+	WriteCommands      int64
+	LogicalSecsRead    int64
+	LogicalSecsWritten int64
+
+	UnrecoverableReadErrors  int64
+	UnrecoverableWriteErrors int64
+	Reallocations            int64
+	ReallocationCandidates   int64
+	MechanicalFailures       int64
+
+	CurrentTemp int64 // In °C
+	HighestTemp int64
+	LowestTemp  int64
+
+	Pages map[uint16]FarmPage
+}
+
+// ByHead returns the per-head values of a statistic which starts at the specified field index of a
+// page. The location of per-head statistics varies between FARM revisions, so these are not
+// decoded into named fields.
+func (f FarmLog) ByHead(page uint16, index int) []int64 {
+	p := f.Pages[page]
+	heads := int(f.Heads)
+
+	if index < 0 || index+heads > len(p) {
+		return nil
+	}
+
+	values := make([]int64, heads)
+	for i := range values {
+		values[i], _ = p.Field(index + i)
+	}
+
+	return values
+}
+
+// SplitFarmPage splits a buffer into 64-bit FARM fields. Fields are little-endian in the ATA log,
+// and big-endian in the SCSI log page.
+func SplitFarmPage(buf []byte, order binary.ByteOrder) FarmPage {
+	page := make(FarmPage, len(buf)/8)
+	for i := range page {
+		page[i] = FarmValue(order.Uint64(buf[i*8:]))
+	}
+
+	return page
+}
+
+// DecodeFarmPages decodes the named FARM fields from pages of a FARM log, using the specified
+// layout. The header page must be present and contain a valid signature.
+func DecodeFarmPages(pages map[uint16]FarmPage, layout FarmLayout) (FarmLog, error) {
+	f := FarmLog{Pages: pages}
+
+	hdr := pages[FARM_PAGE_HEADER]
+	if sig, ok := hdr.Field(0); !ok || sig != FARM_SIGNATURE {
+		return f, fmt.Errorf("FARM log: invalid signature")
+	}
+
+	f.MajorRev, _ = hdr.Field(1)
+	f.MinorRev, _ = hdr.Field(2)
+	f.PagesSupported, _ = hdr.Field(3)
+	f.HeadsSupported, _ = hdr.Field(6)
+
+	info := pages[FARM_PAGE_DRIVE_INFO]
+	f.Heads, _ = info.Field(layout.Heads)
+	f.PowerOnHours, _ = info.Field(layout.PowerOnHours)
+	f.HeadFlightHours, _ = info.Field(layout.HeadFlightHours)
+	f.HeadLoadEvents, _ = info.Field(layout.HeadLoadEvents)
+	f.PowerCycles, _ = info.Field(layout.PowerCycles)
+
+	if f.Heads > f.HeadsSupported && f.HeadsSupported > 0 {
+		f.Heads = f.HeadsSupported
+	}
+
+	work := pages[FARM_PAGE_WORKLOAD]
+	f.ReadCommands, _ = work.Field(3)
+	f.WriteCommands, _ = work.Field(4)
+	f.LogicalSecsWritten, _ = work.Field(8)
+	f.LogicalSecsRead, _ = work.Field(9)
+
+	errs := pages[FARM_PAGE_ERRORS]
+	f.UnrecoverableReadErrors, _ = errs.Field(2)
+	f.UnrecoverableWriteErrors, _ = errs.Field(3)
+	f.Reallocations, _ = errs.Field(4)
+	f.MechanicalFailures, _ = errs.Field(6)
+	f.ReallocationCandidates, _ = errs.Field(7)
+
+	env := pages[FARM_PAGE_ENVIRONMENT]
+	f.CurrentTemp, _ = env.Field(2)
+	f.HighestTemp, _ = env.Field(3)
+	f.LowestTemp, _ = env.Field(4)
+
+	if layout.TempDivisor > 1 {
+		f.CurrentTemp /= layout.TempDivisor
+		f.HighestTemp /= layout.TempDivisor
+		f.LowestTemp /= layout.TempDivisor
+	}
+
+	return f, nil
+}
+
+// DecodeFarmLog decodes the ATA FARM log (GP log A6h), which consists of consecutive pages of
+// FARM_PAGE_SIZE bytes.
+func DecodeFarmLog(buf []byte) (FarmLog, error) {
+	pages := make(map[uint16]FarmPage)
+
+	for n := uint16(0); len(buf) > 0; n++ {
+		l := FARM_PAGE_SIZE
+		if len(buf) < l {
+			l = len(buf)
+		}
+
+		pages[n] = SplitFarmPage(buf[:l], binary.LittleEndian)
+		buf = buf[l:]
+	}
+
+	return DecodeFarmPages(pages, ATAFarmLayout)
+}
+
+func (f FarmLog) Print(w io.Writer) {
+	fmt.Fprintf(w, "FARM log version: %d.%d\n", f.MajorRev, f.MinorRev)
+	fmt.Fprintf(w, "Number of heads: %d\n", f.Heads)
+	fmt.Fprintf(w, "Power-on hours: %d\n", f.PowerOnHours)
+	fmt.Fprintf(w, "Head flight hours: %d\n", f.HeadFlightHours)
+	fmt.Fprintf(w, "Head load events: %d\n", f.HeadLoadEvents)
+	fmt.Fprintf(w, "Power cycles: %d\n", f.PowerCycles)
+	fmt.Fprintf(w, "Read commands: %d\n", f.ReadCommands)
+	fmt.Fprintf(w, "Write commands: %d\n", f.WriteCommands)
+	fmt.Fprintf(w, "Logical sectors read: %d\n", f.LogicalSecsRead)
+	fmt.Fprintf(w, "Logical sectors written: %d\n", f.LogicalSecsWritten)
+	fmt.Fprintf(w, "Unrecoverable read errors: %d\n", f.UnrecoverableReadErrors)
+	fmt.Fprintf(w, "Unrecoverable write errors: %d\n", f.UnrecoverableWriteErrors)
+	fmt.Fprintf(w, "Reallocated sectors: %d\n", f.Reallocations)
+	fmt.Fprintf(w, "Reallocation candidates: %d\n", f.ReallocationCandidates)
+	fmt.Fprintf(w, "Mechanical start failures: %d\n", f.MechanicalFailures)
+	fmt.Fprintf(w, "Temperature: %d C (lowest %d C, highest %d C)\n", f.CurrentTemp, f.LowestTemp,
+		f.HighestTemp)
+
+	// Statistics by head are only separate pages in the SCSI flavour of the log
+	codes := make([]int, 0, len(f.Pages))
+	for code := range f.Pages {
+		if code > FARM_PAGE_RELIABILITY {
+			codes = append(codes, int(code))
+		}
+	}
+
+	sort.Ints(codes)
+
+	for _, code := range codes {
+		values := f.ByHead(uint16(code), 0)
+		if values == nil {
+			continue
+		}
+
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = fmt.Sprint(v)
+		}
+
+		fmt.Fprintf(w, "By head statistic %04xh: %s\n", code, strings.Join(s, " "))
+	}
+}
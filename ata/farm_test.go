@@ -0,0 +1,67 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ata
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// putFarmField stores a supported and valid FARM field in an ATA FARM log buffer.
+func putFarmField(buf []byte, page, index int, v uint64) {
+	binary.LittleEndian.PutUint64(buf[page*FARM_PAGE_SIZE+index*8:], v|0xc0<<56)
+}
+
+func TestDecodeFarmLog(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := make([]byte, FARM_PAGE_SIZE*FARM_PAGES)
+
+	_, err := DecodeFarmLog(buf)
+	assert.Error(err)
+
+	putFarmField(buf, FARM_PAGE_HEADER, 0, FARM_SIGNATURE)
+	putFarmField(buf, FARM_PAGE_HEADER, 1, 4)
+	putFarmField(buf, FARM_PAGE_HEADER, 2, 21)
+	putFarmField(buf, FARM_PAGE_HEADER, 3, FARM_PAGES)
+	putFarmField(buf, FARM_PAGE_HEADER, 6, 24)
+	putFarmField(buf, FARM_PAGE_DRIVE_INFO, ATAFarmLayout.Heads, 2)
+	putFarmField(buf, FARM_PAGE_DRIVE_INFO, ATAFarmLayout.PowerOnHours, 12345)
+	putFarmField(buf, FARM_PAGE_WORKLOAD, 9, 1000)
+	putFarmField(buf, FARM_PAGE_ERRORS, 4, 8)
+	putFarmField(buf, FARM_PAGE_ENVIRONMENT, 2, 38)
+
+	// Per-head statistic, second head is not valid
+	putFarmField(buf, FARM_PAGE_RELIABILITY, 10, 7)
+	binary.LittleEndian.PutUint64(buf[FARM_PAGE_RELIABILITY*FARM_PAGE_SIZE+11*8:], 9|1<<63)
+
+	// Unsupported field
+	binary.LittleEndian.PutUint64(buf[FARM_PAGE_DRIVE_INFO*FARM_PAGE_SIZE+ATAFarmLayout.PowerCycles*8:], 99)
+
+	farm, err := DecodeFarmLog(buf)
+	assert.NoError(err)
+	assert.Equal(int64(4), farm.MajorRev)
+	assert.Equal(int64(21), farm.MinorRev)
+	assert.Equal(int64(2), farm.Heads)
+	assert.Equal(int64(12345), farm.PowerOnHours)
+	assert.Equal(int64(0), farm.PowerCycles)
+	assert.Equal(int64(1000), farm.LogicalSecsRead)
+	assert.Equal(int64(8), farm.Reallocations)
+	assert.Equal(int64(38), farm.CurrentTemp)
+	assert.Equal([]int64{7, 0}, farm.ByHead(FARM_PAGE_RELIABILITY, 10))
+	assert.Len(farm.Pages, FARM_PAGES)
+}
@@ -19,6 +19,7 @@ package ata
 import (
 	"fmt"
 
+	"github.com/dswarbrick/smart/drivedb"
 	"github.com/dswarbrick/smart/utils"
 )
 
@@ -154,6 +155,19 @@ func (d *IdentifyDeviceData) ATAMinorVersion() string {
 	return "unknown"
 }
 
+// DriveType returns the drivedb drive type (HDD or SSD) based on the nominal media rotation rate
+// from an ATA IDENTIFY command.
+func (d *IdentifyDeviceData) DriveType() string {
+	switch {
+	case d.RotationRate == 0x0001:
+		return drivedb.DriveTypeSSD
+	case d.RotationRate >= 0x0401 && d.RotationRate <= 0xfffe:
+		return drivedb.DriveTypeHDD
+	default:
+		return drivedb.DriveTypeUnknown
+	}
+}
+
 // FirmwareVersion returns the firmware version of a device from an ATA IDENTIFY command.
 func (d *IdentifyDeviceData) FirmwareRevision() []byte {
 	return d.swapBytes(d.FirmwareRevisionRaw[:])
@@ -169,6 +183,18 @@ func (d *IdentifyDeviceData) SerialNumber() []byte {
 	return d.swapBytes(d.SerialNumberRaw[:])
 }
 
+// FixFirmwareBugs applies firmware bug workarounds for the drive model to the IDENTIFY data. Drives
+// must be looked up in the drivedb with the unmodified strings.
+func (d *IdentifyDeviceData) FixFirmwareBugs(drive drivedb.DriveModel) {
+	// Strings are stored in the wrong byte order, so pre-swap them to undo the byte swap performed
+	// by ModelNumber etc.
+	if drive.HasFirmwareBug(drivedb.FirmwareBugSwapID) {
+		copy(d.SerialNumberRaw[:], d.swapBytes(d.SerialNumberRaw[:]))
+		copy(d.FirmwareRevisionRaw[:], d.swapBytes(d.FirmwareRevisionRaw[:]))
+		copy(d.ModelNumberRaw[:], d.swapBytes(d.ModelNumberRaw[:]))
+	}
+}
+
 func (d *IdentifyDeviceData) Transport() (s string) {
 	if (d.TransportMajor == 0) || (d.TransportMajor == 0xffff) {
 		s = "device does not report transport"
@@ -22,6 +22,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/dswarbrick/smart/drivedb"
 	"github.com/dswarbrick/smart/utils"
 )
 
@@ -77,6 +78,28 @@ func TestATAIdentify(t *testing.T) {
 	assert.Equal(uint16(1), d.RotationRate)
 }
 
+func TestFixFirmwareBugsSwapID(t *testing.T) {
+	var d IdentifyDeviceData
+
+	assert := assert.New(t)
+
+	// Drive which stores IDENTIFY strings in the wrong byte order
+	buf := ataIdentifyData
+	swapBytes(buf[20:40])
+	swapBytes(buf[46:94])
+
+	binary.Read(bytes.NewBuffer(buf[:]), utils.NativeEndian, &d)
+	assert.Equal("XE0TBDQ6", string(d.FirmwareRevision()))
+
+	d.FixFirmwareBugs(drivedb.DriveModel{})
+	assert.Equal("XE0TBDQ6", string(d.FirmwareRevision()))
+
+	d.FixFirmwareBugs(drivedb.DriveModel{FirmwareBugs: []string{drivedb.FirmwareBugSwapID}})
+	assert.Equal("S1DMNEAD123456B     ", string(d.SerialNumber()))
+	assert.Equal("EXT0DB6Q", string(d.FirmwareRevision()))
+	assert.Equal("Samsung SSD 840 EVO 750GB               ", string(d.ModelNumber()))
+}
+
 // swapBytes swaps the order of every second byte in a byte slice (modifies slice in-place).
 func swapBytes(s []byte) []byte {
 	for i := 0; i < len(s); i += 2 {
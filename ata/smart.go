@@ -15,11 +15,15 @@
 package ata
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math/bits"
 	"strconv"
 
 	"github.com/dswarbrick/smart/drivedb"
+	"github.com/dswarbrick/smart/utils"
 )
 
 // Individual SMART attribute (12 bytes)
@@ -47,14 +51,122 @@ type SmartLogDirectory struct {
 	}
 }
 
+// Command data structure of a SMART error log entry (12 bytes)
+type smartErrorCommand struct {
+	DeviceControl byte
+	Features      byte
+	Count         byte
+	LBALow        byte
+	LBAMid        byte
+	LBAHigh       byte
+	Device        byte
+	Command       byte
+	Timestamp     uint32 // Milliseconds since power-on when command was issued
+}
+
+// Error data structure of a SMART error log entry (30 bytes)
+type smartErrorData struct {
+	_             byte // Reserved
+	Error         byte
+	Count         byte
+	LBALow        byte
+	LBAMid        byte
+	LBAHigh       byte
+	Device        byte
+	Status        byte
+	ExtendedError [19]byte // Vendor-specific extended error information
+	State         byte
+	LifeTimestamp uint16 // Power-on lifetime of the device in hours when error occurred
+}
+
+// SMART error log data structure (90 bytes)
+type SmartErrorLogEntry struct {
+	Commands [5]smartErrorCommand // Commands preceding the error, oldest first
+	Error    smartErrorData
+}
+
 // SMART log address 01h
 type SmartSummaryErrorLog struct {
 	Version    byte
 	LogIndex   byte
-	LogData    [5][90]byte // TODO: Expand out to error log structure
-	ErrorCount uint16      // Device error count
-	_          [57]byte    // Reserved
-	Checksum   byte        // Two's complement checksum of first 511 bytes
+	LogData    [5]SmartErrorLogEntry
+	ErrorCount uint16   // Device error count
+	_          [57]byte // Reserved
+	Checksum   byte     // Two's complement checksum of first 511 bytes
+}
+
+// Command data structure of an extended comprehensive SMART error log entry (18 bytes)
+type smartExtErrorCommand struct {
+	DeviceControl byte
+	Features      uint16
+	Count         uint16
+	LBALow        byte
+	LBALowHi      byte
+	LBAMid        byte
+	LBAMidHi      byte
+	LBAHigh       byte
+	LBAHighHi     byte
+	Device        byte
+	Command       byte
+	_             byte   // Reserved
+	Timestamp     uint32 // Milliseconds since power-on when command was issued
+}
+
+// LBA returns the 48-bit LBA of the command.
+func (c smartExtErrorCommand) LBA() uint64 {
+	return extErrorLBA(c.LBALow, c.LBAMid, c.LBAHigh, c.LBALowHi, c.LBAMidHi, c.LBAHighHi)
+}
+
+// Error data structure of an extended comprehensive SMART error log entry (34 bytes)
+type smartExtErrorData struct {
+	_             byte // Transport specific
+	Error         byte
+	Count         uint16
+	LBALow        byte
+	LBALowHi      byte
+	LBAMid        byte
+	LBAMidHi      byte
+	LBAHigh       byte
+	LBAHighHi     byte
+	Device        byte
+	Status        byte
+	ExtendedError [19]byte // Vendor-specific extended error information
+	State         byte
+	LifeTimestamp uint16 // Power-on lifetime of the device in hours when error occurred
+}
+
+// LBA returns the 48-bit LBA at which the error occurred.
+func (e smartExtErrorData) LBA() uint64 {
+	return extErrorLBA(e.LBALow, e.LBAMid, e.LBAHigh, e.LBALowHi, e.LBAMidHi, e.LBAHighHi)
+}
+
+// Extended comprehensive SMART error log data structure (124 bytes)
+type SmartExtErrorLogEntry struct {
+	Commands [5]smartExtErrorCommand // Commands preceding the error, oldest first
+	Error    smartExtErrorData
+}
+
+// GP log address 03h (first page only)
+type SmartExtErrorLog struct {
+	Version    byte
+	_          byte // Reserved
+	LogIndex   uint16
+	LogData    [4]SmartExtErrorLogEntry
+	ErrorCount uint16  // Device error count
+	_          [9]byte // Reserved
+	Checksum   byte    // Two's complement checksum of first 511 bytes
+}
+
+// extErrorLBA assembles a 48-bit LBA from the LBA fields of an extended error log structure.
+func extErrorLBA(low, mid, high, lowHi, midHi, highHi byte) uint64 {
+	return uint64(highHi)<<40 | uint64(midHi)<<32 | uint64(lowHi)<<24 | uint64(high)<<16 |
+		uint64(mid)<<8 | uint64(low)
+}
+
+// fixExtErrorLBA reorders LBA fields which a drive stored as a little-endian integer, i.e. in
+// register order rather than LBA (7:0), LBA (15:8), etc.
+func fixExtErrorLBA(lowHi, mid, midHi, high *byte) {
+	*lowHi, *mid, *midHi, *high = *midHi, *lowHi, *high, *mid
 }
 
 // SMART log address 06h
@@ -74,22 +186,118 @@ type SmartSelfTestLog struct {
 	Checksum       byte   // Two's complement checksum of first 511 bytes
 }
 
-// decodeVendorBytes decodes the six-byte vendor byte array based on the conversion rule passed as
-// conv. The conversion may also include the reserved byte, normalised value or worst value byte.
-func (sa *smartAttr) decodeVendorBytes(conv string) uint64 {
-	var (
-		byteOrder string
-		r         uint64
-	)
+// Self-test execution status values (upper nibble of SMART READ DATA byte 363)
+const (
+	SelfTestStatusCompleted  = 0x0
+	SelfTestStatusInProgress = 0xf
+)
+
+// DecodeSelfTestStatus returns the self-test execution status byte from a SMART READ DATA
+// response, applying any firmware bug workarounds for the drive model.
+func DecodeSelfTestStatus(buf []byte, drive drivedb.DriveModel) byte {
+	status := buf[363]
+
+	// Some Samsung drives report a self-test still in progress with 0% remaining after it has
+	// already completed.
+	if drive.HasFirmwareBug(drivedb.FirmwareBugSamsung3) && status == SelfTestStatusInProgress<<4 {
+		status = SelfTestStatusCompleted << 4
+	}
+
+	return status
+}
+
+// DecodeSummaryErrorLog decodes a SMART summary error log (log address 01h), applying any firmware
+// bug workarounds for the drive model.
+func DecodeSummaryErrorLog(buf []byte, drive drivedb.DriveModel) SmartSummaryErrorLog {
+	var errLog SmartSummaryErrorLog
 
-	// Default byte orders if not otherwise specified in drivedb
+	binary.Read(bytes.NewBuffer(buf), utils.NativeEndian, &errLog)
+
+	if drive.HasFirmwareBug(drivedb.FirmwareBugSamsung) {
+		for i := range errLog.LogData {
+			entry := &errLog.LogData[i]
+
+			for j := range entry.Commands {
+				entry.Commands[j].Timestamp = bits.ReverseBytes32(entry.Commands[j].Timestamp)
+			}
+
+			entry.Error.LifeTimestamp = bits.ReverseBytes16(entry.Error.LifeTimestamp)
+		}
+	}
+
+	if drive.HasFirmwareBug(drivedb.FirmwareBugSamsung) || drive.HasFirmwareBug(drivedb.FirmwareBugSamsung2) {
+		errLog.ErrorCount = bits.ReverseBytes16(errLog.ErrorCount)
+	}
+
+	return errLog
+}
+
+// DecodeExtErrorLog decodes the first page of an extended comprehensive SMART error log (GP log
+// address 03h), applying any firmware bug workarounds for the drive model.
+func DecodeExtErrorLog(buf []byte, drive drivedb.DriveModel) SmartExtErrorLog {
+	var errLog SmartExtErrorLog
+
+	binary.Read(bytes.NewBuffer(buf), utils.NativeEndian, &errLog)
+
+	if drive.HasFirmwareBug(drivedb.FirmwareBugXErrorLBA) {
+		for i := range errLog.LogData {
+			entry := &errLog.LogData[i]
+
+			for j := range entry.Commands {
+				c := &entry.Commands[j]
+				fixExtErrorLBA(&c.LBALowHi, &c.LBAMid, &c.LBAMidHi, &c.LBAHigh)
+			}
+
+			e := &entry.Error
+			fixExtErrorLBA(&e.LBALowHi, &e.LBAMid, &e.LBAMidHi, &e.LBAHigh)
+		}
+	}
+
+	return errLog
+}
+
+// DecodeSelfTestLog decodes a SMART self-test log (log address 06h), applying any firmware bug
+// workarounds for the drive model.
+func DecodeSelfTestLog(buf []byte, drive drivedb.DriveModel) SmartSelfTestLog {
+	var selfTestLog SmartSelfTestLog
+
+	binary.Read(bytes.NewBuffer(buf), utils.NativeEndian, &selfTestLog)
+
+	if drive.HasFirmwareBug(drivedb.FirmwareBugSamsung) {
+		selfTestLog.Version = bits.ReverseBytes16(selfTestLog.Version)
+
+		for i := range selfTestLog.Entry {
+			entry := &selfTestLog.Entry[i]
+			entry.LifeTimestamp = bits.ReverseBytes16(entry.LifeTimestamp)
+			entry.LBA = bits.ReverseBytes32(entry.LBA)
+		}
+	}
+
+	return selfTestLog
+}
+
+// defaultByteOrder returns the default byte order for a conversion, for use when the drivedb does
+// not specify one.
+func defaultByteOrder(conv string) string {
 	switch conv {
 	case "raw64", "hex64":
-		byteOrder = "543210wv"
+		return "543210wv"
 	case "raw56", "hex56", "raw24/raw32", "msec24hour32":
-		byteOrder = "r543210"
+		return "r543210"
 	default:
-		byteOrder = "543210"
+		return "543210"
+	}
+}
+
+// decodeVendorBytes decodes the six-byte vendor byte array based on the conversion rule passed as
+// conv. The conversion may also include the reserved byte, normalised value or worst value byte,
+// in the order specified by byteOrder (most significant byte first). If byteOrder is empty, the
+// default byte order for the conversion is used.
+func (sa *smartAttr) decodeVendorBytes(conv, byteOrder string) uint64 {
+	var r uint64
+
+	if byteOrder == "" {
+		byteOrder = defaultByteOrder(conv)
 	}
 
 	// Pick bytes from smartAttr in order specified by byteOrder
@@ -272,7 +480,9 @@ func formatRawValue(v uint64, conv string) (s string) {
 	return s
 }
 
-func PrintSMARTPage(smart SmartPage, drive drivedb.DriveModel, w io.Writer) {
+// PrintSMARTPage prints the SMART attributes of a drive, decoded according to the drivedb presets
+// for the drive model. The drive type (HDD / SSD) selects between qualified attribute presets.
+func PrintSMARTPage(smart SmartPage, drive drivedb.DriveModel, driveType string, w io.Writer) {
 	fmt.Fprintf(w, "\nSMART structure version: %d\n", smart.Version)
 	fmt.Fprintf(w, "ID# ATTRIBUTE_NAME           FLAG     VALUE WORST RESERVED TYPE     UPDATED RAW_VALUE\n")
 
@@ -287,9 +497,9 @@ func PrintSMARTPage(smart SmartPage, drive drivedb.DriveModel, w io.Writer) {
 			break
 		}
 
-		conv, ok := drive.Presets[strconv.Itoa(int(attr.Id))]
+		conv, ok := drive.Presets[strconv.Itoa(int(attr.Id))].Select(driveType)
 		if ok {
-			rawValue = attr.decodeVendorBytes(conv.Conv)
+			rawValue = attr.decodeVendorBytes(conv.Conv, conv.ByteOrder)
 		}
 
 		// Pre-fail / advisory bit
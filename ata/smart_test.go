@@ -0,0 +1,99 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ata
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/drivedb"
+)
+
+func TestDecodeVendorBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := smartAttr{
+		Value:       0x64,
+		Worst:       0x63,
+		VendorBytes: [6]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+		Reserved:    0x06,
+	}
+
+	// Default byte orders
+	assert.Equal(uint64(0x050403020100), sa.decodeVendorBytes("raw48", ""))
+	assert.Equal(uint64(0x06050403020100), sa.decodeVendorBytes("raw56", ""))
+	assert.Equal(uint64(0x0504030201006364), sa.decodeVendorBytes("raw64", ""))
+
+	// Byte orders from drivedb
+	assert.Equal(uint64(0x0201000403), sa.decodeVendorBytes("raw24/raw32", "21043"))
+	assert.Equal(uint64(0x06050403020100), sa.decodeVendorBytes("raw56", "r543210"))
+	assert.Equal("2/16778243", formatRawValue(sa.decodeVendorBytes("raw24/raw32", "21043"), "raw24/raw32"))
+}
+
+func TestFirmwareBugWorkarounds(t *testing.T) {
+	assert := assert.New(t)
+
+	samsung := drivedb.DriveModel{FirmwareBugs: []string{drivedb.FirmwareBugSamsung}}
+	samsung2 := drivedb.DriveModel{FirmwareBugs: []string{drivedb.FirmwareBugSamsung2}}
+	samsung3 := drivedb.DriveModel{FirmwareBugs: []string{drivedb.FirmwareBugSamsung3}}
+
+	// Self-test log with one entry: timestamp 0x1234 hours, LBA 0x01020304, both byte-swapped.
+	buf := make([]byte, 512)
+	buf[0] = 0x01
+	buf[4], buf[5] = 0x12, 0x34
+	buf[7], buf[8], buf[9], buf[10] = 0x01, 0x02, 0x03, 0x04
+
+	stLog := DecodeSelfTestLog(buf, samsung)
+	assert.Equal(uint16(0x1234), stLog.Entry[0].LifeTimestamp)
+	assert.Equal(uint32(0x01020304), stLog.Entry[0].LBA)
+
+	stLog = DecodeSelfTestLog(buf, drivedb.DriveModel{})
+	assert.Equal(uint16(0x3412), stLog.Entry[0].LifeTimestamp)
+
+	// Summary error log with byte-swapped error count of 5.
+	buf = make([]byte, 512)
+	buf[452], buf[453] = 0x00, 0x05
+
+	assert.Equal(uint16(0x0500), DecodeSummaryErrorLog(buf, drivedb.DriveModel{}).ErrorCount)
+	assert.Equal(uint16(5), DecodeSummaryErrorLog(buf, samsung2).ErrorCount)
+
+	// Self-test reported in progress with 0% remaining.
+	buf[363] = 0xf0
+	assert.Equal(byte(0x00), DecodeSelfTestStatus(buf, samsung3))
+	assert.Equal(byte(0xf0), DecodeSelfTestStatus(buf, samsung))
+}
+
+func TestDecodeExtErrorLog(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(512, binary.Size(SmartExtErrorLog{}))
+
+	// First entry, with error LBA 0A0B0C0D0E0Fh stored as a little-endian integer
+	buf := make([]byte, 512)
+	buf[0], buf[2] = 0x01, 0x01
+	copy(buf[98:], []byte{0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a})
+	buf[500] = 0x07
+
+	errLog := DecodeExtErrorLog(buf, drivedb.DriveModel{})
+	assert.Equal(uint16(1), errLog.LogIndex)
+	assert.Equal(uint16(7), errLog.ErrorCount)
+	assert.Equal(uint64(0x0a0c0e0b0d0f), errLog.LogData[0].Error.LBA())
+
+	xerrorlba := drivedb.DriveModel{FirmwareBugs: []string{drivedb.FirmwareBugXErrorLBA}}
+	errLog = DecodeExtErrorLog(buf, xerrorlba)
+	assert.Equal(uint64(0x0a0b0c0d0e0f), errLog.LogData[0].Error.LBA())
+}
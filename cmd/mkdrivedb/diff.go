@@ -0,0 +1,202 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Drive database YAML diff mode.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dswarbrick/smart/drivedb"
+)
+
+// readDrives reads a list of drives, one per line, in the form MODEL[<TAB>FIRMWARE]. Blank lines and
+// lines beginning with '#' are ignored. A list without any drives is an error, since it would
+// exclude every entry from the report.
+func readDrives(r io.Reader) ([]drivedb.DriveIdent, error) {
+	var drives []drivedb.DriveIdent
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var drive drivedb.DriveIdent
+
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			drive.Model, drive.Firmware = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		} else {
+			drive.Model = line
+		}
+
+		drives = append(drives, drive)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(drives) == 0 {
+		return nil, fmt.Errorf("no drives listed")
+	}
+
+	return drives, nil
+}
+
+// formatPresets formats the conversion rules of an attribute in drivedb.h "-v" style.
+func formatPresets(presets drivedb.AttrPresets) string {
+	if len(presets) == 0 {
+		return "(none)"
+	}
+
+	rules := make([]string, len(presets))
+
+	for i, p := range presets {
+		rule := p.Conv
+		if p.ByteOrder != "" {
+			rule += ":" + p.ByteOrder
+		}
+
+		rule += "," + p.Name
+
+		if p.DriveType != "" {
+			rule += "," + p.DriveType
+		}
+
+		rules[i] = rule
+	}
+
+	return strings.Join(rules, "; ")
+}
+
+// printDiff writes a human readable report of drive database differences to w.
+func printDiff(w io.Writer, diff drivedb.DriveDbDiff) {
+	fmt.Fprintf(w, "Comparing drivedb %q -> %q\n", diff.OldVersion, diff.NewVersion)
+
+	var added, removed, changed, warnings int
+
+	for _, e := range diff.Entries {
+		switch {
+		case e.Added():
+			added++
+			fmt.Fprintf(w, "\n+ %s\n", e.Family)
+			fmt.Fprintf(w, "    model regex: %s\n", e.New.ModelRegex)
+			if e.New.FirmwareRegex != "" {
+				fmt.Fprintf(w, "    firmware regex: %s\n", e.New.FirmwareRegex)
+			}
+		case e.Removed():
+			removed++
+			fmt.Fprintf(w, "\n- %s\n", e.Family)
+			fmt.Fprintf(w, "    model regex: %s\n", e.Old.ModelRegex)
+			if e.Old.FirmwareRegex != "" {
+				fmt.Fprintf(w, "    firmware regex: %s\n", e.Old.FirmwareRegex)
+			}
+			continue
+		default:
+			changed++
+			fmt.Fprintf(w, "\n~ %s\n", e.Family)
+			if e.New.FirmwareRegex != "" {
+				fmt.Fprintf(w, "    firmware regex: %s\n", e.New.FirmwareRegex)
+			}
+			if e.Old.ModelRegex != e.New.ModelRegex {
+				fmt.Fprintf(w, "    model regex: %s\n", e.Old.ModelRegex)
+				fmt.Fprintf(w, "              -> %s\n", e.New.ModelRegex)
+			}
+			if strings.Join(e.Old.FirmwareBugs, ",") != strings.Join(e.New.FirmwareBugs, ",") {
+				fmt.Fprintf(w, "    firmware bugs: %v -> %v\n", e.Old.FirmwareBugs, e.New.FirmwareBugs)
+			}
+			for _, p := range e.Presets {
+				fmt.Fprintf(w, "    attribute %s: %s -> %s\n", p.ID, formatPresets(p.Old), formatPresets(p.New))
+			}
+		}
+
+		if e.NewWarning() {
+			warnings++
+			fmt.Fprintf(w, "    NEW WARNING: %s\n", e.New.WarningMsg)
+		} else if !e.Added() && e.Old.WarningMsg != "" && e.New.WarningMsg == "" {
+			fmt.Fprintf(w, "    warning removed\n")
+		}
+	}
+
+	if len(diff.Drives) > 0 {
+		fmt.Fprintln(w, "\nDrives matching a different entry:")
+
+		for _, d := range diff.Drives {
+			fmt.Fprintf(w, "    %s %s: %q -> %q\n", d.Model, d.Firmware, d.OldFamily, d.NewFamily)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d added, %d removed, %d changed, %d new warnings\n", added, removed, changed, warnings)
+}
+
+// diffMain implements "mkdrivedb diff [-drives FILE] OLD.yaml NEW.yaml", and returns the exit code.
+func diffMain(args []string) int {
+	var drivesFilename string
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&drivesFilename, "drives", "",
+		"Optional file listing drives (MODEL[<TAB>FIRMWARE] per line) to narrow the report to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [-drives FILE] OLD.yaml NEW.yaml\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	oldDb, err := drivedb.OpenDriveDb(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read drivedb: %v\n", err)
+		return 1
+	}
+
+	newDb, err := drivedb.OpenDriveDb(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read drivedb: %v\n", err)
+		return 1
+	}
+
+	var drives []drivedb.DriveIdent
+
+	if drivesFilename != "" {
+		f, err := os.Open(drivesFilename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read drive list: %v\n", err)
+			return 1
+		}
+
+		defer f.Close()
+
+		if drives, err = readDrives(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read drive list: %v\n", err)
+			return 1
+		}
+	}
+
+	printDiff(os.Stdout, drivedb.Diff(&oldDb, &newDb, drives))
+
+	return 0
+}
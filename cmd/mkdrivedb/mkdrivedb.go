@@ -21,11 +21,11 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
-	"text/scanner"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/dswarbrick/smart/drivedb"
 )
 
 const (
@@ -33,105 +33,177 @@ const (
 )
 
 type AttrConv struct {
-	Conv string `yaml:"conv,omitempty"`
-	Name string `yaml:"name,omitempty"`
+	Conv      string `yaml:"conv,omitempty"`
+	ByteOrder string `yaml:"byte_order,omitempty"`
+	Name      string `yaml:"name,omitempty"`
+	DriveType string `yaml:"drive_type,omitempty"`
+}
+
+// AttrPresets is a list of conversion rules for a single attribute ID. A single rule is encoded as
+// a YAML mapping, multiple (HDD / SSD qualified) rules as a sequence.
+type AttrPresets []AttrConv
+
+func (p AttrPresets) MarshalYAML() (interface{}, error) {
+	if len(p) == 1 {
+		return p[0], nil
+	}
+
+	return []AttrConv(p), nil
 }
 
 type DriveModel struct {
-	Family        string              `yaml:"family,omitempty"`
-	ModelRegex    string              `yaml:"model_regex,omitempty"`
-	FirmwareRegex string              `yaml:"firmware_regex,omitempty"`
-	WarningMsg    string              `yaml:"warning,omitempty"`
-	Presets       map[string]AttrConv `yaml:"presets,omitempty"`
+	Family        string                 `yaml:"family,omitempty"`
+	ModelRegex    string                 `yaml:"model_regex,omitempty"`
+	FirmwareRegex string                 `yaml:"firmware_regex,omitempty"`
+	WarningMsg    string                 `yaml:"warning,omitempty"`
+	Presets       map[string]AttrPresets `yaml:"presets,omitempty"`
+	FirmwareBugs  []string               `yaml:"firmware_bugs,omitempty"`
+	Line          int                    `yaml:"-"` // Line number of entry in drivedb.h
 }
 
-type DriveDb struct {
-	Drives []DriveModel `yaml:"drives"`
+// Legacy "-v" attribute definitions still used by drivedb.h, and their modern equivalents.
+var legacyAttrDefs = map[string]string{
+	"9,minutes":                   "9,min2hour,Power_On_Minutes",
+	"9,seconds":                   "9,sec2hour,Power_On_Seconds",
+	"9,halfminutes":               "9,halfmin2hour,Power_On_Half_Minutes",
+	"9,temp":                      "9,tempminmax,Temperature_Celsius",
+	"192,emergencyretractcyclect": "192,raw48,Emerg_Retract_Cycle_Ct",
+	"193,loadunload":              "193,raw24/raw24",
+	"194,10xCelsius":              "194,temp10x,Temperature_Celsius_x10",
+	"194,unknown":                 "194,raw48,Unknown_Attribute",
+	"197,increasing":              "197,raw48+,Total_Pending_Sectors",
+	"198,offlinescanuncsectorct":  "198,raw48,Offline_Scan_UNC_SectCt",
+	"198,increasing":              "198,raw48+,Total_Offl_Uncorrectabl",
+	"200,writeerrorcount":         "200,raw48,Write_Error_Count",
+	"201,detectedtacount":         "201,raw48,Detected_TA_Count",
+	"220,temp":                    "220,tempminmax,Temperature_Celsius",
 }
 
-func parseDrivedb(src io.Reader) (string, []DriveModel) {
-	var (
-		s    scanner.Scanner
-		prev rune
-		idx  int
-	)
+// parseAttrDef parses a drivedb.h "-v" attribute definition argument, which has the form
+// ID,FORMAT[:BYTEORDER][,NAME[,HDD|SSD]].
+func parseAttrDef(arg string) (string, AttrConv) {
+	var conv AttrConv
 
-	header := "# This file was generated from:\n"
-	drives := make([]DriveModel, 0)
-	items := make([]string, 5)
+	if def, ok := legacyAttrDefs[arg]; ok {
+		arg = def
+	}
 
-	s.Init(src)
-	s.Mode ^= scanner.SkipComments
+	attrs := strings.Split(arg, ",")
 
-	// Extremely simple state machine like processing of tokens.
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		if prev == 0 && tok == scanner.Comment {
-			// First comment from drivedb.h should be copyright / license header. Convert C-style
-			// comment to a YAML comment.
-			for _, line := range strings.Split(s.TokenText(), "\n") {
-				header += "# " + strings.TrimLeft(line, "/* ") + "\n"
-			}
-		} else if (prev == '{' || prev == ',') && tok == scanner.String {
-			items[idx] = strings.Trim(s.TokenText(), `"`)
-		} else if prev == scanner.String && tok == ',' {
-			idx++
-		} else if (prev == scanner.String || prev == scanner.Comment) && tok == scanner.String {
-			items[idx] += strings.Trim(s.TokenText(), `"`)
-		} else if tok == '}' {
-			dm := DriveModel{Presets: make(map[string]AttrConv)}
-
-			if tmp, err := strconv.Unquote(`"` + items[0] + `"`); err == nil {
-				dm.Family = tmp
-			}
+	if len(attrs) >= 2 {
+		conv.Conv = attrs[1]
 
-			if tmp, err := strconv.Unquote(`"` + items[1] + `"`); err == nil {
-				dm.ModelRegex = tmp
-			}
+		if i := strings.IndexByte(conv.Conv, ':'); i >= 0 {
+			conv.Conv, conv.ByteOrder = conv.Conv[:i], conv.Conv[i+1:]
+		}
 
-			if tmp, err := strconv.Unquote(`"` + items[2] + `"`); err == nil {
-				dm.FirmwareRegex = tmp
-			}
+		// A trailing '+' marks the raw value as monotonically increasing, which does not affect
+		// its conversion.
+		conv.Conv = strings.TrimSuffix(conv.Conv, "+")
+	}
 
-			if tmp, err := strconv.Unquote(`"` + items[3] + `"`); err == nil {
-				dm.WarningMsg = tmp
-			}
+	if len(attrs) >= 3 {
+		conv.Name = attrs[2]
+	}
+
+	if len(attrs) >= 4 {
+		conv.DriveType = attrs[3]
+	}
 
-			// Split presets params so we can parse them.
-			attrTokens := strings.Split(items[4], " ")
+	return attrs[0], conv
+}
 
-			for t := 0; t < len(attrTokens); t += 2 {
-				if attrTokens[t] == "-v" {
-					attrs := strings.Split(attrTokens[t+1], ",")
+type USBBridge struct {
+	Name           string `yaml:"name,omitempty"`
+	Bridge         string `yaml:"bridge,omitempty"`
+	IDRegex        string `yaml:"id_regex"`
+	BCDDeviceRegex string `yaml:"bcd_device_regex,omitempty"`
+	DeviceType     string `yaml:"device_type,omitempty"`
+	Line           int    `yaml:"-"` // Line number of entry in drivedb.h
+}
 
-					if len(attrs) >= 3 {
-						dm.Presets[attrs[0]] = AttrConv{Conv: attrs[1], Name: attrs[2]}
-					} else {
-						dm.Presets[attrs[0]] = AttrConv{Conv: attrs[1]}
-					}
-				}
-			}
+type DriveDb struct {
+	Version    string       `yaml:"version,omitempty"`
+	Drives     []DriveModel `yaml:"drives"`
+	USBBridges []USBBridge  `yaml:"usb_bridges,omitempty"`
+}
 
-			drives = append(drives, dm)
-			items = make([]string, 5)
-			idx = 0
+// toDriveDb converts parsed drivedb.h entries to a drivedb.DriveDb, so that they can be validated.
+func toDriveDb(drives []DriveModel, source string) drivedb.DriveDb {
+	db := drivedb.DriveDb{Sources: []string{source}}
+
+	for _, d := range drives {
+		dm := drivedb.DriveModel{
+			Family:        d.Family,
+			ModelRegex:    d.ModelRegex,
+			FirmwareRegex: d.FirmwareRegex,
+			WarningMsg:    d.WarningMsg,
+			Presets:       make(map[string]drivedb.AttrPresets),
+			FirmwareBugs:  d.FirmwareBugs,
+			Source:        source,
+			Line:          d.Line,
 		}
 
-		prev = tok
+		for id, presets := range d.Presets {
+			for _, p := range presets {
+				dm.Presets[id] = append(dm.Presets[id], drivedb.AttrConv{
+					Conv:      p.Conv,
+					ByteOrder: p.ByteOrder,
+					Name:      p.Name,
+					DriveType: p.DriveType,
+					Source:    source,
+				})
+			}
+		}
+
+		db.Drives = append(db.Drives, dm)
+	}
+
+	return db
+}
+
+// writeDriveDb writes the header comment and YAML-encoded drive database to w.
+func writeDriveDb(w io.Writer, header string, db DriveDb) error {
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+
+	return enc.Encode(db)
+}
+
+// lint validates parsed drivedb.h entries and prints any problems found. It returns the number of
+// problems found.
+func lint(drives []DriveModel, source string) int {
+	db := toDriveDb(drives, source)
+	problems := db.Validate()
+
+	for _, p := range problems {
+		fmt.Println(p)
 	}
 
-	return header, drives
+	return len(problems)
 }
 
 func main() {
 	var (
 		drivedbURL              string
 		inFilename, outFilename string
+		lintOnly                bool
 		reader                  io.Reader
+		source                  string
 	)
 
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(diffMain(os.Args[2:]))
+	}
+
 	flag.StringVar(&drivedbURL, "url", defaultDrivedbURL, "Optional drivedb URL")
 	flag.StringVar(&inFilename, "in", "", "Optional path to local drivedb.h")
-	flag.StringVar(&outFilename, "out", "drivedb.yaml", "Output .yaml filename")
+	flag.StringVar(&outFilename, "out", "drivedb/drivedb.yaml", "Output .yaml filename")
+	flag.BoolVar(&lintOnly, "lint", false, "Validate drivedb.h entries and report problems, without writing output")
 	flag.Parse()
 
 	if inFilename != "" {
@@ -144,6 +216,7 @@ func main() {
 		defer f.Close()
 		fmt.Printf("Reading from local file %s\n", f.Name())
 		reader = f
+		source = f.Name()
 	} else {
 		resp, err := http.Get(drivedbURL)
 		if err != nil {
@@ -154,10 +227,27 @@ func main() {
 		defer resp.Body.Close()
 		fmt.Printf("Reading from fetched drivedb %s\n", drivedbURL)
 		reader = resp.Body
+		source = drivedbURL
+	}
+
+	header, db, err := parseDrivedb(reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot parse drivedb: %s: %v\n", source, err)
+		os.Exit(1)
 	}
 
-	header, drives := parseDrivedb(reader)
-	fmt.Printf("Parsed drivedb.h - %d entries\n", len(drives))
+	fmt.Printf("Parsed drivedb.h %s - %d drive entries, %d USB bridge entries\n",
+		db.Version, len(db.Drives), len(db.USBBridges))
+
+	if lintOnly {
+		if n := lint(db.Drives, source); n > 0 {
+			fmt.Fprintf(os.Stderr, "Found %d problems\n", n)
+			os.Exit(1)
+		}
+
+		fmt.Println("No problems found")
+		return
+	}
 
 	destFile, err := os.Create(outFilename)
 	if err != nil {
@@ -166,11 +256,8 @@ func main() {
 	}
 
 	defer destFile.Close()
-	destFile.WriteString(header)
-
-	enc := yaml.NewEncoder(destFile)
 
-	if err := enc.Encode(DriveDb{drives}); err != nil {
+	if err := writeDriveDb(destFile, header, db); err != nil {
 		fmt.Fprintf(os.Stderr, "Error encoding yaml: %v\n", err)
 		os.Exit(1)
 	}
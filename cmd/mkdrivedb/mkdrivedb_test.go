@@ -0,0 +1,161 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/drivedb"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestParseDrivedbGolden parses a vendored drivedb.h sample, and compares the YAML output with a
+// golden file. Run with -update to regenerate the golden file.
+func TestParseDrivedbGolden(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "drivedb.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, db, err := parseDrivedb(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDriveDb(&buf, header, db); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "drivedb.yaml")
+
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(expected), buf.String())
+}
+
+// TestParseDrivedbRoundTrip checks that the golden YAML file loads with the drivedb package, and
+// yields the same entries as parsed from drivedb.h.
+func TestParseDrivedbRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := os.Open(filepath.Join("testdata", "drivedb.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, parsed, err := parseDrivedb(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := drivedb.OpenDriveDb(filepath.Join("testdata", "drivedb.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(parsed.Version, db.Version)
+	assert.Len(db.Drives, len(parsed.Drives))
+	assert.Len(db.USBBridges, len(parsed.USBBridges))
+	assert.Empty(db.Validate())
+
+	expected := toDriveDb(parsed.Drives, "")
+
+	for i, d := range db.Drives {
+		assert.Equal(expected.Drives[i].Family, d.Family)
+		assert.Equal(expected.Drives[i].ModelRegex, d.ModelRegex)
+		assert.Equal(expected.Drives[i].FirmwareRegex, d.FirmwareRegex)
+		assert.Equal(expected.Drives[i].WarningMsg, d.WarningMsg)
+		assert.Equal(expected.Drives[i].FirmwareBugs, d.FirmwareBugs)
+		assert.Equal(len(expected.Drives[i].Presets), len(d.Presets))
+
+		for id, presets := range d.Presets {
+			for j, p := range presets {
+				assert.Equal(expected.Drives[i].Presets[id][j].Conv, p.Conv)
+				assert.Equal(expected.Drives[i].Presets[id][j].ByteOrder, p.ByteOrder)
+				assert.Equal(expected.Drives[i].Presets[id][j].Name, p.Name)
+				assert.Equal(expected.Drives[i].Presets[id][j].DriveType, p.DriveType)
+			}
+		}
+	}
+
+	// The DEFAULT entry is always first, and inactive conditional blocks are skipped.
+	assert.Equal("DEFAULT", db.Drives[0].Family)
+
+	for _, d := range db.Drives {
+		assert.False(strings.HasPrefix(d.Family, "USB:"))
+		assert.NotEqual("Obsolete Example Family", d.Family)
+		assert.NotEqual("Example Conditional Family", d.Family)
+	}
+
+	b, ok := db.LookupUSBBridge(0x0bc2, 0x2300, 0x0100)
+	assert.True(ok)
+	assert.Equal("usbjmicron", b.DeviceType)
+	assert.Equal("JMicron", b.Bridge)
+
+	_, ok = db.LookupUSBBridge(0x0bc2, 0x2300, 0x0200)
+	assert.False(ok)
+
+	b, ok = db.LookupUSBBridge(0x0bc2, 0x2101, 0x0001)
+	assert.True(ok)
+	assert.Equal("sat,12", b.DeviceType)
+}
+
+func TestParseDrivedbErrors(t *testing.T) {
+	for _, src := range []string{
+		`{ "family", "model", "", "" }`,
+		`{ "family", "model", "", "", "" `,
+		"#if 0\n{ \"a\", \"b\", \"\", \"\", \"\" }\n",
+		"#endif\n",
+		`"stray string"`,
+	} {
+		_, _, err := parseDrivedb(strings.NewReader(src))
+		assert.Error(t, err, src)
+	}
+}
+
+func TestReadDrives(t *testing.T) {
+	assert := assert.New(t)
+
+	drives, err := readDrives(strings.NewReader("# fleet\nST4000NM0023\tGS0F\n\nINTEL SSDSC2BB240G4\n"))
+	assert.NoError(err)
+	assert.Equal([]drivedb.DriveIdent{
+		{Model: "ST4000NM0023", Firmware: "GS0F"},
+		{Model: "INTEL SSDSC2BB240G4"},
+	}, drives)
+
+	// Would otherwise exclude every entry from the report
+	_, err = readDrives(strings.NewReader("# no drives yet\n\n"))
+	assert.Error(err)
+}
@@ -0,0 +1,485 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Smartmontools drivedb.h parser.
+//
+// drivedb.h is a fragment of C source code, which initialises an array of drive_settings structs:
+//
+//   { "family", "model regex", "firmware regex", "warning", "presets" },
+//
+// Each field is one or more adjacent string literals, which are concatenated. Entries may be
+// interspersed with comments and preprocessor directives (e.g., #if 0 ... #endif blocks). The first
+// entry is a VERSION pseudo-entry, the second is the DEFAULT pseudo-entry, and entries whose family
+// begins with "USB:" describe USB bridges rather than drives.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokString
+	tokComment
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // decoded string literal, comment text, or punctuation character
+	line int
+}
+
+// lexer tokenises drivedb.h, evaluating preprocessor conditionals as it goes. Tokens within
+// inactive conditional blocks are skipped.
+type lexer struct {
+	src     string
+	pos     int
+	line    int
+	bol     bool            // at beginning of line (ignoring whitespace)
+	defined map[string]bool // macros defined by #define
+	conds   []condState     // conditional (#if) stack
+}
+
+type condState struct {
+	active     bool // current branch is active
+	taken      bool // a branch of this conditional has already been active
+	parentLive bool // enclosing block is active
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, bol: true, defined: make(map[string]bool)}
+}
+
+func (l *lexer) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, a...))
+}
+
+// live reports whether tokens at the current position are in an active conditional block.
+func (l *lexer) live() bool {
+	return len(l.conds) == 0 || l.conds[len(l.conds)-1].active
+}
+
+// evalCond evaluates a preprocessor #if / #elif expression. Only integer constants, defined(NAME),
+// bare macro names and negation are supported. Undefined macros evaluate to false, as in C.
+func (l *lexer) evalCond(expr string) bool {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "!") {
+		return !l.evalCond(expr[1:])
+	}
+
+	if strings.HasPrefix(expr, "defined") {
+		name := strings.Trim(strings.TrimSpace(expr[len("defined"):]), "() \t")
+		return l.defined[name]
+	}
+
+	if n, err := strconv.ParseInt(expr, 0, 64); err == nil {
+		return n != 0
+	}
+
+	return l.defined[expr]
+}
+
+// directive processes a preprocessor directive line (without the leading '#').
+func (l *lexer) directive(text string) error {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	arg := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), fields[0]))
+	if i := strings.Index(arg, "//"); i >= 0 {
+		arg = strings.TrimSpace(arg[:i])
+	}
+
+	switch fields[0] {
+	case "if", "ifdef", "ifndef":
+		var cond bool
+
+		switch fields[0] {
+		case "if":
+			cond = l.evalCond(arg)
+		case "ifdef":
+			cond = l.defined[arg]
+		case "ifndef":
+			cond = !l.defined[arg]
+		}
+
+		live := l.live()
+		l.conds = append(l.conds, condState{active: live && cond, taken: cond, parentLive: live})
+	case "elif", "else":
+		if len(l.conds) == 0 {
+			return l.errorf("#%s without #if", fields[0])
+		}
+
+		c := &l.conds[len(l.conds)-1]
+		cond := fields[0] == "else" || l.evalCond(arg)
+		c.active = c.parentLive && !c.taken && cond
+		c.taken = c.taken || cond
+	case "endif":
+		if len(l.conds) == 0 {
+			return l.errorf("#endif without #if")
+		}
+
+		l.conds = l.conds[:len(l.conds)-1]
+	case "define":
+		if l.live() && len(fields) > 1 {
+			l.defined[fields[1]] = true
+		}
+	case "undef":
+		if l.live() && len(fields) > 1 {
+			delete(l.defined, fields[1])
+		}
+	case "include", "pragma", "error", "warning", "line":
+		// Included files cannot be followed, and the remaining directives are irrelevant.
+	default:
+		return l.errorf("unknown preprocessor directive #%s", fields[0])
+	}
+
+	return nil
+}
+
+// next returns the next token in an active conditional block.
+func (l *lexer) next() (token, error) {
+	for {
+		tok, err := l.scan()
+		if err != nil || tok.kind == tokEOF {
+			if err == nil && len(l.conds) > 0 {
+				err = l.errorf("unterminated #if")
+			}
+			return tok, err
+		}
+
+		if l.live() {
+			return tok, nil
+		}
+	}
+}
+
+// scan returns the next token, regardless of conditional state. Preprocessor directives are
+// processed internally.
+func (l *lexer) scan() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		switch {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.bol = true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case c == '#' && l.bol:
+			start := l.pos + 1
+
+			// Directives may be continued with a trailing backslash.
+			for l.pos < len(l.src) && (l.src[l.pos] != '\n' || l.src[l.pos-1] == '\\') {
+				if l.src[l.pos] == '\n' {
+					l.line++
+				}
+				l.pos++
+			}
+
+			text := strings.ReplaceAll(l.src[start:l.pos], "\\\n", " ")
+			if err := l.directive(text); err != nil {
+				return token{}, err
+			}
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+
+			tok := token{kind: tokComment, text: l.src[l.pos+2 : l.pos+end], line: l.line}
+			l.pos += end
+			return tok, nil
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return token{}, l.errorf("unterminated comment")
+			}
+
+			text := l.src[l.pos+2 : l.pos+2+end]
+			tok := token{kind: tokComment, text: text, line: l.line}
+			l.line += strings.Count(text, "\n")
+			l.pos += end + 4
+			l.bol = false
+			return tok, nil
+		case c == '"':
+			return l.scanString()
+		case c == '{' || c == '}' || c == ',' || c == ';' || c == '[' || c == ']' || c == '=':
+			l.pos++
+			l.bol = false
+			return token{kind: tokPunct, text: string(c), line: l.line}, nil
+		default:
+			// Identifiers, e.g. from an uncommented array declaration, are skipped.
+			if isIdentChar(c) {
+				for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+					l.pos++
+				}
+				l.bol = false
+				continue
+			}
+
+			return token{}, l.errorf("unexpected character %q", c)
+		}
+	}
+
+	return token{kind: tokEOF, line: l.line}, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// scanString scans a C string literal and decodes its escape sequences.
+func (l *lexer) scanString() (token, error) {
+	start := l.pos
+	l.pos++
+
+	for l.pos < len(l.src) && l.src[l.pos] != '"' {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '\n':
+			return token{}, l.errorf("newline in string literal")
+		}
+		l.pos++
+	}
+
+	if l.pos >= len(l.src) {
+		return token{}, l.errorf("unterminated string literal")
+	}
+
+	l.pos++
+	l.bol = false
+
+	s, err := unquoteC(l.src[start:l.pos])
+	if err != nil {
+		return token{}, l.errorf("invalid string literal %s: %v", l.src[start:l.pos], err)
+	}
+
+	return token{kind: tokString, text: s, line: l.line}, nil
+}
+
+// unquoteC decodes a double-quoted C string literal. C escape sequences are a subset of Go's, with
+// the exception of "\?", which Go does not support.
+func unquoteC(s string) (string, error) {
+	return strconv.Unquote(strings.ReplaceAll(s, `\?`, `?`))
+}
+
+// parser parses the drive_settings entries of drivedb.h.
+type parser struct {
+	lex    *lexer
+	tok    token
+	header string
+}
+
+// advance moves to the next non-comment token. The first comment of the file (usually the
+// copyright / license header) is retained.
+func (p *parser) advance() error {
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return err
+		}
+
+		if tok.kind == tokComment {
+			if p.tok.line == 0 && p.header == "" {
+				p.header = tok.text
+			}
+			continue
+		}
+
+		p.tok = tok
+		return nil
+	}
+}
+
+// fields parses the string fields of a brace-enclosed entry, up to and including the closing brace.
+// The opening brace must already have been consumed.
+func (p *parser) fields() ([]string, error) {
+	var fields []string
+
+	for {
+		if p.tok.kind != tokString {
+			return nil, fmt.Errorf("line %d: expected string, found %q", p.tok.line, p.tok.text)
+		}
+
+		// Adjacent string literals are concatenated.
+		var field string
+		for p.tok.kind == tokString {
+			field += p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		fields = append(fields, field)
+
+		if p.tok.kind == tokPunct && p.tok.text == "," {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.tok.kind == tokPunct && p.tok.text == "}" {
+			break
+		}
+	}
+
+	return fields, p.advance()
+}
+
+// parseDrivedb parses drivedb.h and returns the copyright / license header, converted to a YAML
+// comment, and the drive database.
+func parseDrivedb(src io.Reader) (string, DriveDb, error) {
+	var db DriveDb
+
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return "", db, err
+	}
+
+	p := parser{lex: newLexer(string(b))}
+	if err := p.advance(); err != nil {
+		return "", db, err
+	}
+
+	for p.tok.kind != tokEOF {
+		if p.tok.kind != tokPunct {
+			return "", db, fmt.Errorf("line %d: unexpected string %q outside of entry", p.tok.line, p.tok.text)
+		}
+
+		isBrace := p.tok.text == "{"
+		line := p.tok.line
+
+		if err := p.advance(); err != nil {
+			return "", db, err
+		}
+
+		// Skip declaration punctuation and the braces of the array initialiser itself.
+		if !isBrace || p.tok.kind != tokString {
+			continue
+		}
+
+		fields, err := p.fields()
+		if err != nil {
+			return "", db, err
+		}
+
+		if len(fields) != 5 {
+			return "", db, fmt.Errorf("line %d: expected 5 fields in entry, found %d", line, len(fields))
+		}
+
+		db.addEntry(fields, line)
+	}
+
+	header := "# This file was generated from:\n"
+	if p.header != "" {
+		for _, line := range strings.Split(p.header, "\n") {
+			header += strings.TrimRight("# "+strings.TrimLeft(line, "/* "), " ") + "\n"
+		}
+	}
+
+	return header, db, nil
+}
+
+// addEntry classifies a parsed drive_settings entry, and adds it to the drive database.
+func (db *DriveDb) addEntry(fields []string, line int) {
+	family, modelRegex, firmwareRegex, warning, presets := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	switch {
+	case strings.HasPrefix(family, "VERSION") || strings.HasPrefix(family, "$Id"):
+		db.Version = strings.TrimSpace(strings.TrimPrefix(family, "VERSION:"))
+	case strings.HasPrefix(family, "USB:"):
+		b := USBBridge{
+			IDRegex:        modelRegex,
+			BCDDeviceRegex: firmwareRegex,
+			Line:           line,
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(family, "USB:"))
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name, b.Bridge = strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+1:])
+		}
+		b.Name = name
+
+		for _, opt := range parsePresets(presets) {
+			if opt.name == "-d" {
+				b.DeviceType = opt.arg
+			}
+		}
+
+		db.USBBridges = append(db.USBBridges, b)
+	default:
+		dm := DriveModel{
+			Family:        family,
+			ModelRegex:    modelRegex,
+			FirmwareRegex: firmwareRegex,
+			WarningMsg:    warning,
+			Presets:       make(map[string]AttrPresets),
+			Line:          line,
+		}
+
+		for _, opt := range parsePresets(presets) {
+			switch opt.name {
+			case "-v":
+				id, conv := parseAttrDef(opt.arg)
+				dm.Presets[id] = append(dm.Presets[id], conv)
+			case "-F":
+				dm.FirmwareBugs = append(dm.FirmwareBugs, strings.Split(opt.arg, ",")...)
+			}
+		}
+
+		if family == "DEFAULT" {
+			// The DEFAULT entry must precede all drive entries.
+			db.Drives = append([]DriveModel{dm}, db.Drives...)
+		} else {
+			db.Drives = append(db.Drives, dm)
+		}
+	}
+}
+
+type presetOption struct {
+	name, arg string
+}
+
+// parsePresets splits a presets string (e.g., "-v 9,minutes -F samsung") into options and their
+// arguments.
+func parsePresets(s string) []presetOption {
+	var opts []presetOption
+
+	fields := strings.Fields(s)
+
+	for i := 0; i < len(fields); i++ {
+		opt := presetOption{name: fields[i]}
+
+		if strings.HasPrefix(opt.name, "-") && i+1 < len(fields) && !strings.HasPrefix(fields[i+1], "-") {
+			i++
+			opt.arg = fields[i]
+		}
+
+		opts = append(opts, opt)
+	}
+
+	return opts
+}
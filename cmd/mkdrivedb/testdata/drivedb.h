@@ -0,0 +1,158 @@
+/*
+ * drivedb.h - smartmontools drive database file
+ *
+ * Home page of code is: https://www.smartmontools.org
+ *
+ * Copyright (C) 2003-11 Philip Williams, Bruce Allen
+ * Copyright (C) 2008-22 Christian Franke
+ *
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+/*
+ * Structure used to store drive database entries:
+ *
+ * struct drive_settings {
+ *   const char * modelfamily;
+ *   const char * modelregexp;
+ *   const char * firmwareregexp;
+ *   const char * warningmsg;
+ *   const char * presets;
+ * };
+ *
+ * The elements are used in the following ways:
+ *
+ *  modelfamily     Informal string about the model family/series of a
+ *                  device. Set to "" if no info (apart from device id)
+ *                  known.  The entry is ignored if this string starts with
+ *                  a dollar sign.  Must not start with "USB:", see below.
+ *  modelregexp     POSIX extended regular expression to match the model of
+ *                  a device.  This should never be "".
+ *  firmwareregexp  POSIX extended regular expression to match a devices's
+ *                  firmware.  This is optional and should be "" if it is not
+ *                  to be used.  If it is nonempty then it will be used to
+ *                  narrow the set of devices matched by modelregexp.
+ *  warningmsg      A message that may be displayed for matching drives.  For
+ *                  example, to inform the user that they may need to apply a
+ *                  firmware patch.
+ *  presets         String with vendor-specific attribute ('-v') and firmware
+ *                  bug fix ('-F') options.  Same syntax as in smartctl command
+ *                  line.  The user's own settings override these.
+ */
+
+/*
+const drive_settings builtin_knowndrives[] = {
+ */
+  { "VERSION: 7.3 $Id: drivedb.h 5319 2022-02-26 16:29:49Z chrfranke $",
+    "-", "-",
+    "Version information",
+    ""
+  },
+  { "DEFAULT",
+    "-", "-",
+    "Default settings",
+    "-v 1,raw48,Raw_Read_Error_Rate "
+    "-v 2,raw48,Throughput_Performance "
+    "-v 3,raw16(avg16),Spin_Up_Time "
+    "-v 4,raw48,Start_Stop_Count "
+    "-v 5,raw16(raw16),Reallocated_Sector_Ct "
+    "-v 9,raw24(raw8),Power_On_Hours "
+    "-v 177,raw48,Wear_Leveling_Count,SSD "
+    "-v 194,tempminmax,Temperature_Celsius "
+    "-v 201,raw48,Soft_Read_Error_Rate,HDD "
+    "-v 201,raw48,Unknown_SSD_Attribute,SSD "
+    "-v 240,raw24(raw8),Head_Flying_Hours,HDD "
+    "-v 240,raw48,Unknown_SSD_Attribute,SSD "
+  },
+#if 0 // TODO: Remove or move to end of table
+  { "Obsolete Example Family",
+    "OBSOLETE [0-9]+",
+    "", "", ""
+  },
+#endif
+  { "Samsung based SSDs",
+    "SAMSUNG SSD PM8[4-5][01] .*|" // PM810 (470 Series)
+    "Samsung SSD 8[45]0 (EVO|PRO) .*",
+    "", "",
+    //"-v 9,raw24(raw8) " // default
+    "-v 177,raw48,Wear_Leveling_Count "
+    "-v 179,raw48,Used_Rsvd_Blk_Cnt_Tot "
+    "-v 190,tempminmax,Airflow_Temperature_Cel "
+    "-v 235,raw48,POR_Recovery_Count "
+    "-v 241,raw48,Total_LBAs_Written"
+  },
+  { "SAMSUNG SpinPoint P80", // tested with SP0802N/TK100-24
+    "SAMSUNG SP(0451|08[0-2]|12[0-5]|16[0-1])[CN]",
+    "TK100-23",
+    "May need -F samsung3 enabled; see manual for details",
+    "-F samsung3"
+  },
+  { "SAMSUNG SpinPoint PL40", // SV0412H/RK100-13
+    "SAMSUNG SV0412H",
+    "RK100-1[3-5]",
+    "",
+    "-v 9,halfminutes -v 194,10xCelsius -F samsung2"
+  },
+  { "Seagate Barracuda 7200.14 (AF)", // the easy one
+    "ST(1000|1500|2000|2500|3000)DM00[0-3]-.*",
+    "CC4[679CH]|CC5[1-4]", // tested with ST3000DM001-9YN166/CC4C
+    "A firmware update for this drive is available,\n"
+    "see the following Seagate web pages:\n"
+    "http://knowledge.seagate.com/articles/en_US/FAQ/223651en",
+    "-v 1,raw24/raw32 -v 7,raw24/raw32 "
+    "-v 188,raw16 -v 240,msec24hour32"
+  },
+  { "Seagate Barracuda 7200.14 (AF)",
+    "ST(1000|1500|2000|2500|3000)DM00[0-3]-.*",
+    "",
+    "",
+    "-v 1,raw24/raw32:21043 -v 7,raw24/raw32 "
+    "-v 188,raw16 -v 240,msec24hour32"
+  },
+#ifdef SMARTMONTOOLS_EXAMPLE_ENTRIES
+  { "Example Conditional Family",
+    "EXAMPLE [0-9]+",
+    "", "", ""
+  },
+#else
+  { "Western Digital Red", // tested with WDC WD10EFRX-68JCSN0/01.01A01
+    "WDC WD(7500BFCX|10JFCX|[1-6]0EFRX)-.*",
+    "",
+    "",
+    "-v 56,raw48:543210,Unknown_Attribute "
+    "-F nologdir"
+  },
+#endif
+#include "drivedb-local.h"
+  //
+  // USB ID entries
+  //
+  // 0x0350 ()
+  { "USB: ; ",
+    "0x0350:0x0000",
+    "",
+    "",
+    "-d sat"
+  },
+  // Seagate
+  { "USB: Seagate FreeAgent Go; ",
+    "0x0bc2:0x2(000|100|101)",
+    "", // 0x0001
+    "",
+    "-d sat,12"
+  },
+  { "USB: Seagate Expansion Portable; JMicron",
+    "0x0bc2:0x2300",
+    "0x0100",
+    "",
+    "-d usbjmicron"
+  },
+  { "USB: Toshiba Canvio 500GB; SunPlus",
+    "0x0480:0xa004",
+    "",
+    "",
+    "-d usbsunplus"
+  },
+/*
+}; // builtin_knowndrives[]
+ */
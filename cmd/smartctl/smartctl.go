@@ -75,6 +75,18 @@ func checkCaps() {
 	}
 }
 
+// stringList is a flag.Value that accumulates the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func scanDevices() {
 	for _, device := range smart.ScanDevices() {
 		fmt.Printf("%#v\n", device)
@@ -91,6 +103,41 @@ func scanDevices() {
 	//smart.MegaScan()
 }
 
+// selfTester is implemented by devices which support SCSI self-tests.
+type selfTester interface {
+	StartSelfTest(code uint8) error
+}
+
+func runSelfTest(d scsi.Device, test string) error {
+	st, ok := d.(selfTester)
+	if !ok {
+		return fmt.Errorf("device does not support self-tests")
+	}
+
+	codes := map[string]uint8{
+		"short": scsi.SELF_TEST_BACKGROUND_SHORT,
+		"long":  scsi.SELF_TEST_BACKGROUND_EXTENDED,
+		"abort": scsi.SELF_TEST_ABORT_BACKGROUND,
+	}
+
+	code, ok := codes[test]
+	if !ok {
+		return fmt.Errorf("invalid self-test %q", test)
+	}
+
+	if err := st.StartSelfTest(code); err != nil {
+		return err
+	}
+
+	if code == scsi.SELF_TEST_ABORT_BACKGROUND {
+		fmt.Println("Self-test aborted")
+	} else {
+		fmt.Printf("Background %s self-test started\n", test)
+	}
+
+	return nil
+}
+
 func main() {
 	fmt.Println("Go smartctl Reference Implementation")
 	fmt.Printf("Built with %s on %s (%s)\n\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
@@ -98,10 +145,20 @@ func main() {
 	device := flag.String("device", "", "SATA / NVMe device from which to read SMART attributes, e.g., /dev/sda, /dev/nvme0")
 	megaraidDev := flag.String("megaraid", "", "MegaRAID host and device ID from which to read SMART attributes, e.g., megaraid0_23")
 	scan := flag.Bool("scan", false, "Scan for drives that support SMART")
+	selfTest := flag.String("test", "", "Start a background self-test on a SCSI / SAS device (short, long or abort)")
+
+	var dbFiles stringList
+	flag.Var(&dbFiles, "drivedb", "Additional drivedb YAML file, taking precedence over the built-in drivedb (may be repeated)")
 	flag.Parse()
 
 	checkCaps()
 
+	db, err := drivedb.LoadDriveDb(dbFiles...)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if *device != "" {
 		var (
 			d   scsi.Device // interface
@@ -122,10 +179,12 @@ func main() {
 
 		defer d.Close()
 
-		db, err := drivedb.OpenDriveDb("drivedb.yaml")
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		if *selfTest != "" {
+			if err := runSelfTest(d, *selfTest); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
 		}
 
 		if err := d.PrintSMART(&db, os.Stdout); err != nil {
@@ -143,7 +202,10 @@ func main() {
 			os.Exit(1)
 		}
 
-		megaraid.OpenMegasasIoctl(host, disk)
+		if err := megaraid.OpenMegasasIoctl(host, disk, &db); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else if *scan {
 		scanDevices()
 	} else {
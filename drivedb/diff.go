@@ -0,0 +1,252 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Drive database comparison.
+
+package drivedb
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// DriveIdent identifies a drive by its ATA IDENTIFY model number and firmware revision.
+type DriveIdent struct {
+	Model    string
+	Firmware string
+}
+
+// PresetDiff describes a changed attribute conversion rule.
+type PresetDiff struct {
+	ID  string
+	Old AttrPresets // nil if the attribute preset was added
+	New AttrPresets // nil if the attribute preset was removed
+}
+
+// EntryDiff describes an added, removed or changed drive database entry. Entries are identified by
+// their family and firmware regex.
+type EntryDiff struct {
+	Family  string
+	Old     *DriveModel // nil if the entry was added
+	New     *DriveModel // nil if the entry was removed
+	Presets []PresetDiff
+}
+
+// Added reports whether the entry was added.
+func (d *EntryDiff) Added() bool {
+	return d.Old == nil
+}
+
+// Removed reports whether the entry was removed.
+func (d *EntryDiff) Removed() bool {
+	return d.New == nil
+}
+
+// NewWarning reports whether the entry has a new or changed warning, e.g., for buggy firmware.
+func (d *EntryDiff) NewWarning() bool {
+	return d.New != nil && d.New.WarningMsg != "" && (d.Old == nil || d.Old.WarningMsg != d.New.WarningMsg)
+}
+
+// DriveDiff describes a drive whose matching drive database entry has changed.
+type DriveDiff struct {
+	DriveIdent
+	OldFamily string
+	NewFamily string
+}
+
+// DriveDbDiff describes the differences between two versions of a drive database.
+type DriveDbDiff struct {
+	OldVersion string
+	NewVersion string
+	Entries    []EntryDiff
+	Drives     []DriveDiff // Drives which match a different entry, if a list of drives was given
+}
+
+// entryKey returns the key by which entries are paired up between drive database versions.
+func entryKey(d *DriveModel) string {
+	return d.Family + "\x00" + d.FirmwareRegex
+}
+
+// keyedEntries returns the indices of the non-placeholder entries of a drive database, keyed by
+// entry key and occurrence of that key (since entry keys are not necessarily unique).
+func keyedEntries(db *DriveDb) ([]string, map[string]int) {
+	var keys []string
+
+	idx := make(map[string]int)
+	seen := make(map[string]int)
+
+	for i := range db.Drives {
+		d := &db.Drives[i]
+		if isPlaceholder(d.Family) {
+			continue
+		}
+
+		base := entryKey(d)
+		key := base + "\x00" + strconv.Itoa(seen[base])
+		seen[base]++
+
+		keys = append(keys, key)
+		idx[key] = i
+	}
+
+	return keys, idx
+}
+
+// relevantKeys adds the keys of the entries matched by the specified drives in a drive database,
+// plus the key of the DEFAULT entry, to keys.
+func relevantKeys(db *DriveDb, drives []DriveIdent, keys map[string]bool) {
+	dbKeys, idx := keyedEntries(db)
+	byIndex := make(map[int]string)
+
+	for _, key := range dbKeys {
+		byIndex[idx[key]] = key
+	}
+
+	// Always build a fresh matcher, since the database may have been edited for comparison
+	m := newMatcher(db.Drives)
+
+	if m.defaultIdx >= 0 {
+		keys[byIndex[m.defaultIdx]] = true
+	}
+
+	for _, drive := range drives {
+		i := m.lookup(db.Drives, bytes.TrimSpace([]byte(drive.Model)), bytes.TrimSpace([]byte(drive.Firmware)))
+		if i >= 0 {
+			keys[byIndex[i]] = true
+		}
+	}
+}
+
+// Diff compares two versions of a drive database, and returns the added, removed and changed
+// entries. If a list of drives is given, only entries matching those drives (and the DEFAULT entry)
+// are reported, along with any drives which match a different entry in the new version.
+func Diff(oldDb, newDb *DriveDb, drives []DriveIdent) DriveDbDiff {
+	diff := DriveDbDiff{OldVersion: oldDb.Version, NewVersion: newDb.Version}
+
+	oldKeys, oldIdx := keyedEntries(oldDb)
+	newKeys, newIdx := keyedEntries(newDb)
+
+	var relevant map[string]bool
+	if drives != nil {
+		relevant = make(map[string]bool)
+		relevantKeys(oldDb, drives, relevant)
+		relevantKeys(newDb, drives, relevant)
+	}
+
+	include := func(key string) bool {
+		return relevant == nil || relevant[key]
+	}
+
+	for _, key := range oldKeys {
+		o := &oldDb.Drives[oldIdx[key]]
+
+		if !include(key) {
+			continue
+		}
+
+		if i, ok := newIdx[key]; ok {
+			n := &newDb.Drives[i]
+			if ed, changed := diffEntry(o, n); changed {
+				diff.Entries = append(diff.Entries, ed)
+			}
+		} else {
+			diff.Entries = append(diff.Entries, EntryDiff{Family: o.Family, Old: o})
+		}
+	}
+
+	for _, key := range newKeys {
+		if _, ok := oldIdx[key]; ok || !include(key) {
+			continue
+		}
+
+		n := &newDb.Drives[newIdx[key]]
+		diff.Entries = append(diff.Entries, EntryDiff{Family: n.Family, New: n})
+	}
+
+	for _, drive := range drives {
+		o := oldDb.LookupDrive([]byte(drive.Model), []byte(drive.Firmware))
+		n := newDb.LookupDrive([]byte(drive.Model), []byte(drive.Firmware))
+
+		if o.Family != n.Family {
+			diff.Drives = append(diff.Drives, DriveDiff{DriveIdent: drive, OldFamily: o.Family, NewFamily: n.Family})
+		}
+	}
+
+	return diff
+}
+
+// diffEntry compares two versions of an entry, and reports whether they differ.
+func diffEntry(o, n *DriveModel) (EntryDiff, bool) {
+	ed := EntryDiff{Family: n.Family, Old: o, New: n}
+
+	var ids []string
+
+	for id := range o.Presets {
+		ids = append(ids, id)
+	}
+
+	for id := range n.Presets {
+		if _, ok := o.Presets[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+
+	for _, id := range ids {
+		if !presetsEqual(o.Presets[id], n.Presets[id]) {
+			ed.Presets = append(ed.Presets, PresetDiff{ID: id, Old: o.Presets[id], New: n.Presets[id]})
+		}
+	}
+
+	changed := len(ed.Presets) > 0 || o.ModelRegex != n.ModelRegex || o.WarningMsg != n.WarningMsg ||
+		!stringsEqual(o.FirmwareBugs, n.FirmwareBugs)
+
+	return ed, changed
+}
+
+// presetsEqual compares the conversion rules of two attribute presets, ignoring their provenance.
+func presetsEqual(a, b AttrPresets) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Conv != b[i].Conv || a[i].ByteOrder != b[i].ByteOrder || a[i].Name != b[i].Name ||
+			a[i].DriveType != b[i].DriveType {
+			return false
+		}
+	}
+
+	return true
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
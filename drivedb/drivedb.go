@@ -15,90 +15,390 @@
 package drivedb
 
 import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
 	"os"
 	"regexp"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// EmbeddedSource is the source name of entries from the embedded default drive database.
+const EmbeddedSource = "<embedded>"
+
+//go:embed drivedb.yaml
+var embeddedDriveDb []byte
+
+// Drive types used to qualify attribute conversion rules, as determined from the ATA IDENTIFY
+// nominal media rotation rate.
+const (
+	DriveTypeUnknown = ""
+	DriveTypeHDD     = "HDD"
+	DriveTypeSSD     = "SSD"
+)
+
+// Firmware bug workarounds (drivedb.h "-F" presets). These describe known non-conformances in the
+// way certain drives encode their SMART logs.
+const (
+	FirmwareBugNoLogDir  = "nologdir"  // SMART log directory must not be read
+	FirmwareBugSamsung   = "samsung"   // self-test and error log fields are byte-swapped
+	FirmwareBugSamsung2  = "samsung2"  // error log error count is byte-swapped
+	FirmwareBugSamsung3  = "samsung3"  // completed self-test reported as in progress, 0% remaining
+	FirmwareBugXErrorLBA = "xerrorlba" // extended error log LBAs are little-endian
+	FirmwareBugSwapID    = "swapid"    // IDENTIFY strings are byte-swapped
+)
+
 // SMART attribute conversion rule
 type AttrConv struct {
-	Conv string `yaml:"conv"`
-	Name string `yaml:"name"`
+	Conv      string `yaml:"conv"`
+	ByteOrder string `yaml:"byte_order,omitempty"` // e.g. "543210", "r543210", empty for default
+	Name      string `yaml:"name"`
+	DriveType string `yaml:"drive_type,omitempty"` // "HDD", "SSD", or empty for any drive type
+	Source    string `yaml:"-"`                    // Drive database layer this rule came from
+	Inherited bool   `yaml:"-"`                    // Rule was inherited from the DEFAULT entry
+}
+
+// appliesTo reports whether the conversion rule is applicable to the specified drive type.
+func (c AttrConv) appliesTo(driveType string) bool {
+	return c.DriveType == "" || driveType == DriveTypeUnknown || c.DriveType == driveType
+}
+
+// AttrPresets is a list of conversion rules for a single SMART attribute ID. Most attributes have
+// exactly one rule, but some have alternative rules for HDDs and SSDs. For brevity, a single rule
+// may be represented in YAML as a mapping rather than a sequence.
+type AttrPresets []AttrConv
+
+func (p *AttrPresets) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var c AttrConv
+
+		if err := value.Decode(&c); err != nil {
+			return err
+		}
+
+		*p = AttrPresets{c}
+		return nil
+	}
+
+	return value.Decode((*[]AttrConv)(p))
+}
+
+// Select returns the most appropriate conversion rule for the specified drive type. A rule
+// qualified with a matching drive type is preferred over an unqualified rule. If the drive type is
+// unknown, an unqualified rule is preferred over the first qualified rule.
+func (p AttrPresets) Select(driveType string) (AttrConv, bool) {
+	var (
+		conv  AttrConv
+		found bool
+	)
+
+	for _, c := range p {
+		if !c.appliesTo(driveType) {
+			continue
+		}
+
+		if c.DriveType != "" && c.DriveType == driveType {
+			return c, true
+		}
+
+		if !found || (conv.DriveType != "" && c.DriveType == "") {
+			conv, found = c, true
+		}
+	}
+
+	return conv, found
 }
 
 type DriveModel struct {
-	Family         string              `yaml:"family"`
-	ModelRegex     string              `yaml:"model_regex"`
-	FirmwareRegex  string              `yaml:"firmware_regex"`
-	WarningMsg     string              `yaml:"warning"`
-	Presets        map[string]AttrConv `yaml:"presets"`
-	CompiledRegexp *regexp.Regexp
+	Family                 string                 `yaml:"family"`
+	ModelRegex             string                 `yaml:"model_regex"`
+	FirmwareRegex          string                 `yaml:"firmware_regex"`
+	WarningMsg             string                 `yaml:"warning"`
+	Presets                map[string]AttrPresets `yaml:"presets"`
+	FirmwareBugs           []string               `yaml:"firmware_bugs,omitempty"`
+	Source                 string                 `yaml:"-"` // Drive database layer this entry came from
+	Line                   int                    `yaml:"-"` // Line number of entry within its source
+	CompiledRegexp         *regexp.Regexp
+	CompiledFirmwareRegexp *regexp.Regexp
+}
+
+// matches reports whether the drive model's model and firmware regexes both match the supplied
+// model number and firmware revision. As with smartmontools, the regexes must match the entire
+// string, and an empty firmware regex matches any firmware revision.
+func (d *DriveModel) matches(model, firmware []byte) bool {
+	if d.CompiledRegexp == nil || !d.CompiledRegexp.Match(model) {
+		return false
+	}
+
+	if d.CompiledFirmwareRegexp != nil && !d.CompiledFirmwareRegexp.Match(firmware) {
+		return false
+	}
+
+	return true
+}
+
+// HasFirmwareBug reports whether the drive model is known to have the specified firmware bug.
+func (d *DriveModel) HasFirmwareBug(bug string) bool {
+	for _, b := range d.FirmwareBugs {
+		if b == bug {
+			return true
+		}
+	}
+
+	return false
 }
 
+// DriveDb is a drive database, possibly consisting of several layers. Entries from earlier layers
+// take precedence over entries from later layers.
 type DriveDb struct {
+	Version string `yaml:"version,omitempty"` // Version of the smartmontools drivedb.h
+
+	// Drives are indexed when the database is loaded. Entries must not be modified in place
+	// afterwards (e.g., changing a regex) without calling Reindex, otherwise lookups use a stale
+	// index. Replacing the whole slice is detected automatically.
 	Drives []DriveModel `yaml:"drives"`
+
+	USBBridges []USBBridge `yaml:"usb_bridges,omitempty"`
+	Sources    []string    `yaml:"-"` // Layers of the database, in order of precedence
+	idx        *matcher
+}
+
+// Reindex rebuilds the lookup index of the drive database. It must be called after entries of the
+// Drives slice have been modified in place.
+func (db *DriveDb) Reindex() {
+	db.idx = newMatcher(db.Drives)
+}
+
+// index returns the precompiled matcher for the drive database, building a temporary one if the
+// Drives slice has been replaced since the matcher was built. Entries modified in place are not
+// detected, see Reindex.
+func (db *DriveDb) index() *matcher {
+	if db.idx == nil || !db.idx.indexes(db.Drives) {
+		return newMatcher(db.Drives)
+	}
+
+	return db.idx
 }
 
-// LookupDrive returns the most appropriate DriveModel for a given ATA IDENTIFY value.
-func (db *DriveDb) LookupDrive(ident []byte) DriveModel {
+// LookupDrive returns the most appropriate DriveModel for a given ATA IDENTIFY model number and
+// firmware revision. If the matched entry carries a warning (e.g., for known-buggy firmware), it is
+// returned in the WarningMsg field of the result.
+//
+// The returned DriveModel is independent of the drive database, and contains the presets of the
+// DEFAULT entry merged with those of the matched family entry. The Inherited field of each preset
+// indicates whether it came from the DEFAULT entry. LookupDrive is safe for concurrent use.
+func (db *DriveDb) LookupDrive(modelNum, firmwareRev []byte) DriveModel {
 	var model DriveModel
 
-	for _, d := range db.Drives {
-		// Skip placeholder entry
-		if strings.HasPrefix(d.Family, "$Id") {
-			continue
-		}
+	modelNum = bytes.TrimSpace(modelNum)
+	firmwareRev = bytes.TrimSpace(firmwareRev)
 
-		if d.Family == "DEFAULT" {
-			model = d
-			continue
+	idx := db.index()
+	model.Presets = make(map[string]AttrPresets)
+
+	if idx.defaultIdx >= 0 {
+		def := db.Drives[idx.defaultIdx]
+
+		// The DEFAULT entry's "warning" is merely a description, so it is not copied.
+		model.Family = def.Family
+		model.ModelRegex = def.ModelRegex
+		model.FirmwareRegex = def.FirmwareRegex
+		model.CompiledRegexp = def.CompiledRegexp
+		model.CompiledFirmwareRegexp = def.CompiledFirmwareRegexp
+		model.FirmwareBugs = append([]string(nil), def.FirmwareBugs...)
+		model.Source = def.Source
+
+		for id, presets := range def.Presets {
+			inherited := make(AttrPresets, len(presets))
+
+			for i, p := range presets {
+				p.Inherited = true
+				inherited[i] = p
+			}
+
+			model.Presets[id] = inherited
 		}
+	}
+
+	if i := idx.lookup(db.Drives, modelNum, firmwareRev); i >= 0 {
+		d := db.Drives[i]
+
+		model.Family = d.Family
+		model.ModelRegex = d.ModelRegex
+		model.FirmwareRegex = d.FirmwareRegex
+		model.WarningMsg = d.WarningMsg
+		model.CompiledRegexp = d.CompiledRegexp
+		model.CompiledFirmwareRegexp = d.CompiledFirmwareRegexp
+		model.FirmwareBugs = append([]string(nil), d.FirmwareBugs...)
+		model.Source = d.Source
 
-		if d.CompiledRegexp.Match(ident) {
-			model.Family = d.Family
-			model.ModelRegex = d.ModelRegex
-			model.FirmwareRegex = d.FirmwareRegex
-			model.WarningMsg = d.WarningMsg
-			model.CompiledRegexp = d.CompiledRegexp
-
-			for id, p := range d.Presets {
-				if _, exists := model.Presets[id]; exists {
-					// Some drives override the conv but don't specify a name, so copy it from default
-					if p.Name == "" {
-						p.Name = model.Presets[id].Name
+		for id, presets := range d.Presets {
+			merged := make(AttrPresets, len(presets))
+
+			for i, p := range presets {
+				// Some drives override the conv but don't specify a name, so copy it from default
+				if p.Name == "" {
+					if dp, exists := model.Presets[id].Select(p.DriveType); exists {
+						p.Name = dp.Name
 					}
 				}
-				model.Presets[id] = AttrConv{Name: p.Name, Conv: p.Conv}
+				merged[i] = p
 			}
 
-			break
+			model.Presets[id] = merged
 		}
 	}
 
 	return model
 }
 
+// Append adds the entries of another drive database as a lower precedence layer.
+func (db *DriveDb) Append(other DriveDb) {
+	db.Drives = append(db.Drives, other.Drives...)
+	db.USBBridges = append(db.USBBridges, other.USBBridges...)
+	db.Sources = append(db.Sources, other.Sources...)
+	db.Reindex()
+
+	if db.Version == "" {
+		db.Version = other.Version
+	}
+}
+
+// parseDriveDb unmarshalls a YAML-formatted drive database, records the source and line number of
+// each entry, and compiles the regexes of each entry. An invalid regex is reported as an error,
+// since the entry would otherwise silently never match.
+func parseDriveDb(r io.Reader, source string) (DriveDb, error) {
+	var (
+		db   DriveDb
+		root yaml.Node
+	)
+
+	dec := yaml.NewDecoder(r)
+
+	if err := dec.Decode(&root); err != nil {
+		return db, fmt.Errorf("%s: %v", source, err)
+	}
+
+	if err := root.Decode(&db); err != nil {
+		return db, fmt.Errorf("%s: %v", source, err)
+	}
+
+	db.Sources = []string{source}
+	lines := entryLines(&root, "drives")
+
+	for i, d := range db.Drives {
+		var err error
+
+		db.Drives[i].Source = source
+
+		if i < len(lines) {
+			db.Drives[i].Line = lines[i]
+		}
+
+		if db.Drives[i].CompiledRegexp, err = regexp.Compile(anchorRegexp(d.ModelRegex)); err != nil {
+			return db, fmt.Errorf("%s:%d: invalid model regex: %v", source, db.Drives[i].Line, err)
+		}
+
+		if d.FirmwareRegex != "" {
+			if db.Drives[i].CompiledFirmwareRegexp, err = regexp.Compile(anchorRegexp(d.FirmwareRegex)); err != nil {
+				return db, fmt.Errorf("%s:%d: invalid firmware regex: %v", source, db.Drives[i].Line, err)
+			}
+		}
+
+		for _, presets := range d.Presets {
+			for j := range presets {
+				presets[j].Source = source
+			}
+		}
+	}
+
+	lines = entryLines(&root, "usb_bridges")
+
+	for i := range db.USBBridges {
+		b := &db.USBBridges[i]
+		b.Source = source
+
+		if i < len(lines) {
+			b.Line = lines[i]
+		}
+
+		if err := b.compile(); err != nil {
+			return db, fmt.Errorf("%s:%d: %v", source, b.Line, err)
+		}
+	}
+
+	db.Reindex()
+
+	return db, nil
+}
+
+// entryLines returns the line numbers of the entries of a top-level sequence of a YAML document.
+func entryLines(root *yaml.Node, key string) []int {
+	var lines []int
+
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+
+	doc := root.Content[0]
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == key {
+			for _, n := range doc.Content[i+1].Content {
+				lines = append(lines, n.Line)
+			}
+		}
+	}
+
+	return lines
+}
+
 // OpenDriveDb opens a YAML-formatted drive database, unmarshalls it, and returns a DriveDb.
 func OpenDriveDb(dbfile string) (DriveDb, error) {
-	var db DriveDb
-
 	f, err := os.Open(dbfile)
 	if err != nil {
-		return db, nil
+		return DriveDb{}, err
 	}
 
 	defer f.Close()
-	dec := yaml.NewDecoder(f)
 
-	if err := dec.Decode(&db); err != nil {
-		return db, err
+	return parseDriveDb(f, dbfile)
+}
+
+// EmbeddedDriveDb returns the default drive database embedded in the binary.
+func EmbeddedDriveDb() (DriveDb, error) {
+	return parseDriveDb(bytes.NewReader(embeddedDriveDb), EmbeddedSource)
+}
+
+// LoadDriveDb returns a drive database consisting of the specified files layered on top of the
+// embedded default database (similar to smartctl's "-B +FILE" option). Files are listed in order of
+// precedence, i.e., entries in the first file take precedence over entries in subsequent files,
+// which in turn take precedence over the embedded default.
+func LoadDriveDb(files ...string) (DriveDb, error) {
+	var db DriveDb
+
+	for _, fn := range files {
+		layer, err := OpenDriveDb(fn)
+		if err != nil {
+			return db, err
+		}
+
+		db.Append(layer)
 	}
 
-	for i, d := range db.Drives {
-		db.Drives[i].CompiledRegexp, _ = regexp.Compile(d.ModelRegex)
+	layer, err := EmbeddedDriveDb()
+	if err != nil {
+		return db, err
 	}
 
+	db.Append(layer)
+
 	return db, nil
 }
+
+// anchorRegexp wraps a drivedb regex so that it must match the entire input string.
+func anchorRegexp(re string) string {
+	return "^(?:" + re + ")$"
+}
@@ -0,0 +1,333 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivedb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDriveDb = `drives:
+- family: DEFAULT
+  model_regex: '-'
+  firmware_regex: '-'
+  warning: Default settings
+  presets:
+    "1":
+      conv: raw48
+      name: Raw_Read_Error_Rate
+    "9":
+      conv: raw24(raw8)
+      name: Power_On_Hours
+    "201":
+    - conv: raw48
+      name: Soft_Read_Error_Rate
+      drive_type: HDD
+    - conv: raw48
+      name: Unknown_SSD_Attribute
+      drive_type: SSD
+- family: Example Buggy Firmware
+  model_regex: 'EXAMPLE HD[0-9]+'
+  firmware_regex: 'BAD1|BAD2'
+  warning: This firmware is known to lose data
+  presets:
+    "9":
+      conv: min2hour
+- family: Example Family
+  model_regex: 'EXAMPLE HD[0-9]+'
+  presets:
+    "1":
+      conv: raw48
+      byte_order: "543210"
+    "9":
+      conv: raw48
+`
+
+func openTestDriveDb(t *testing.T) DriveDb {
+	fn := filepath.Join(t.TempDir(), "drivedb.yaml")
+	if err := os.WriteFile(fn, []byte(testDriveDb), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenDriveDb(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestLookupDriveFirmware(t *testing.T) {
+	assert := assert.New(t)
+	db := openTestDriveDb(t)
+
+	// Model and firmware both match the buggy firmware entry.
+	m := db.LookupDrive([]byte("EXAMPLE HD1000    "), []byte("BAD2    "))
+	assert.Equal("Example Buggy Firmware", m.Family)
+	assert.Equal("This firmware is known to lose data", m.WarningMsg)
+
+	// Model matches, but firmware does not, so the generic family entry is used.
+	m = db.LookupDrive([]byte("EXAMPLE HD1000"), []byte("GOOD1"))
+	assert.Equal("Example Family", m.Family)
+	assert.Empty(m.WarningMsg)
+
+	// Partial model matches must not be accepted.
+	m = db.LookupDrive([]byte("XEXAMPLE HD1000"), []byte("BAD1"))
+	assert.Equal("DEFAULT", m.Family)
+	assert.Empty(m.WarningMsg)
+}
+
+func TestAttrPresets(t *testing.T) {
+	assert := assert.New(t)
+	db := openTestDriveDb(t)
+
+	m := db.LookupDrive([]byte("EXAMPLE HD1000"), []byte("GOOD1"))
+
+	// Family overrides byte order but not name, so name must be inherited from DEFAULT.
+	c, ok := m.Presets["1"].Select(DriveTypeHDD)
+	assert.True(ok)
+	assert.Equal("raw48", c.Conv)
+	assert.Equal("543210", c.ByteOrder)
+	assert.Equal("Raw_Read_Error_Rate", c.Name)
+
+	c, ok = m.Presets["201"].Select(DriveTypeHDD)
+	assert.True(ok)
+	assert.Equal("Soft_Read_Error_Rate", c.Name)
+
+	c, ok = m.Presets["201"].Select(DriveTypeSSD)
+	assert.True(ok)
+	assert.Equal("Unknown_SSD_Attribute", c.Name)
+
+	_, ok = m.Presets["2"].Select(DriveTypeSSD)
+	assert.False(ok)
+}
+
+func TestLoadDriveDbLayers(t *testing.T) {
+	assert := assert.New(t)
+
+	fn := filepath.Join(t.TempDir(), "site.yaml")
+	if err := os.WriteFile(fn, []byte(testDriveDb), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := LoadDriveDb(fn)
+	assert.NoError(err)
+	assert.Equal([]string{fn, EmbeddedSource}, db.Sources)
+
+	// Site entries take precedence over the embedded default, including the DEFAULT entry.
+	m := db.LookupDrive([]byte("EXAMPLE HD1000"), []byte("GOOD1"))
+	assert.Equal("Example Family", m.Family)
+	assert.Equal(fn, m.Source)
+
+	m = db.LookupDrive([]byte("UNKNOWN"), []byte("1.0"))
+	assert.Equal("DEFAULT", m.Family)
+	assert.Equal(fn, m.Source)
+
+	_, err = LoadDriveDb(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(err)
+
+	db, err = EmbeddedDriveDb()
+	assert.NoError(err)
+	assert.Equal("DEFAULT", db.Drives[0].Family)
+	assert.Equal(EmbeddedSource, db.Drives[0].Presets["1"][0].Source)
+}
+
+func TestLookupDriveNonMutating(t *testing.T) {
+	assert := assert.New(t)
+	db := openTestDriveDb(t)
+
+	m := db.LookupDrive([]byte("EXAMPLE HD1000"), []byte("BAD1"))
+	assert.Equal("min2hour", m.Presets["9"][0].Conv)
+	assert.False(m.Presets["9"][0].Inherited)
+	assert.True(m.Presets["1"][0].Inherited)
+
+	// Modifying the result must not affect the database.
+	m.Presets["1"][0].Conv = "hex48"
+
+	m = db.LookupDrive([]byte("UNKNOWN"), []byte("1.0"))
+	assert.Equal("DEFAULT", m.Family)
+	assert.Equal("raw24(raw8)", m.Presets["9"][0].Conv)
+	assert.Equal("raw48", m.Presets["1"][0].Conv)
+	assert.True(m.Presets["9"][0].Inherited)
+}
+
+func TestLookupDriveReplacedDrives(t *testing.T) {
+	db := openTestDriveDb(t)
+
+	// Replacing the Drives slice with one of the same length must not reuse the stale matcher
+	other := openTestDriveDb(t)
+	other.Drives[1].Family = "Other Family"
+	other.Drives[1].ModelRegex = "OTHER.*"
+	other.Drives[1].CompiledRegexp = regexp.MustCompile(anchorRegexp("OTHER.*"))
+	other.Drives[1].FirmwareRegex = ""
+	other.Drives[1].CompiledFirmwareRegexp = nil
+
+	db.Drives = other.Drives
+
+	m := db.LookupDrive([]byte("OTHER DRIVE"), []byte("1.0"))
+	assert.Equal(t, "Other Family", m.Family)
+}
+
+func TestLookupDriveReindex(t *testing.T) {
+	db := openTestDriveDb(t)
+
+	// Entries modified in place are only found after reindexing
+	db.Drives[1].Family = "Other Family"
+	db.Drives[1].ModelRegex = "OTHER.*"
+	db.Drives[1].CompiledRegexp = regexp.MustCompile(anchorRegexp("OTHER.*"))
+	db.Drives[1].FirmwareRegex = ""
+	db.Drives[1].CompiledFirmwareRegexp = nil
+	db.Reindex()
+
+	m := db.LookupDrive([]byte("OTHER DRIVE"), []byte("1.0"))
+	assert.Equal(t, "Other Family", m.Family)
+}
+
+func TestMatcher(t *testing.T) {
+	regexes := []string{
+		"ST[0-9]+AS",
+		"(WDC )?WD[0-9]+EFRX-.*",
+		"(?i)samsung SSD 8[45]0 .*",
+		"Hitachi HDS72(1|2)0.*|HGST HUS.*",
+		"(MK|HDD)[0-9]{4}GSX",
+		".*Generic.*",
+		"[A-C]?X[0-9]*",
+	}
+
+	drives := make([]DriveModel, len(regexes))
+	for i, re := range regexes {
+		drives[i].Family = re
+		drives[i].ModelRegex = re
+		drives[i].CompiledRegexp = regexp.MustCompile(anchorRegexp(re))
+	}
+
+	m := newMatcher(drives)
+
+	models := []string{
+		"ST3000AS", "WDC WD40EFRX-68N32N0", "WD40EFRX-68N32N0", "SAMSUNG SSD 840 EVO",
+		"Samsung SSD 850 PRO", "HGST HUS726040ALA610", "Hitachi HDS722020ALA330", "MK1234GSX",
+		"HDD1234GSX", "Foo Generic Bar", "X12", "BX1", "DX1", "", "unknown",
+	}
+
+	for _, model := range models {
+		expected := -1
+		for i := range drives {
+			if drives[i].matches([]byte(model), nil) {
+				expected = i
+				break
+			}
+		}
+
+		assert.Equal(t, expected, m.lookup(drives, []byte(model), nil), model)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	db := DriveDb{Drives: []DriveModel{
+		{Family: "DEFAULT", ModelRegex: "-", Line: 1, Presets: map[string]AttrPresets{
+			"1":   {{Conv: "raw48", Name: "Raw_Read_Error_Rate"}},
+			"256": {{Conv: "raw48"}},
+			"9":   {{Conv: "raw42", ByteOrder: "54321x", DriveType: "TAPE"}},
+		}},
+		{Family: "Bad Regex", ModelRegex: "ST(1000", Line: 2},
+		{Family: "Perl Regex", ModelRegex: `ST\d+`, Line: 3},
+		{Family: "Bracket Backslash", ModelRegex: `ST[\.]+`, Line: 4},
+		{Family: "Family A", ModelRegex: "WD[0-9]+", Line: 5},
+		{Family: "Family A", ModelRegex: "WD[0-9]+", Line: 6},
+		{Family: "Family B", ModelRegex: "WD[0-9]+", FirmwareRegex: "01.*", Line: 7},
+		{Family: "Good", ModelRegex: "HGST [[:alnum:]]+", Line: 8},
+	}}
+
+	for i := range db.Drives {
+		db.Drives[i].Source = "test.yaml"
+	}
+
+	var msgs []string
+	for _, p := range db.Validate() {
+		msgs = append(msgs, p.String())
+	}
+
+	assert.ElementsMatch([]string{
+		`test.yaml:1: "DEFAULT": invalid attribute ID "256"`,
+		`test.yaml:1: "DEFAULT": attribute 9: unknown conv "raw42"`,
+		`test.yaml:1: "DEFAULT": attribute 9: invalid byte order "54321x"`,
+		`test.yaml:1: "DEFAULT": attribute 9: invalid drive type "TAPE"`,
+		"test.yaml:2: \"Bad Regex\": model regex: invalid regex \"ST(1000\": error parsing regexp: missing closing ): `ST(1000`",
+		"test.yaml:3: \"Perl Regex\": model regex: regex \"ST\\\\d+\" is not POSIX ERE compatible: error parsing regexp: invalid escape sequence: `\\d`",
+		`test.yaml:4: "Bracket Backslash": model regex: regex "ST[\\.]+" has a backslash in a bracket expression, which is literal in POSIX ERE but an escape in RE2`,
+		`test.yaml:6: "Family A": duplicate of entry at line 5`,
+		`test.yaml:7: "Family B": shadowed by "Family A" at line 5, which matches any firmware`,
+	}, msgs)
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	oldDb := openTestDriveDb(t)
+	base := openTestDriveDb(t)
+
+	// Change a preset and the model regex, add a warning and a new family, remove the buggy
+	// firmware entry. The loaded database must not be modified, so build a new one.
+	changed := base.Drives[2]
+	changed.Presets = make(map[string]AttrPresets)
+	for id, presets := range base.Drives[2].Presets {
+		changed.Presets[id] = presets
+	}
+	changed.Presets["9"] = AttrPresets{{Conv: "min2hour", Name: "Power_On_Minutes"}}
+	changed.ModelRegex = "EXAMPLE (HD|SD)[0-9]+"
+	changed.WarningMsg = "Update firmware"
+
+	drives := []DriveModel{base.Drives[0], changed}
+	drives = append(drives, base.Drives[3:]...)
+	drives = append(drives, DriveModel{Family: "Other Family", ModelRegex: "OTHER.*"})
+
+	newDb := DriveDb{Version: base.Version, Drives: drives, Sources: base.Sources}
+
+	diff := Diff(&oldDb, &newDb, nil)
+	if assert.Len(diff.Entries, 3) {
+		assert.True(diff.Entries[0].Removed())
+		assert.Equal("Example Buggy Firmware", diff.Entries[0].Family)
+
+		e := diff.Entries[1]
+		assert.Equal("Example Family", e.Family)
+		assert.True(e.NewWarning())
+		if assert.Len(e.Presets, 1) {
+			assert.Equal("9", e.Presets[0].ID)
+			assert.Equal("min2hour", e.Presets[0].New[0].Conv)
+		}
+
+		assert.True(diff.Entries[2].Added())
+		assert.Equal("Other Family", diff.Entries[2].Family)
+	}
+
+	// Narrowed to a drive with buggy firmware, which now falls through to the family entry.
+	diff = Diff(&oldDb, &newDb, []DriveIdent{{Model: "EXAMPLE HD1", Firmware: "BAD1"}})
+	assert.Len(diff.Entries, 2)
+	if assert.Len(diff.Drives, 1) {
+		assert.Equal("Example Buggy Firmware", diff.Drives[0].OldFamily)
+		assert.Equal("Example Family", diff.Drives[0].NewFamily)
+	}
+
+	// Narrowed to an unknown drive, which is only affected by the (unchanged) DEFAULT entry.
+	diff = Diff(&oldDb, &newDb, []DriveIdent{{Model: "UNKNOWN"}})
+	assert.Empty(diff.Entries)
+	assert.Empty(diff.Drives)
+}
@@ -0,0 +1,200 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Indexed drive database matcher.
+
+package drivedb
+
+import (
+	"regexp/syntax"
+	"unicode"
+)
+
+// byteSet is a set of possible first bytes of strings matched by a regex.
+type byteSet [256]bool
+
+func (s *byteSet) addRange(lo, hi rune) bool {
+	// Model numbers are ASCII, so do not bother indexing anything else.
+	if hi >= 0x80 {
+		return false
+	}
+
+	for r := lo; r <= hi; r++ {
+		s[r] = true
+	}
+
+	return true
+}
+
+func (s *byteSet) addRune(r rune, foldCase bool) bool {
+	if !s.addRange(r, r) {
+		return false
+	}
+
+	if foldCase {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < 0x80 {
+				s[f] = true
+			}
+		}
+	}
+
+	return true
+}
+
+// firstBytes adds the possible first bytes of strings matched by re to the set. It returns
+// nullable = true if re can match the empty string (in which case the first byte is determined by
+// whatever follows re), and ok = false if the first byte cannot be determined.
+func (s *byteSet) firstBytes(re *syntax.Regexp) (nullable bool, ok bool) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return false, true
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpBeginText, syntax.OpWordBoundary,
+		syntax.OpNoWordBoundary:
+		return true, true
+	case syntax.OpEndLine, syntax.OpEndText:
+		// Matches only the empty string at the end of the input.
+		return true, true
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return true, true
+		}
+		return false, s.addRune(re.Rune[0], re.Flags&syntax.FoldCase != 0)
+	case syntax.OpCharClass:
+		for i := 0; i < len(re.Rune); i += 2 {
+			if !s.addRange(re.Rune[i], re.Rune[i+1]) {
+				return false, false
+			}
+		}
+		return false, true
+	case syntax.OpCapture, syntax.OpPlus:
+		return s.firstBytes(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		_, ok := s.firstBytes(re.Sub[0])
+		return true, ok
+	case syntax.OpRepeat:
+		nullable, ok := s.firstBytes(re.Sub[0])
+		return nullable || re.Min == 0, ok
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			nullable, ok := s.firstBytes(sub)
+			if !ok {
+				return false, false
+			}
+
+			if !nullable {
+				return false, true
+			}
+		}
+		return true, true
+	case syntax.OpAlternate:
+		var anyNullable bool
+
+		for _, sub := range re.Sub {
+			nullable, ok := s.firstBytes(sub)
+			if !ok {
+				return false, false
+			}
+
+			anyNullable = anyNullable || nullable
+		}
+		return anyNullable, true
+	}
+
+	// OpAnyChar, OpAnyCharNotNL, and anything else we don't understand.
+	return false, false
+}
+
+// matcher is a precompiled index of drive database entries, keyed by the possible first bytes of
+// the model numbers matched by each entry's model regex. It narrows down the set of regexes that
+// need to be evaluated for each lookup, while preserving the precedence order of entries. A matcher
+// is immutable once built, and hence safe for concurrent use.
+type matcher struct {
+	first      *DriveModel // First drive database entry indexed, to detect a replaced Drives slice
+	size       int         // Number of drive database entries indexed
+	defaultIdx int         // Index of highest precedence DEFAULT entry, or -1
+	buckets    [256][]int  // Candidate entry indices for each possible first byte of a model number
+	all        []int       // All candidate entry indices, used for empty model numbers
+}
+
+// indexes reports whether the matcher was built from the specified slice of drive database entries.
+func (m *matcher) indexes(drives []DriveModel) bool {
+	if len(drives) != m.size {
+		return false
+	}
+
+	return len(drives) == 0 || &drives[0] == m.first
+}
+
+func newMatcher(drives []DriveModel) *matcher {
+	m := &matcher{size: len(drives), defaultIdx: -1}
+	if len(drives) > 0 {
+		m.first = &drives[0]
+	}
+
+	for i, d := range drives {
+		if d.Family == "DEFAULT" {
+			if m.defaultIdx < 0 {
+				m.defaultIdx = i
+			}
+			continue
+		}
+
+		// Skip placeholder entries
+		if isPlaceholder(d.Family) {
+			continue
+		}
+
+		m.all = append(m.all, i)
+
+		var set byteSet
+
+		re, err := syntax.Parse(d.ModelRegex, syntax.Perl)
+		if err == nil {
+			nullable, ok := set.firstBytes(re.Simplify())
+			if ok && !nullable {
+				for b, present := range set {
+					if present {
+						m.buckets[b] = append(m.buckets[b], i)
+					}
+				}
+				continue
+			}
+		}
+
+		// First byte cannot be determined, so the entry is a candidate for any model number.
+		for b := range m.buckets {
+			m.buckets[b] = append(m.buckets[b], i)
+		}
+	}
+
+	return m
+}
+
+// lookup returns the index of the highest precedence entry matching the model number and firmware
+// revision, or -1 if no entry matches.
+func (m *matcher) lookup(drives []DriveModel, modelNum, firmwareRev []byte) int {
+	candidates := m.all
+	if len(modelNum) > 0 {
+		candidates = m.buckets[modelNum[0]]
+	}
+
+	for _, i := range candidates {
+		if drives[i].matches(modelNum, firmwareRev) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,73 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// USB bridge database entries.
+
+package drivedb
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// USBBridge maps a USB vendor:product ID (and optionally a device release number) to the type of
+// the USB to SATA / PATA bridge, i.e. how ATA commands must be passed through to the drive.
+type USBBridge struct {
+	Name           string `yaml:"name,omitempty"`             // Vendor / product name
+	Bridge         string `yaml:"bridge,omitempty"`           // Bridge chip, if known
+	IDRegex        string `yaml:"id_regex"`                   // Regex for "0xVVVV:0xPPPP" ID
+	BCDDeviceRegex string `yaml:"bcd_device_regex,omitempty"` // Regex for "0xRRRR" device release
+	DeviceType     string `yaml:"device_type,omitempty"`      // smartctl device type, e.g. "sat"
+
+	Source            string         `yaml:"-"` // Drive database layer this entry came from
+	Line              int            `yaml:"-"` // Line number of entry within its source
+	compiledIDRegexp  *regexp.Regexp // Compiled IDRegex
+	compiledBCDRegexp *regexp.Regexp // Compiled BCDDeviceRegex, or nil
+}
+
+// compile compiles the regexes of a USB bridge entry.
+func (b *USBBridge) compile() (err error) {
+	if b.compiledIDRegexp, err = regexp.Compile(anchorRegexp(b.IDRegex)); err != nil {
+		return fmt.Errorf("invalid USB ID regex: %v", err)
+	}
+
+	if b.BCDDeviceRegex != "" {
+		if b.compiledBCDRegexp, err = regexp.Compile(anchorRegexp(b.BCDDeviceRegex)); err != nil {
+			return fmt.Errorf("invalid USB device release regex: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// LookupUSBBridge returns the highest precedence USB bridge entry matching the specified USB vendor
+// ID, product ID and device release number (bcdDevice).
+func (db *DriveDb) LookupUSBBridge(vendorID, productID, bcdDevice uint16) (USBBridge, bool) {
+	id := fmt.Sprintf("0x%04x:0x%04x", vendorID, productID)
+	bcd := fmt.Sprintf("0x%04x", bcdDevice)
+
+	for _, b := range db.USBBridges {
+		if b.compiledIDRegexp == nil || !b.compiledIDRegexp.MatchString(id) {
+			continue
+		}
+
+		if b.compiledBCDRegexp != nil && !b.compiledBCDRegexp.MatchString(bcd) {
+			continue
+		}
+
+		return b, true
+	}
+
+	return USBBridge{}, false
+}
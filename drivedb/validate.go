@@ -0,0 +1,244 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Drive database validation.
+
+package drivedb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KnownConvs is the set of SMART attribute raw value conversions understood by the ata package.
+var KnownConvs = map[string]bool{
+	"raw8":         true,
+	"raw16":        true,
+	"raw48":        true,
+	"raw56":        true,
+	"raw64":        true,
+	"hex48":        true,
+	"hex56":        true,
+	"hex64":        true,
+	"raw16(raw16)": true,
+	"raw16(avg16)": true,
+	"raw24(raw8)":  true,
+	"raw24/raw24":  true,
+	"raw24/raw32":  true,
+	"min2hour":     true,
+	"sec2hour":     true,
+	"halfmin2hour": true,
+	"msec24hour32": true,
+	"tempminmax":   true,
+	"temp10x":      true,
+}
+
+// Problem describes a single problem found while validating a drive database.
+type Problem struct {
+	Source  string // Drive database layer containing the problem
+	Line    int    // Line number of the offending entry, if known
+	Family  string // Family of the offending entry
+	Message string
+}
+
+func (p Problem) String() string {
+	loc := p.Source
+	if p.Line > 0 {
+		loc += ":" + strconv.Itoa(p.Line)
+	}
+
+	return fmt.Sprintf("%s: %q: %s", loc, p.Family, p.Message)
+}
+
+// Validate checks the drive database for invalid regexes (including regexes which would be
+// interpreted differently by the POSIX ERE engine used by smartmontools), unknown raw value
+// conversions, invalid attribute IDs, and duplicate or shadowed entries. Entries are only checked
+// for shadowing by other entries from the same layer, since higher precedence layers are expected
+// to override lower precedence layers.
+func (db *DriveDb) Validate() []Problem {
+	var problems []Problem
+
+	for i, d := range db.Drives {
+		report := func(format string, a ...interface{}) {
+			problems = append(problems, Problem{
+				Source:  d.Source,
+				Line:    d.Line,
+				Family:  d.Family,
+				Message: fmt.Sprintf(format, a...),
+			})
+		}
+
+		if isPlaceholder(d.Family) {
+			continue
+		}
+
+		for _, msg := range checkRegexp(d.ModelRegex) {
+			report("model regex: %s", msg)
+		}
+
+		if d.FirmwareRegex != "" {
+			for _, msg := range checkRegexp(d.FirmwareRegex) {
+				report("firmware regex: %s", msg)
+			}
+		}
+
+		for id, presets := range d.Presets {
+			if n, err := strconv.Atoi(id); id != "N" && (err != nil || n < 1 || n > 255) {
+				report("invalid attribute ID %q", id)
+			}
+
+			for _, p := range presets {
+				for _, msg := range checkAttrConv(p) {
+					report("attribute %s: %s", id, msg)
+				}
+			}
+		}
+
+		for _, b := range d.FirmwareBugs {
+			if !knownFirmwareBugs[b] {
+				report("unknown firmware bug preset %q", b)
+			}
+		}
+
+		if d.Family == "DEFAULT" {
+			continue
+		}
+
+		for _, prev := range db.Drives[:i] {
+			if prev.Source != d.Source || prev.Family == "DEFAULT" || isPlaceholder(prev.Family) {
+				continue
+			}
+
+			if prev.ModelRegex != d.ModelRegex {
+				continue
+			}
+
+			if prev.FirmwareRegex == d.FirmwareRegex {
+				if prev.Family == d.Family {
+					report("duplicate of entry at line %d", prev.Line)
+				} else {
+					report("shadowed by %q at line %d", prev.Family, prev.Line)
+				}
+				break
+			} else if prev.FirmwareRegex == "" {
+				report("shadowed by %q at line %d, which matches any firmware", prev.Family, prev.Line)
+				break
+			}
+		}
+	}
+
+	return problems
+}
+
+var knownFirmwareBugs = map[string]bool{
+	"none":               true,
+	FirmwareBugNoLogDir:  true,
+	FirmwareBugSamsung:   true,
+	FirmwareBugSamsung2:  true,
+	FirmwareBugSamsung3:  true,
+	FirmwareBugXErrorLBA: true,
+	FirmwareBugSwapID:    true,
+}
+
+// isPlaceholder reports whether a family name denotes a placeholder (version information) entry.
+func isPlaceholder(family string) bool {
+	return strings.HasPrefix(family, "$Id") || strings.HasPrefix(family, "VERSION")
+}
+
+// checkRegexp checks that a regex is valid RE2 syntax, and that it would be interpreted the same
+// way by a POSIX ERE engine.
+func checkRegexp(re string) []string {
+	var msgs []string
+
+	if _, err := regexp.Compile(re); err != nil {
+		return []string{fmt.Sprintf("invalid regex %q: %v", re, err)}
+	}
+
+	if _, err := regexp.CompilePOSIX(re); err != nil {
+		msgs = append(msgs, fmt.Sprintf("regex %q is not POSIX ERE compatible: %v", re, err))
+	}
+
+	if hasBracketBackslash(re) {
+		msgs = append(msgs, fmt.Sprintf("regex %q has a backslash in a bracket expression, which is "+
+			"literal in POSIX ERE but an escape in RE2", re))
+	}
+
+	return msgs
+}
+
+// hasBracketBackslash reports whether a regex contains a backslash inside a bracket expression.
+func hasBracketBackslash(re string) bool {
+	inBracket := false
+
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+
+		if !inBracket {
+			switch c {
+			case '\\':
+				i++ // skip escaped character
+			case '[':
+				inBracket = true
+				// A leading ']' (optionally after '^') is a literal member of the bracket expression.
+				if i+1 < len(re) && re[i+1] == '^' {
+					i++
+				}
+				if i+1 < len(re) && re[i+1] == ']' {
+					i++
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '\\':
+			return true
+		case '[':
+			// Skip character class names, e.g. [:alpha:]
+			if i+1 < len(re) && re[i+1] == ':' {
+				if end := strings.Index(re[i+2:], ":]"); end >= 0 {
+					i += end + 3
+				}
+			}
+		case ']':
+			inBracket = false
+		}
+	}
+
+	return false
+}
+
+// checkAttrConv checks an attribute conversion rule for unknown conversions, invalid byte orders
+// and invalid drive type qualifiers.
+func checkAttrConv(c AttrConv) []string {
+	var msgs []string
+
+	if !KnownConvs[c.Conv] {
+		msgs = append(msgs, fmt.Sprintf("unknown conv %q", c.Conv))
+	}
+
+	if len(c.ByteOrder) > 8 || strings.Trim(c.ByteOrder, "012345rvw") != "" {
+		msgs = append(msgs, fmt.Sprintf("invalid byte order %q", c.ByteOrder))
+	}
+
+	switch c.DriveType {
+	case "", DriveTypeHDD, DriveTypeSSD:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid drive type %q", c.DriveType))
+	}
+
+	return msgs
+}
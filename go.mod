@@ -3,7 +3,6 @@ module github.com/dswarbrick/smart
 go 1.19
 
 require (
-	github.com/dswarbrick/go-nvme v0.0.0-20221105200149-f4470ea4e016
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/sys v0.3.0
 	gopkg.in/yaml.v3 v3.0.1
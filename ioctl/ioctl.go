@@ -70,3 +70,13 @@ func Ioctl(fd, cmd, ptr uintptr) error {
 	}
 	return nil
 }
+
+// IoctlResult executes an ioctl command on the specified file descriptor, and returns the
+// (non-negative) return value of the ioctl, which some drivers use to report a command status.
+func IoctlResult(fd, cmd, ptr uintptr) (uintptr, error) {
+	r1, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, cmd, ptr)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r1, nil
+}
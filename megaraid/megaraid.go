@@ -348,7 +348,38 @@ func (d *MegasasDevice) inquiry() scsi.InquiryResponse {
 	return inqBuf
 }
 
-func OpenMegasasIoctl(host uint16, diskNum uint8) error {
+// LogPage fetches and parses a SCSI log page from device
+func (d *MegasasDevice) LogPage(page, subpage uint8) (scsi.LogPage, error) {
+	// The MFI pass-through frame does not report a residual count, so assume a full transfer
+	return scsi.ReadLogPage(page, subpage, func(cdb []byte, buf []byte) (int, error) {
+		err := d.ctl.PassThru(d.hostNum, uint8(d.deviceId), cdb, buf, scsi.SG_DXFER_FROM_DEV)
+		return len(buf), err
+	})
+}
+
+// SASPortLog fetches the SAS phy error counters of a SAS device
+func (d *MegasasDevice) SASPortLog() (scsi.SASPortLog, error) {
+	lp, err := d.LogPage(scsi.LOG_PROTOCOL_SPECIFIC_PORT, scsi.LOG_SUBPAGE_NONE)
+	if err != nil {
+		return nil, err
+	}
+
+	return scsi.DecodeSASPortLog(lp)
+}
+
+// FarmLog fetches the Seagate FARM log of a device, via LOG SENSE for SAS devices, or via ATA
+// pass-through for SATA devices
+func (d *MegasasDevice) FarmLog() (ata.FarmLog, error) {
+	if lp, err := d.LogPage(scsi.LOG_FARM, scsi.LOG_SUBPAGE_FARM); err == nil {
+		return scsi.DecodeFarmLogPage(lp)
+	}
+
+	return scsi.ReadFarmLog(func(cdb []byte, buf []byte) error {
+		return d.ctl.PassThru(d.hostNum, uint8(d.deviceId), cdb, buf, scsi.SG_DXFER_FROM_DEV)
+	})
+}
+
+func OpenMegasasIoctl(host uint16, diskNum uint8, db *drivedb.DriveDb) error {
 	var respBuf []byte
 
 	m, _ := CreateMegasasIoctl()
@@ -378,18 +409,19 @@ func OpenMegasasIoctl(host uint16, diskNum uint8) error {
 	ident_buf := ata.IdentifyDeviceData{}
 	binary.Read(bytes.NewBuffer(respBuf), utils.NativeEndian, &ident_buf)
 
+	thisDrive := db.LookupDrive(ident_buf.ModelNumber(), ident_buf.FirmwareRevision())
+	ident_buf.FixFirmwareBugs(thisDrive)
+
 	fmt.Println("\nATA IDENTIFY data follows:")
 	fmt.Printf("Serial Number: %s\n", ident_buf.SerialNumber())
 	fmt.Printf("Firmware Revision: %s\n", ident_buf.FirmwareRevision())
 	fmt.Printf("Model Number: %s\n", ident_buf.ModelNumber())
 
-	db, err := drivedb.OpenDriveDb("drivedb.yaml")
-	if err != nil {
-		return err
-	}
+	fmt.Printf("Drive DB contains %d entries. Using model: %s (from %s)\n", len(db.Drives), thisDrive.Family, thisDrive.Source)
 
-	thisDrive := db.LookupDrive(ident_buf.ModelNumber())
-	fmt.Printf("Drive DB contains %d entries. Using model: %s\n", len(db.Drives), thisDrive.Family)
+	if thisDrive.WarningMsg != "" {
+		fmt.Printf("\n==> WARNING: %s\n", thisDrive.WarningMsg)
+	}
 
 	// Send ATA SMART READ command as a CDB16 passthru command
 	cdb = scsi.CDB16{scsi.SCSI_ATA_PASSTHRU_16}
@@ -407,7 +439,7 @@ func OpenMegasasIoctl(host uint16, diskNum uint8) error {
 
 	smart := ata.SmartPage{}
 	binary.Read(bytes.NewBuffer(respBuf[:362]), utils.NativeEndian, &smart)
-	ata.PrintSMARTPage(smart, thisDrive, os.Stdout)
+	ata.PrintSMARTPage(smart, thisDrive, ident_buf.DriveType(), os.Stdout)
 
 	return nil
 }
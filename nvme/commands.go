@@ -0,0 +1,75 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// NVMe command definitions.
+
+package nvme
+
+import (
+	"unsafe"
+
+	"github.com/dswarbrick/smart/ioctl"
+)
+
+const (
+	// Admin command set opcodes
+	NVME_ADMIN_GET_LOG_PAGE = 0x02
+	NVME_ADMIN_IDENTIFY     = 0x06
+
+	// Identify controller or namespace structure (CNS)
+	NVME_IDENTIFY_CNS_NAMESPACE  = 0x00
+	NVME_IDENTIFY_CNS_CONTROLLER = 0x01
+
+	// Log page identifiers
+	NVME_LOG_ERROR    = 0x01
+	NVME_LOG_SMART    = 0x02
+	NVME_LOG_FW_SLOT  = 0x03
+	NVME_LOG_SELFTEST = 0x06
+
+	// Namespace ID which refers to all namespaces (or the controller)
+	NVME_NSID_ALL = 0xffffffff
+
+	// Length of Identify data structures
+	NVME_IDENTIFY_LEN = 4096
+
+	DEFAULT_TIMEOUT = 20000 // Timeout in milliseconds
+)
+
+var (
+	// Defined in <linux/nvme_ioctl.h>
+	NVME_IOCTL_ADMIN_CMD = ioctl.Iowr('N', 0x41, unsafe.Sizeof(nvmePassthruCommand{}))
+)
+
+// nvmePassthruCommand is struct nvme_passthru_cmd from <linux/nvme_ioctl.h>. The first 64 bytes
+// correspond to the NVMe common command format.
+type nvmePassthruCommand struct {
+	opcode       uint8
+	flags        uint8
+	rsvd1        uint16
+	nsid         uint32
+	cdw2         uint32
+	cdw3         uint32
+	metadata     uint64
+	addr         uint64
+	metadata_len uint32
+	data_len     uint32
+	cdw10        uint32
+	cdw11        uint32
+	cdw12        uint32
+	cdw13        uint32
+	cdw14        uint32
+	cdw15        uint32
+	timeout_ms   uint32
+	result       uint32
+} // 72 bytes
@@ -0,0 +1,335 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// NVMe Identify Controller and Identify Namespace data structures.
+
+package nvme
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/dswarbrick/smart/utils"
+)
+
+type nvmeIdentPowerState struct {
+	MaxPower        uint16 // Centiwatts
+	Rsvd2           uint8
+	Flags           uint8
+	EntryLat        uint32 // Microseconds
+	ExitLat         uint32 // Microseconds
+	ReadTput        uint8
+	ReadLat         uint8
+	WriteTput       uint8
+	WriteLat        uint8
+	IdlePower       uint16
+	IdleScale       uint8
+	Rsvd19          uint8
+	ActivePower     uint16
+	ActiveWorkScale uint8
+	Rsvd23          [9]byte
+} // 32 bytes
+
+// nvmeIdentController is the raw Identify Controller data structure (CNS 01h).
+type nvmeIdentController struct {
+	VendorID     uint16                  // PCI Vendor ID
+	Ssvid        uint16                  // PCI Subsystem Vendor ID
+	SerialNumber [20]byte                // Serial Number
+	ModelNumber  [40]byte                // Model Number
+	Firmware     [8]byte                 // Firmware Revision
+	Rab          uint8                   // Recommended Arbitration Burst
+	IEEE         [3]byte                 // IEEE OUI Identifier
+	Cmic         uint8                   // Controller Multi-Path I/O and Namespace Sharing Capabilities
+	Mdts         uint8                   // Maximum Data Transfer Size
+	Cntlid       uint16                  // Controller ID
+	Ver          uint32                  // Version
+	Rtd3r        uint32                  // RTD3 Resume Latency
+	Rtd3e        uint32                  // RTD3 Entry Latency
+	Oaes         uint32                  // Optional Asynchronous Events Supported
+	Rsvd96       [160]byte               // ...
+	Oacs         uint16                  // Optional Admin Command Support
+	Acl          uint8                   // Abort Command Limit
+	Aerl         uint8                   // Asynchronous Event Request Limit
+	Frmw         uint8                   // Firmware Updates
+	Lpa          uint8                   // Log Page Attributes
+	Elpe         uint8                   // Error Log Page Entries
+	Npss         uint8                   // Number of Power States Support
+	Avscc        uint8                   // Admin Vendor Specific Command Configuration
+	Apsta        uint8                   // Autonomous Power State Transition Attributes
+	Wctemp       uint16                  // Warning Composite Temperature Threshold
+	Cctemp       uint16                  // Critical Composite Temperature Threshold
+	Mtfa         uint16                  // Maximum Time for Firmware Activation
+	Hmpre        uint32                  // Host Memory Buffer Preferred Size
+	Hmmin        uint32                  // Host Memory Buffer Minimum Size
+	Tnvmcap      [16]byte                // Total NVM Capacity
+	Unvmcap      [16]byte                // Unallocated NVM Capacity
+	Rpmbs        uint32                  // Replay Protected Memory Block Support
+	Rsvd316      [196]byte               // ...
+	Sqes         uint8                   // Submission Queue Entry Size
+	Cqes         uint8                   // Completion Queue Entry Size
+	Rsvd514      [2]byte                 // (defined in NVMe 1.3 spec)
+	Nn           uint32                  // Number of Namespaces
+	Oncs         uint16                  // Optional NVM Command Support
+	Fuses        uint16                  // Fused Operation Support
+	Fna          uint8                   // Format NVM Attributes
+	Vwc          uint8                   // Volatile Write Cache
+	Awun         uint16                  // Atomic Write Unit Normal
+	Awupf        uint16                  // Atomic Write Unit Power Fail
+	Nvscc        uint8                   // NVM Vendor Specific Command Configuration
+	Rsvd531      uint8                   // ...
+	Acwu         uint16                  // Atomic Compare & Write Unit
+	Rsvd534      [2]byte                 // ...
+	Sgls         uint32                  // SGL Support
+	Rsvd540      [1508]byte              // ...
+	Psd          [32]nvmeIdentPowerState // Power State Descriptors
+	Vs           [1024]byte              // Vendor Specific
+} // 4096 bytes
+
+type nvmeLBAF struct {
+	Ms uint16
+	Ds uint8
+	Rp uint8
+}
+
+// nvmeIdentNamespace is the raw Identify Namespace data structure (CNS 00h).
+type nvmeIdentNamespace struct {
+	Nsze    uint64
+	Ncap    uint64
+	Nuse    uint64
+	Nsfeat  uint8
+	Nlbaf   uint8
+	Flbas   uint8
+	Mc      uint8
+	Dpc     uint8
+	Dps     uint8
+	Nmic    uint8
+	Rescap  uint8
+	Fpi     uint8
+	Rsvd33  uint8
+	Nawun   uint16
+	Nawupf  uint16
+	Nacwu   uint16
+	Nabsn   uint16
+	Nabo    uint16
+	Nabspf  uint16
+	Rsvd46  [2]byte
+	Nvmcap  [16]byte
+	Rsvd64  [40]byte
+	Nguid   [16]byte
+	EUI64   [8]byte
+	Lbaf    [16]nvmeLBAF
+	Rsvd192 [192]byte
+	Vs      [3712]byte
+} // 4096 bytes
+
+// PowerState is an NVMe power state descriptor.
+type PowerState struct {
+	MaxPower     uint16 // Centiwatts
+	NonOperating bool
+	EntryLatency uint32 // Microseconds
+	ExitLatency  uint32 // Microseconds
+}
+
+// NVMeController encapsulates the attributes of an NVMe controller.
+type NVMeController struct {
+	VendorID          uint16
+	SubsystemVendorID uint16
+	ModelNumber       string
+	SerialNumber      string
+	FirmwareVersion   string
+	OUI               uint32 // IEEE OUI identifier
+	ControllerID      uint16
+	Version           uint32 // NVMe version, e.g. 0x00010300 for 1.3
+	MaxDataXferSize   uint   // In units of the minimum memory page size, 0 = no limit
+	NumNamespaces     uint32
+	ErrorLogEntries   uint
+	SMARTPerNamespace bool   // SMART / Health log page is available per namespace
+	WarningTemp       uint16 // Warning composite temperature threshold (Kelvin), 0 = not reported
+	CriticalTemp      uint16 // Critical composite temperature threshold (Kelvin), 0 = not reported
+	TotalCapacity     *big.Int
+	VolatileCache     bool
+	PowerStates       []PowerState
+}
+
+// VersionString returns the NVMe version supported by the controller, e.g. "1.3".
+func (c NVMeController) VersionString() string {
+	if c.Version == 0 {
+		return "not reported"
+	}
+
+	s := fmt.Sprintf("%d.%d", c.Version>>16, (c.Version>>8)&0xff)
+	if tertiary := c.Version & 0xff; tertiary != 0 {
+		s += fmt.Sprintf(".%d", tertiary)
+	}
+
+	return s
+}
+
+// Print outputs the attributes of an NVMe controller in a pretty-print style.
+func (c NVMeController) Print(w io.Writer) {
+	fmt.Fprintf(w, "Vendor ID          : %#04x\n", c.VendorID)
+	fmt.Fprintf(w, "Model number       : %s\n", c.ModelNumber)
+	fmt.Fprintf(w, "Serial number      : %s\n", c.SerialNumber)
+	fmt.Fprintf(w, "Firmware version   : %s\n", c.FirmwareVersion)
+	fmt.Fprintf(w, "IEEE OUI identifier: %#06x\n", c.OUI)
+	fmt.Fprintf(w, "NVMe version       : %s\n", c.VersionString())
+	fmt.Fprintf(w, "Max. data xfer size: %d pages\n", c.MaxDataXferSize)
+	fmt.Fprintf(w, "Namespaces         : %d\n", c.NumNamespaces)
+
+	if c.TotalCapacity != nil && c.TotalCapacity.Sign() > 0 {
+		fmt.Fprintf(w, "Total NVM capacity : %s\n", utils.FormatBigBytes(new(big.Int).Set(c.TotalCapacity)))
+	}
+
+	for i, ps := range c.PowerStates {
+		fmt.Fprintf(w, "Power state %d: max %d.%02d W, entry latency %d us, exit latency %d us\n",
+			i, ps.MaxPower/100, ps.MaxPower%100, ps.EntryLatency, ps.ExitLatency)
+	}
+}
+
+// le128ToBigInt takes a little-endian 16-byte slice and returns a *big.Int representing it.
+func le128ToBigInt(buf [16]byte) *big.Int {
+	// Int.SetBytes() expects big-endian input, so reverse the bytes locally first
+	rev := make([]byte, 16)
+	for x := 0; x < 16; x++ {
+		rev[x] = buf[16-x-1]
+	}
+
+	return new(big.Int).SetBytes(rev)
+}
+
+// DecodeIdentifyController decodes an Identify Controller data structure.
+func DecodeIdentifyController(buf []byte) (NVMeController, error) {
+	var id nvmeIdentController
+
+	if len(buf) < NVME_IDENTIFY_LEN {
+		return NVMeController{}, fmt.Errorf("identify controller: short response (%d bytes)", len(buf))
+	}
+
+	binary.Read(bytes.NewBuffer(buf), binary.LittleEndian, &id)
+
+	c := NVMeController{
+		VendorID:          id.VendorID,
+		SubsystemVendorID: id.Ssvid,
+		ModelNumber:       string(bytes.TrimSpace(id.ModelNumber[:])),
+		SerialNumber:      string(bytes.TrimSpace(id.SerialNumber[:])),
+		FirmwareVersion:   string(bytes.TrimSpace(id.Firmware[:])),
+		// IEEE OUI identifier is stored least significant byte first
+		OUI:               uint32(id.IEEE[0]) | uint32(id.IEEE[1])<<8 | uint32(id.IEEE[2])<<16,
+		ControllerID:      id.Cntlid,
+		Version:           id.Ver,
+		NumNamespaces:     id.Nn,
+		ErrorLogEntries:   uint(id.Elpe) + 1,
+		SMARTPerNamespace: id.Lpa&0x01 != 0,
+		WarningTemp:       id.Wctemp,
+		CriticalTemp:      id.Cctemp,
+		TotalCapacity:     le128ToBigInt(id.Tnvmcap),
+		VolatileCache:     id.Vwc&0x01 != 0,
+	}
+
+	if id.Mdts != 0 {
+		c.MaxDataXferSize = 1 << id.Mdts
+	}
+
+	// Number of power states is zero-based, and limited to the number of descriptors
+	numPS := int(id.Npss) + 1
+	if numPS > len(id.Psd) {
+		numPS = len(id.Psd)
+	}
+
+	for _, ps := range id.Psd[:numPS] {
+		c.PowerStates = append(c.PowerStates, PowerState{
+			MaxPower:     ps.MaxPower,
+			NonOperating: ps.Flags&0x02 != 0,
+			EntryLatency: ps.EntryLat,
+			ExitLatency:  ps.ExitLat,
+		})
+	}
+
+	return c, nil
+}
+
+// LBAFormat is an NVMe LBA format descriptor.
+type LBAFormat struct {
+	MetadataSize        uint16 // Bytes
+	DataSize            uint32 // Bytes
+	RelativePerformance uint8  // 0 = best, 3 = degraded
+}
+
+// NVMeNamespace encapsulates the attributes of an NVMe namespace.
+type NVMeNamespace struct {
+	ID           uint32
+	Size         uint64 // Total size, in logical blocks
+	Capacity     uint64 // Maximum number of logical blocks which may be allocated
+	Utilization  uint64 // Logical blocks currently allocated
+	LBAFormats   []LBAFormat
+	FormattedLBA int // Index of the LBA format the namespace is formatted with
+	NGUID        [16]byte
+	EUI64        [8]byte
+}
+
+// LBASize returns the size of a logical block of the namespace, in bytes.
+func (ns NVMeNamespace) LBASize() uint32 {
+	if ns.FormattedLBA >= len(ns.LBAFormats) {
+		return 0
+	}
+
+	return ns.LBAFormats[ns.FormattedLBA].DataSize
+}
+
+func (ns NVMeNamespace) Print(w io.Writer) {
+	lbaSize := uint64(ns.LBASize())
+
+	fmt.Fprintf(w, "Namespace %d size: %d sectors (%s)\n", ns.ID, ns.Size, utils.FormatBytes(ns.Size*lbaSize))
+	fmt.Fprintf(w, "Namespace %d utilisation: %d sectors (%s)\n", ns.ID, ns.Utilization,
+		utils.FormatBytes(ns.Utilization*lbaSize))
+	fmt.Fprintf(w, "Namespace %d formatted LBA size: %d\n", ns.ID, lbaSize)
+}
+
+// DecodeIdentifyNamespace decodes an Identify Namespace data structure.
+func DecodeIdentifyNamespace(nsid uint32, buf []byte) (NVMeNamespace, error) {
+	var id nvmeIdentNamespace
+
+	if len(buf) < NVME_IDENTIFY_LEN {
+		return NVMeNamespace{}, fmt.Errorf("identify namespace: short response (%d bytes)", len(buf))
+	}
+
+	binary.Read(bytes.NewBuffer(buf), binary.LittleEndian, &id)
+
+	ns := NVMeNamespace{
+		ID:           nsid,
+		Size:         id.Nsze,
+		Capacity:     id.Ncap,
+		Utilization:  id.Nuse,
+		FormattedLBA: int(id.Flbas & 0x0f),
+		NGUID:        id.Nguid,
+		EUI64:        id.EUI64,
+	}
+
+	// Number of LBA formats is zero-based
+	for _, f := range id.Lbaf[:int(id.Nlbaf&0x0f)+1] {
+		lbaf := LBAFormat{MetadataSize: f.Ms, RelativePerformance: f.Rp & 0x03}
+
+		// LBA data size is reported as a power of two, and is not valid if less than 9 (512 bytes)
+		if f.Ds >= 9 {
+			lbaf.DataSize = 1 << f.Ds
+		}
+
+		ns.LBAFormats = append(ns.LBAFormats, lbaf)
+	}
+
+	return ns, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvme
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeIdentifyController(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := make([]byte, NVME_IDENTIFY_LEN)
+	binary.LittleEndian.PutUint16(buf[0:], 0x144d)
+	copy(buf[4:], "S4EWNX0R123456      ")
+	copy(buf[24:], "Samsung SSD 970 EVO Plus 1TB            ")
+	copy(buf[64:], "2B2QEXM7")
+	copy(buf[73:], []byte{0x38, 0x25, 0x00})
+	buf[77] = 9                                      // MDTS
+	binary.LittleEndian.PutUint32(buf[80:], 0x10300) // Version 1.3
+	buf[263] = 0x03                                  // NPSS, i.e. 4 power states
+	binary.LittleEndian.PutUint64(buf[280:], 1000204886016)
+	binary.LittleEndian.PutUint32(buf[516:], 1)       // NN
+	binary.LittleEndian.PutUint16(buf[2048:], 753)    // PS0 max power
+	binary.LittleEndian.PutUint16(buf[2048+3*32:], 3) // PS3 max power
+	buf[2048+3*32+3] = 0x02                           // PS3 non-operational
+
+	c, err := DecodeIdentifyController(buf)
+	assert.NoError(err)
+	assert.Equal(uint16(0x144d), c.VendorID)
+	assert.Equal("S4EWNX0R123456", c.SerialNumber)
+	assert.Equal("Samsung SSD 970 EVO Plus 1TB", c.ModelNumber)
+	assert.Equal("2B2QEXM7", c.FirmwareVersion)
+	assert.Equal(uint32(0x002538), c.OUI)
+	assert.Equal(uint(512), c.MaxDataXferSize)
+	assert.Equal("1.3", c.VersionString())
+	assert.Equal(uint32(1), c.NumNamespaces)
+	assert.Equal(int64(1000204886016), c.TotalCapacity.Int64())
+	assert.Len(c.PowerStates, 4)
+	assert.Equal(uint16(753), c.PowerStates[0].MaxPower)
+	assert.True(c.PowerStates[3].NonOperating)
+
+	// Invalid number of power states
+	buf[263] = 0xff
+	c, err = DecodeIdentifyController(buf)
+	assert.NoError(err)
+	assert.Len(c.PowerStates, 32)
+
+	_, err = DecodeIdentifyController(buf[:512])
+	assert.Error(err)
+}
+
+func TestDecodeIdentifyNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := make([]byte, NVME_IDENTIFY_LEN)
+	binary.LittleEndian.PutUint64(buf[0:], 1953525168)
+	binary.LittleEndian.PutUint64(buf[8:], 1953525168)
+	binary.LittleEndian.PutUint64(buf[16:], 123456789)
+	buf[25] = 1 // NLBAF, i.e. 2 LBA formats
+	buf[26] = 1 // FLBAS
+	buf[128+2] = 9
+	buf[128+4+2] = 12
+
+	ns, err := DecodeIdentifyNamespace(1, buf)
+	assert.NoError(err)
+	assert.Equal(uint64(1953525168), ns.Size)
+	assert.Equal(uint64(123456789), ns.Utilization)
+	assert.Len(ns.LBAFormats, 2)
+	assert.Equal(uint32(512), ns.LBAFormats[0].DataSize)
+	assert.Equal(uint32(4096), ns.LBASize())
+}
@@ -12,44 +12,153 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// DEPRECATED - use github.com/dswarbrick/go-nvme/nvme directly.
+// NVMe admin command pass-through functions.
 
 package nvme
 
 import (
+	"fmt"
 	"io"
+	"unsafe"
 
-	"github.com/dswarbrick/smart/drivedb"
+	"golang.org/x/sys/unix"
 
-	"github.com/dswarbrick/go-nvme/nvme"
+	"github.com/dswarbrick/smart/drivedb"
+	"github.com/dswarbrick/smart/ioctl"
 )
 
+// adminIoctl executes the NVME_IOCTL_ADMIN_CMD ioctl, and returns the NVMe status of the command.
+// Replaced by tests.
+var adminIoctl = func(fd int, cmd *nvmePassthruCommand) (uintptr, error) {
+	return ioctl.IoctlResult(uintptr(fd), NVME_IOCTL_ADMIN_CMD, uintptr(unsafe.Pointer(cmd)))
+}
+
 type NVMeDevice struct {
-	Name  string
-	_nvme nvme.NVMeDevice
+	Name string
+	fd   int
 }
 
 func NewNVMeDevice(name string) *NVMeDevice {
-	return &NVMeDevice{name, *nvme.NewNVMeDevice(name)}
+	return &NVMeDevice{name, -1}
 }
 
 func (d *NVMeDevice) Open() (err error) {
-	return d._nvme.Open()
+	d.fd, err = unix.Open(d.Name, unix.O_RDWR, 0600)
+	return err
 }
 
 func (d *NVMeDevice) Close() error {
-	return d._nvme.Close()
+	return unix.Close(d.fd)
+}
+
+// adminCmd executes an NVMe admin command via the NVME_IOCTL_ADMIN_CMD ioctl. If buf is not empty,
+// it is used as the data buffer of the command, whose contents are only valid if no error is
+// returned.
+func (d *NVMeDevice) adminCmd(cmd *nvmePassthruCommand, buf []byte) error {
+	if len(buf) > 0 {
+		cmd.addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		cmd.data_len = uint32(len(buf))
+	}
+
+	if cmd.timeout_ms == 0 {
+		cmd.timeout_ms = DEFAULT_TIMEOUT
+	}
+
+	// The ioctl succeeds if the command was submitted, but returns a non-zero NVMe status (without
+	// setting errno) if the controller failed the command.
+	status, err := adminIoctl(d.fd, cmd)
+	if err != nil {
+		return err
+	}
+
+	if status != 0 {
+		return fmt.Errorf("NVMe status %#x", status)
+	}
+
+	return nil
+}
+
+// identify sends an NVMe Identify command with the specified CNS value.
+func (d *NVMeDevice) identify(cns uint8, nsid uint32) ([]byte, error) {
+	buf := make([]byte, NVME_IDENTIFY_LEN)
+
+	cmd := nvmePassthruCommand{
+		opcode: NVME_ADMIN_IDENTIFY,
+		nsid:   nsid,
+		cdw10:  uint32(cns),
+	}
+
+	if err := d.adminCmd(&cmd, buf); err != nil {
+		return nil, fmt.Errorf("NVMe IDENTIFY (CNS %#02x): %v", cns, err)
+	}
+
+	return buf, nil
+}
+
+// IdentifyController returns the Identify Controller data of the device.
+func (d *NVMeDevice) IdentifyController() (NVMeController, error) {
+	// Namespace 0, since we are identifying the controller
+	buf, err := d.identify(NVME_IDENTIFY_CNS_CONTROLLER, 0)
+	if err != nil {
+		return NVMeController{}, err
+	}
+
+	return DecodeIdentifyController(buf)
+}
+
+// IdentifyNamespace returns the Identify Namespace data of the specified namespace.
+func (d *NVMeDevice) IdentifyNamespace(nsid uint32) (NVMeNamespace, error) {
+	buf, err := d.identify(NVME_IDENTIFY_CNS_NAMESPACE, nsid)
+	if err != nil {
+		return NVMeNamespace{}, err
+	}
+
+	return DecodeIdentifyNamespace(nsid, buf)
+}
+
+// GetLogPage reads the specified log page into buf, whose length must be a non-zero multiple of 4
+// bytes. Use NVME_NSID_ALL for log pages which are not namespace specific.
+func (d *NVMeDevice) GetLogPage(logID uint8, nsid uint32, buf []byte) error {
+	if len(buf) < 4 || len(buf)%4 != 0 {
+		return fmt.Errorf("NVMe GET LOG PAGE: invalid buffer size %d", len(buf))
+	}
+
+	// Number of dwords is zero-based, and split into lower (NUMDL) and upper (NUMDU) 16 bits
+	numd := uint32(len(buf)/4 - 1)
+
+	cmd := nvmePassthruCommand{
+		opcode: NVME_ADMIN_GET_LOG_PAGE,
+		nsid:   nsid,
+		cdw10:  uint32(logID) | (numd&0xffff)<<16,
+		cdw11:  numd >> 16,
+	}
+
+	if err := d.adminCmd(&cmd, buf); err != nil {
+		return fmt.Errorf("NVMe GET LOG PAGE (%#02x): %v", logID, err)
+	}
+
+	return nil
 }
 
-// WIP - need to split out functionality further.
 func (d *NVMeDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
-	if _, err := d._nvme.IdentifyController(w); err != nil {
+	controller, err := d.IdentifyController()
+	if err != nil {
 		return err
 	}
 
-	if err := d._nvme.IdentifyNamespace(w, 1); err != nil {
+	controller.Print(w)
+
+	if ns, err := d.IdentifyNamespace(1); err == nil {
+		fmt.Fprintln(w)
+		ns.Print(w)
+	}
+
+	sl, err := d.SMARTLog()
+	if err != nil {
 		return err
 	}
 
-	return d._nvme.PrintSMART(w)
+	sl.Print(w)
+
+	return nil
 }
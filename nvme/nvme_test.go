@@ -0,0 +1,48 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvme
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAdminIoctl replaces the NVME_IOCTL_ADMIN_CMD ioctl with one which completes every command
+// with the specified NVMe status, without transferring any data.
+func fakeAdminIoctl(t *testing.T, status uintptr) {
+	orig := adminIoctl
+	adminIoctl = func(fd int, cmd *nvmePassthruCommand) (uintptr, error) {
+		return status, nil
+	}
+	t.Cleanup(func() { adminIoctl = orig })
+}
+
+func TestAdminCmdStatus(t *testing.T) {
+	assert := assert.New(t)
+	d := NewNVMeDevice("/dev/nvme0")
+
+	fakeAdminIoctl(t, 0)
+	assert.NoError(d.GetLogPage(NVME_LOG_SMART, NVME_NSID_ALL, make([]byte, NVME_SMART_LOG_LEN)))
+
+	// Invalid field in command
+	fakeAdminIoctl(t, 0x4002)
+
+	_, err := d.IdentifyController()
+	assert.EqualError(err, "NVMe IDENTIFY (CNS 0x01): NVMe status 0x4002")
+
+	err = d.GetLogPage(NVME_LOG_SMART, NVME_NSID_ALL, make([]byte, NVME_SMART_LOG_LEN))
+	assert.EqualError(err, "NVMe GET LOG PAGE (0x02): NVMe status 0x4002")
+}
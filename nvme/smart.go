@@ -0,0 +1,261 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// NVMe SMART / Health Information log page.
+
+package nvme
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/dswarbrick/smart/utils"
+)
+
+const (
+	// Length of the SMART / Health Information log page
+	NVME_SMART_LOG_LEN = 512
+
+	// Critical warning bits
+	CRIT_WARN_SPARE           = 0x01 // Available spare below threshold
+	CRIT_WARN_TEMPERATURE     = 0x02 // Temperature above or below threshold
+	CRIT_WARN_RELIABILITY     = 0x04 // Reliability degraded due to media or internal errors
+	CRIT_WARN_READ_ONLY       = 0x08 // Media placed in read-only mode
+	CRIT_WARN_VOLATILE_BACKUP = 0x10 // Volatile memory backup device failed
+	CRIT_WARN_PMR_READ_ONLY   = 0x20 // Persistent memory region placed in read-only mode
+
+	// Size of a data unit, as reported by the data units read / written counters
+	dataUnitSize = 512 * 1000
+)
+
+type nvmeSMARTLog struct {
+	CritWarning      uint8
+	Temperature      uint16
+	AvailSpare       uint8
+	SpareThresh      uint8
+	PercentUsed      uint8
+	Rsvd6            [26]byte
+	DataUnitsRead    [16]byte
+	DataUnitsWritten [16]byte
+	HostReads        [16]byte
+	HostWrites       [16]byte
+	CtrlBusyTime     [16]byte
+	PowerCycles      [16]byte
+	PowerOnHours     [16]byte
+	UnsafeShutdowns  [16]byte
+	MediaErrors      [16]byte
+	NumErrLogEntries [16]byte
+	WarningTempTime  uint32
+	CritCompTime     uint32
+	TempSensor       [8]uint16
+	Rsvd216          [296]byte
+} // 512 bytes
+
+// CriticalWarning is the critical warning field of the SMART / Health Information log page.
+type CriticalWarning uint8
+
+var critWarningDescriptions = []struct {
+	bit  CriticalWarning
+	desc string
+}{
+	{CRIT_WARN_SPARE, "available spare below threshold"},
+	{CRIT_WARN_TEMPERATURE, "temperature threshold exceeded"},
+	{CRIT_WARN_RELIABILITY, "reliability degraded"},
+	{CRIT_WARN_READ_ONLY, "media in read-only mode"},
+	{CRIT_WARN_VOLATILE_BACKUP, "volatile memory backup failed"},
+	{CRIT_WARN_PMR_READ_ONLY, "persistent memory region in read-only mode"},
+}
+
+func (cw CriticalWarning) Spare() bool {
+	return cw&CRIT_WARN_SPARE != 0
+}
+
+func (cw CriticalWarning) Temperature() bool {
+	return cw&CRIT_WARN_TEMPERATURE != 0
+}
+
+func (cw CriticalWarning) Reliability() bool {
+	return cw&CRIT_WARN_RELIABILITY != 0
+}
+
+func (cw CriticalWarning) ReadOnly() bool {
+	return cw&CRIT_WARN_READ_ONLY != 0
+}
+
+func (cw CriticalWarning) VolatileBackup() bool {
+	return cw&CRIT_WARN_VOLATILE_BACKUP != 0
+}
+
+func (cw CriticalWarning) PMRReadOnly() bool {
+	return cw&CRIT_WARN_PMR_READ_ONLY != 0
+}
+
+// Strings returns descriptions of the critical warning bits which are set.
+func (cw CriticalWarning) Strings() []string {
+	var s []string
+
+	for _, d := range critWarningDescriptions {
+		if cw&d.bit != 0 {
+			s = append(s, d.desc)
+		}
+	}
+
+	return s
+}
+
+// SMARTLog is the decoded SMART / Health Information log page (02h). Temperatures are in Kelvin,
+// with 0 meaning not reported. 128-bit counters are represented as *big.Int.
+type SMARTLog struct {
+	CriticalWarning  CriticalWarning
+	Temperature      uint16 // Composite temperature
+	AvailableSpare   uint8  // Percent
+	SpareThreshold   uint8  // Percent
+	PercentageUsed   uint8  // May exceed 100
+	DataUnitsRead    *big.Int
+	DataUnitsWritten *big.Int
+	HostReads        *big.Int // Host read commands
+	HostWrites       *big.Int // Host write commands
+	ControllerBusy   *big.Int // Controller busy time, in minutes
+	PowerCycles      *big.Int
+	PowerOnHours     *big.Int
+	UnsafeShutdowns  *big.Int
+	MediaErrors      *big.Int // Media and data integrity errors
+	ErrorLogEntries  *big.Int // Number of error information log entries
+	WarningTempTime  uint32   // Minutes above the warning composite temperature threshold
+	CriticalTempTime uint32   // Minutes above the critical composite temperature threshold
+	TempSensors      [8]uint16
+}
+
+// DecodeSMARTLog decodes the SMART / Health Information log page (02h).
+func DecodeSMARTLog(buf []byte) (SMARTLog, error) {
+	var sl nvmeSMARTLog
+
+	if len(buf) < NVME_SMART_LOG_LEN {
+		return SMARTLog{}, fmt.Errorf("SMART log: short log page (%d bytes)", len(buf))
+	}
+
+	binary.Read(bytes.NewBuffer(buf), binary.LittleEndian, &sl)
+
+	return SMARTLog{
+		CriticalWarning:  CriticalWarning(sl.CritWarning),
+		Temperature:      sl.Temperature,
+		AvailableSpare:   sl.AvailSpare,
+		SpareThreshold:   sl.SpareThresh,
+		PercentageUsed:   sl.PercentUsed,
+		DataUnitsRead:    le128ToBigInt(sl.DataUnitsRead),
+		DataUnitsWritten: le128ToBigInt(sl.DataUnitsWritten),
+		HostReads:        le128ToBigInt(sl.HostReads),
+		HostWrites:       le128ToBigInt(sl.HostWrites),
+		ControllerBusy:   le128ToBigInt(sl.CtrlBusyTime),
+		PowerCycles:      le128ToBigInt(sl.PowerCycles),
+		PowerOnHours:     le128ToBigInt(sl.PowerOnHours),
+		UnsafeShutdowns:  le128ToBigInt(sl.UnsafeShutdowns),
+		MediaErrors:      le128ToBigInt(sl.MediaErrors),
+		ErrorLogEntries:  le128ToBigInt(sl.NumErrLogEntries),
+		WarningTempTime:  sl.WarningTempTime,
+		CriticalTempTime: sl.CritCompTime,
+		TempSensors:      sl.TempSensor,
+	}, nil
+}
+
+// kelvinToCelsius converts a temperature in Kelvin to degrees Celsius.
+func kelvinToCelsius(k uint16) int {
+	return int(k) - 273
+}
+
+// Health returns the health verdict of the device, based on the critical warning bits. Spare and
+// temperature warnings leave the device operational, whereas the remaining bits indicate failure.
+func (sl SMARTLog) Health() utils.Health {
+	h := utils.Health{Status: utils.HealthPassed, Temperature: -1}
+
+	if sl.Temperature != 0 {
+		h.Temperature = kelvinToCelsius(sl.Temperature)
+	}
+
+	if sl.CriticalWarning == 0 {
+		return h
+	}
+
+	if sl.CriticalWarning&^(CRIT_WARN_SPARE|CRIT_WARN_TEMPERATURE) != 0 {
+		h.Status = utils.HealthFailed
+	} else {
+		h.Status = utils.HealthWarning
+	}
+
+	h.Reason = strings.Join(sl.CriticalWarning.Strings(), ", ")
+
+	return h
+}
+
+func (sl SMARTLog) Print(w io.Writer) {
+	unit := big.NewInt(dataUnitSize)
+
+	fmt.Fprintln(w, "\nSMART data follows:")
+	fmt.Fprintf(w, "Critical warning: %#02x\n", uint8(sl.CriticalWarning))
+	fmt.Fprintf(w, "SMART Health Status: %s\n", sl.Health())
+
+	if sl.Temperature != 0 {
+		fmt.Fprintf(w, "Temperature: %d° Celsius\n", kelvinToCelsius(sl.Temperature))
+	}
+
+	fmt.Fprintf(w, "Avail. spare: %d%%\n", sl.AvailableSpare)
+	fmt.Fprintf(w, "Avail. spare threshold: %d%%\n", sl.SpareThreshold)
+	fmt.Fprintf(w, "Percentage used: %d%%\n", sl.PercentageUsed)
+	fmt.Fprintf(w, "Data units read: %d [%s]\n",
+		sl.DataUnitsRead, utils.FormatBigBytes(new(big.Int).Mul(sl.DataUnitsRead, unit)))
+	fmt.Fprintf(w, "Data units written: %d [%s]\n",
+		sl.DataUnitsWritten, utils.FormatBigBytes(new(big.Int).Mul(sl.DataUnitsWritten, unit)))
+	fmt.Fprintf(w, "Host read commands: %d\n", sl.HostReads)
+	fmt.Fprintf(w, "Host write commands: %d\n", sl.HostWrites)
+	fmt.Fprintf(w, "Controller busy time: %d\n", sl.ControllerBusy)
+	fmt.Fprintf(w, "Power cycles: %d\n", sl.PowerCycles)
+	fmt.Fprintf(w, "Power on hours: %d\n", sl.PowerOnHours)
+	fmt.Fprintf(w, "Unsafe shutdowns: %d\n", sl.UnsafeShutdowns)
+	fmt.Fprintf(w, "Media & data integrity errors: %d\n", sl.MediaErrors)
+	fmt.Fprintf(w, "Error information log entries: %d\n", sl.ErrorLogEntries)
+	fmt.Fprintf(w, "Warning comp. temperature time: %d minutes\n", sl.WarningTempTime)
+	fmt.Fprintf(w, "Critical comp. temperature time: %d minutes\n", sl.CriticalTempTime)
+
+	for i, t := range sl.TempSensors {
+		if t != 0 {
+			fmt.Fprintf(w, "Temperature sensor %d: %d° Celsius\n", i+1, kelvinToCelsius(t))
+		}
+	}
+}
+
+// SMARTLog reads the SMART / Health Information log page of the controller.
+func (d *NVMeDevice) SMARTLog() (SMARTLog, error) {
+	buf := make([]byte, NVME_SMART_LOG_LEN)
+
+	if err := d.GetLogPage(NVME_LOG_SMART, NVME_NSID_ALL, buf); err != nil {
+		return SMARTLog{}, err
+	}
+
+	return DecodeSMARTLog(buf)
+}
+
+// Health returns the health verdict of the device, based on the SMART / Health Information log
+// page.
+func (d *NVMeDevice) Health() (utils.Health, error) {
+	sl, err := d.SMARTLog()
+	if err != nil {
+		return utils.Health{Status: utils.HealthUnknown, Temperature: -1}, err
+	}
+
+	return sl.Health(), nil
+}
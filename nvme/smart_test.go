@@ -0,0 +1,97 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvme
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/utils"
+)
+
+func TestDecodeSMARTLog(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := make([]byte, NVME_SMART_LOG_LEN)
+	binary.LittleEndian.PutUint16(buf[1:], 310) // 37° Celsius
+	buf[3] = 100
+	buf[4] = 10
+	buf[5] = 3
+	binary.LittleEndian.PutUint64(buf[32:], 0xffffffffffffffff) // Data units read, exceeding 64 bits
+	buf[40] = 0x01
+	binary.LittleEndian.PutUint64(buf[128:], 12345) // Power on hours
+	binary.LittleEndian.PutUint64(buf[160:], 2)     // Media errors
+	binary.LittleEndian.PutUint32(buf[192:], 42)    // Warning temperature time
+	binary.LittleEndian.PutUint16(buf[200:], 318)   // Temperature sensor 1
+
+	sl, err := DecodeSMARTLog(buf)
+	assert.NoError(err)
+	assert.Equal(uint16(310), sl.Temperature)
+	assert.Equal(uint8(100), sl.AvailableSpare)
+	assert.Equal(uint8(3), sl.PercentageUsed)
+	assert.Equal("36893488147419103231", sl.DataUnitsRead.String())
+	assert.Equal(int64(12345), sl.PowerOnHours.Int64())
+	assert.Equal(int64(2), sl.MediaErrors.Int64())
+	assert.Equal(uint32(42), sl.WarningTempTime)
+	assert.Equal(uint16(318), sl.TempSensors[0])
+
+	h := sl.Health()
+	assert.Equal(utils.HealthPassed, h.Status)
+	assert.Equal(37, h.Temperature)
+
+	var out bytes.Buffer
+	sl.Print(&out)
+	assert.Contains(out.String(), "Temperature: 37° Celsius\n")
+
+	// Composite temperature not reported
+	sl.Temperature = 0
+	out.Reset()
+	sl.Print(&out)
+	assert.NotContains(out.String(), "Temperature: ")
+
+	_, err = DecodeSMARTLog(buf[:256])
+	assert.Error(err)
+}
+
+func TestCriticalWarningHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	sl := SMARTLog{CriticalWarning: CRIT_WARN_SPARE | CRIT_WARN_TEMPERATURE}
+	assert.True(sl.CriticalWarning.Spare())
+	assert.False(sl.CriticalWarning.ReadOnly())
+	assert.Equal(utils.HealthWarning, sl.Health().Status)
+	assert.Equal("WARNING (available spare below threshold, temperature threshold exceeded)",
+		sl.Health().String())
+
+	sl.CriticalWarning = CRIT_WARN_READ_ONLY | CRIT_WARN_PMR_READ_ONLY
+	assert.True(sl.CriticalWarning.PMRReadOnly())
+	assert.Equal(utils.HealthFailed, sl.Health().Status)
+	assert.Equal(-1, sl.Health().Temperature)
+}
+
+func TestHealthCommandFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	// Get Log Page fails, so the buffer is never filled
+	fakeAdminIoctl(t, 0x4002)
+
+	h, err := NewNVMeDevice("/dev/nvme0").Health()
+	assert.Error(err)
+	assert.Equal(utils.HealthUnknown, h.Status)
+	assert.Equal(-1, h.Temperature)
+}
@@ -0,0 +1,279 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI background scan results and pending defects log pages.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// Background scan results log page code and subpage codes
+	LOG_BACKGROUND_SCAN              = 0x15
+	LOG_SUBPAGE_PENDING_DEFECTS      = 0x01
+	MPAGE_SUBPAGE_BACKGROUND_CONTROL = 0x01
+)
+
+const (
+	// Background scan status parameter and medium scan parameter lengths
+	bgScanStatusParamLen = 12
+	bgScanMediumParamLen = 20
+
+	// Pending defect parameter length
+	pendingDefectParamLen = 12
+)
+
+var bgScanStatusNames = []string{
+	"no scans active",
+	"scan is active",
+	"pre-scan is active",
+	"halted due to fatal error",
+	"halted due to a vendor specific pattern of error",
+	"halted due to medium formatted without P-List",
+	"halted - vendor specific cause",
+	"halted due to temperature out of range",
+	"waiting until BMS interval timer expires",
+}
+
+var reassignStatusNames = []string{
+	"Reserved [0x0]",
+	"Require Write or Reassign Blocks command",
+	"Successfully reassigned",
+	"Reserved [0x3]",
+	"Reassignment by disk failed",
+	"Recovered via rewrite in-place",
+	"Reassigned by app, has valid data",
+	"Reassigned by app, has no valid data",
+	"Unsuccessfully reassigned by app",
+}
+
+// MediumScanEntry is a medium scan parameter of the background scan results log page (15h),
+// describing a medium error found by a background scan.
+type MediumScanEntry struct {
+	PowerOnMinutes uint32 // Accumulated power-on minutes when the error was found
+	ReassignStatus uint8
+	SenseKey       uint8
+	ASC            uint8
+	ASCQ           uint8
+	LBA            uint64
+}
+
+// BackgroundScan is the decoded background scan results log page (15h).
+type BackgroundScan struct {
+	PowerOnMinutes    uint32 // Accumulated power-on minutes
+	Status            uint8
+	ScansPerformed    uint16 // Number of background scans performed
+	ScanProgress      float64
+	MediumScans       uint16 // Number of background medium scans performed
+	MediumScanEntries []MediumScanEntry
+}
+
+// StatusString returns a description of the background scan status.
+func (bs BackgroundScan) StatusString() string {
+	if int(bs.Status) < len(bgScanStatusNames) {
+		return bgScanStatusNames[bs.Status]
+	}
+
+	return fmt.Sprintf("reserved [0x%x]", bs.Status)
+}
+
+// DecodeBackgroundScan decodes the background scan results log page (15h).
+func DecodeBackgroundScan(lp LogPage) (BackgroundScan, error) {
+	var bs BackgroundScan
+
+	if lp.LogPageID != (LogPageID{LOG_BACKGROUND_SCAN, LOG_SUBPAGE_NONE}) {
+		return bs, fmt.Errorf("log page %s: not a background scan results page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		v := p.Value
+
+		switch {
+		case p.Code == 0x0000:
+			if len(v) < bgScanStatusParamLen {
+				return bs, fmt.Errorf("log page %s: short background scan status parameter", lp.LogPageID)
+			}
+
+			bs.PowerOnMinutes = binary.BigEndian.Uint32(v)
+			bs.Status = v[5]
+			bs.ScansPerformed = binary.BigEndian.Uint16(v[6:])
+			bs.ScanProgress = float64(binary.BigEndian.Uint16(v[8:])) * 100 / 65536
+			bs.MediumScans = binary.BigEndian.Uint16(v[10:])
+		case p.Code >= 0x0001 && p.Code <= 0x0800 && len(v) >= bgScanMediumParamLen:
+			bs.MediumScanEntries = append(bs.MediumScanEntries, MediumScanEntry{
+				PowerOnMinutes: binary.BigEndian.Uint32(v),
+				ReassignStatus: v[4] >> 4,
+				SenseKey:       v[4] & 0x0f,
+				ASC:            v[5],
+				ASCQ:           v[6],
+				LBA:            binary.BigEndian.Uint64(v[12:]),
+			})
+		}
+	}
+
+	return bs, nil
+}
+
+func (bs BackgroundScan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Status: %s\n", bs.StatusString())
+	fmt.Fprintf(w, "Accumulated power on time, hours:minutes %d:%02d [%d minutes]\n", bs.PowerOnMinutes/60,
+		bs.PowerOnMinutes%60, bs.PowerOnMinutes)
+	fmt.Fprintf(w, "Number of background scans performed: %d,  scan progress: %.2f%%\n", bs.ScansPerformed,
+		bs.ScanProgress)
+	fmt.Fprintf(w, "Number of background medium scans performed: %d\n", bs.MediumScans)
+
+	if len(bs.MediumScanEntries) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\n#  when        lba(hex)    [sk,asc,ascq]    reassign_status")
+
+	for i, e := range bs.MediumScanEntries {
+		status := fmt.Sprintf("Reserved [0x%x]", e.ReassignStatus)
+		if int(e.ReassignStatus) < len(reassignStatusNames) {
+			status = reassignStatusNames[e.ReassignStatus]
+		}
+
+		fmt.Fprintf(w, "%2d %5d:%02d  %016x  [%x,%x,%x]  %s\n", i+1, e.PowerOnMinutes/60, e.PowerOnMinutes%60,
+			e.LBA, e.SenseKey, e.ASC, e.ASCQ, status)
+	}
+}
+
+// PendingDefect is an LBA which the device has been unable to read, and which is pending
+// reassignment.
+type PendingDefect struct {
+	PowerOnHours uint32 // Accumulated power-on hours when the defect was detected
+	LBA          uint64
+}
+
+// PendingDefects is the decoded pending defects log page (15h/01h).
+type PendingDefects struct {
+	Count   uint32 // Number of pending defects reported by the device
+	Defects []PendingDefect
+}
+
+// DecodePendingDefects decodes the pending defects log page (15h/01h).
+func DecodePendingDefects(lp LogPage) (PendingDefects, error) {
+	var pd PendingDefects
+
+	if lp.LogPageID != (LogPageID{LOG_BACKGROUND_SCAN, LOG_SUBPAGE_PENDING_DEFECTS}) {
+		return pd, fmt.Errorf("log page %s: not a pending defects page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		switch {
+		case p.Code == 0x0000:
+			pd.Count = uint32(p.Uint64())
+		case p.Code >= 0x0001 && p.Code <= 0xf000 && len(p.Value) >= pendingDefectParamLen:
+			pd.Defects = append(pd.Defects, PendingDefect{
+				PowerOnHours: binary.BigEndian.Uint32(p.Value),
+				LBA:          binary.BigEndian.Uint64(p.Value[4:]),
+			})
+		}
+	}
+
+	return pd, nil
+}
+
+func (pd PendingDefects) Print(w io.Writer) {
+	fmt.Fprintf(w, "Pending defect count: %d\n", pd.Count)
+
+	for i, d := range pd.Defects {
+		fmt.Fprintf(w, "%4d:  0x%-16x  %5d\n", i+1, d.LBA, d.PowerOnHours)
+	}
+}
+
+// BackgroundControlModePage is the decoded Background Control mode page (1Ch/01h).
+type BackgroundControlModePage struct {
+	SLFull           bool   // Suspend on log full
+	LOWIR            bool   // Log only when intervention required
+	EnableBMS        bool   // Enable background medium scan
+	EnablePS         bool   // Enable pre-scan
+	BMSInterval      uint16 // Background medium scan interval time, in hours
+	PreScanTimeLimit uint16 // Background pre-scan time limit, in hours
+	MinIdleTime      uint16 // Minimum idle time before background scan, in ms
+	MaxSuspendTime   uint16 // Maximum time to suspend background scan, in ms
+}
+
+// DecodeBackgroundControlModePage decodes the Background Control mode page (1Ch/01h).
+func DecodeBackgroundControlModePage(page []byte) (BackgroundControlModePage, error) {
+	var bc BackgroundControlModePage
+
+	if len(page) < 14 {
+		return bc, fmt.Errorf("mode page %02xh/%02xh: short page (%d bytes)", INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE,
+			MPAGE_SUBPAGE_BACKGROUND_CONTROL, len(page))
+	}
+
+	if page[0]&0x3f != INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE || page[0]&0x40 == 0 ||
+		page[1] != MPAGE_SUBPAGE_BACKGROUND_CONTROL {
+		return bc, fmt.Errorf("mode page %02xh/%02xh: not a background control page", page[0]&0x3f, page[1])
+	}
+
+	bc.SLFull = page[4]&0x04 != 0
+	bc.LOWIR = page[4]&0x02 != 0
+	bc.EnableBMS = page[4]&0x01 != 0
+	bc.EnablePS = page[5]&0x01 != 0
+	bc.BMSInterval = binary.BigEndian.Uint16(page[6:])
+	bc.PreScanTimeLimit = binary.BigEndian.Uint16(page[8:])
+	bc.MinIdleTime = binary.BigEndian.Uint16(page[10:])
+	bc.MaxSuspendTime = binary.BigEndian.Uint16(page[12:])
+
+	return bc, nil
+}
+
+// BackgroundScan reads the background scan results of the device.
+func (d *SCSIDevice) BackgroundScan() (BackgroundScan, error) {
+	lp, err := d.LogPage(LOG_BACKGROUND_SCAN, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return BackgroundScan{}, err
+	}
+
+	return DecodeBackgroundScan(lp)
+}
+
+// PendingDefects reads the pending defects of the device.
+func (d *SCSIDevice) PendingDefects() (PendingDefects, error) {
+	lp, err := d.LogPage(LOG_BACKGROUND_SCAN, LOG_SUBPAGE_PENDING_DEFECTS)
+	if err != nil {
+		return PendingDefects{}, err
+	}
+
+	return DecodePendingDefects(lp)
+}
+
+// BackgroundControlModePage reads the current Background Control mode page settings.
+func (d *SCSIDevice) BackgroundControlModePage() (BackgroundControlModePage, error) {
+	page, err := d.ModePage(INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE, MPAGE_SUBPAGE_BACKGROUND_CONTROL,
+		MPAGE_CONTROL_CURRENT)
+	if err != nil {
+		return BackgroundControlModePage{}, err
+	}
+
+	return DecodeBackgroundControlModePage(page)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_BACKGROUND_SCAN, LOG_SUBPAGE_NONE, "Background scan results",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeBackgroundScan(lp)
+		})
+	RegisterLogPageDecoder(LOG_BACKGROUND_SCAN, LOG_SUBPAGE_PENDING_DEFECTS, "Pending defects",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodePendingDefects(lp)
+		})
+}
@@ -0,0 +1,65 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBackgroundScan(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{
+		LOG_BACKGROUND_SCAN, 0x00, 0x00, 0x28,
+		// Background scan status: 90 minutes, scan active, 3 scans, 25% progress, 2 medium scans
+		0x00, 0x00, 0x03, 0x0c, 0x00, 0x00, 0x00, 0x5a, 0x00, 0x01, 0x00, 0x03, 0x40, 0x00, 0x00, 0x02,
+		// Medium scan parameter: reassign status 2, MEDIUM ERROR, unrecovered read error
+		0x00, 0x01, 0x03, 0x14, 0x00, 0x00, 0x00, 0x3c, 0x23, 0x11, 0x00, 0, 0, 0, 0, 0,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56,
+	}
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	bs, err := DecodeBackgroundScan(lp)
+	assert.NoError(err)
+	assert.Equal(uint32(90), bs.PowerOnMinutes)
+	assert.Equal("scan is active", bs.StatusString())
+	assert.Equal(uint16(3), bs.ScansPerformed)
+	assert.Equal(25.0, bs.ScanProgress)
+	assert.Equal(uint16(2), bs.MediumScans)
+	assert.Equal([]MediumScanEntry{{PowerOnMinutes: 60, ReassignStatus: 2, SenseKey: SENSE_KEY_MEDIUM_ERROR,
+		ASC: 0x11, LBA: 0x123456}}, bs.MediumScanEntries)
+}
+
+func TestDecodePendingDefects(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{
+		LOG_BACKGROUND_SCAN | 0x40, LOG_SUBPAGE_PENDING_DEFECTS, 0x00, 0x18,
+		0x00, 0x00, 0x03, 0x04, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x01, 0x03, 0x0c, 0x00, 0x00, 0x01, 0x00, 0, 0, 0, 0, 0x00, 0x00, 0xab, 0xcd,
+	}
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	pd, err := DecodePendingDefects(lp)
+	assert.NoError(err)
+	assert.Equal(uint32(1), pd.Count)
+	assert.Equal([]PendingDefect{{PowerOnHours: 0x100, LBA: 0xabcd}}, pd.Defects)
+}
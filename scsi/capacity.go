@@ -0,0 +1,183 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI READ CAPACITY functions.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dswarbrick/smart/utils"
+)
+
+const (
+	// Length of READ CAPACITY(10) / READ CAPACITY(16) responses
+	READ_CAPACITY_10_LEN = 8
+	READ_CAPACITY_16_LEN = 32
+
+	// READ CAPACITY(10) returns this last LBA if the capacity exceeds 32 bit LBAs
+	READ_CAPACITY_10_OVERFLOW = 0xffffffff
+)
+
+// Capacity is the decoded response of READ CAPACITY(10) or READ CAPACITY(16). Fields other than
+// LastLBA and LogicalBlockSize are only reported by READ CAPACITY(16).
+type Capacity struct {
+	LastLBA           uint64 // Last addressable LBA
+	LogicalBlockSize  uint32 // In bytes
+	PhysicalExponent  uint8  // Logical blocks per physical block exponent
+	LowestAlignedLBA  uint16
+	ProtectionEnabled bool  // PROT_EN
+	ProtectionType    uint8 // Protection type (1-3), or 0 if protection is not enabled
+	PIExponent        uint8 // Protection information intervals exponent
+	LBPME             bool  // Logical block provisioning management enabled
+	LBPRZ             bool  // Logical block provisioning read zeros
+}
+
+// Bytes returns the capacity in bytes.
+func (c Capacity) Bytes() uint64 {
+	return (c.LastLBA + 1) * uint64(c.LogicalBlockSize)
+}
+
+// PhysicalBlockSize returns the physical block size in bytes.
+func (c Capacity) PhysicalBlockSize() uint32 {
+	return c.LogicalBlockSize << c.PhysicalExponent
+}
+
+func (c Capacity) Print(w io.Writer) {
+	capacity := c.Bytes()
+
+	fmt.Fprintf(w, "Capacity: %d bytes (%s)\n", capacity, utils.FormatBytes(capacity))
+
+	fmt.Fprintf(w, "Logical block size: %d bytes\n", c.LogicalBlockSize)
+
+	if c.PhysicalExponent != 0 {
+		fmt.Fprintf(w, "Physical block size: %d bytes\n", c.PhysicalBlockSize())
+		fmt.Fprintf(w, "Lowest aligned LBA: %d\n", c.LowestAlignedLBA)
+	}
+
+	if c.ProtectionEnabled {
+		fmt.Fprintf(w, "Formatted with type %d protection\n", c.ProtectionType)
+	}
+
+	if c.LBPME {
+		lbprz := 0
+		if c.LBPRZ {
+			lbprz = 1
+		}
+		fmt.Fprintf(w, "Logical block provisioning: LBPME=1, LBPRZ=%d\n", lbprz)
+	}
+}
+
+// DecodeReadCapacity10 decodes a READ CAPACITY(10) response.
+func DecodeReadCapacity10(buf []byte) (Capacity, error) {
+	if len(buf) < READ_CAPACITY_10_LEN {
+		return Capacity{}, fmt.Errorf("READ CAPACITY(10): short response (%d bytes)", len(buf))
+	}
+
+	return Capacity{
+		LastLBA:          uint64(binary.BigEndian.Uint32(buf[0:])),
+		LogicalBlockSize: binary.BigEndian.Uint32(buf[4:]),
+	}, nil
+}
+
+// DecodeReadCapacity16 decodes a READ CAPACITY(16) response.
+func DecodeReadCapacity16(buf []byte) (Capacity, error) {
+	var c Capacity
+
+	if len(buf) < 16 {
+		return c, fmt.Errorf("READ CAPACITY(16): short response (%d bytes)", len(buf))
+	}
+
+	c.LastLBA = binary.BigEndian.Uint64(buf[0:])
+	c.LogicalBlockSize = binary.BigEndian.Uint32(buf[8:])
+	c.ProtectionEnabled = buf[12]&0x01 != 0
+	if c.ProtectionEnabled {
+		c.ProtectionType = (buf[12]>>1)&0x07 + 1
+	}
+	c.PIExponent = buf[13] >> 4
+	c.PhysicalExponent = buf[13] & 0x0f
+	c.LBPME = buf[14]&0x80 != 0
+	c.LBPRZ = buf[14]&0x40 != 0
+	c.LowestAlignedLBA = binary.BigEndian.Uint16(buf[14:]) & 0x3fff
+
+	return c, nil
+}
+
+// readCapacity10 sends a SCSI READ CAPACITY(10) command to a device.
+func (d *SCSIDevice) readCapacity10() (Capacity, error) {
+	respBuf := make([]byte, READ_CAPACITY_10_LEN)
+	cdb := CDB10{SCSI_READ_CAPACITY_10}
+
+	if err := d.sendCDB(cdb[:], &respBuf); err != nil {
+		return Capacity{}, err
+	}
+
+	return DecodeReadCapacity10(respBuf)
+}
+
+// readCapacity16 sends a SCSI READ CAPACITY(16) command to a device.
+func (d *SCSIDevice) readCapacity16() (Capacity, error) {
+	respBuf := make([]byte, READ_CAPACITY_16_LEN)
+
+	cdb := CDB16{SCSI_SERVICE_ACTION_IN_16}
+	cdb[1] = SAI_READ_CAPACITY_16
+	binary.BigEndian.PutUint32(cdb[10:], uint32(len(respBuf)))
+
+	if err := d.sendCDB(cdb[:], &respBuf); err != nil {
+		return Capacity{}, err
+	}
+
+	return DecodeReadCapacity16(respBuf)
+}
+
+// ReadCapacity returns the capacity of the device. READ CAPACITY(16) is used if the capacity
+// exceeds the range of READ CAPACITY(10), or if the device supports logical block provisioning or
+// protection information, which READ CAPACITY(10) cannot report.
+func (d *SCSIDevice) ReadCapacity() (Capacity, error) {
+	c, err := d.readCapacity10()
+	if err != nil {
+		return c, fmt.Errorf("READ CAPACITY(10): %v", err)
+	}
+
+	if c.LastLBA != READ_CAPACITY_10_OVERFLOW && !d.wantsReadCapacity16() {
+		return c, nil
+	}
+
+	c16, err := d.readCapacity16()
+	if err != nil {
+		if c.LastLBA == READ_CAPACITY_10_OVERFLOW {
+			return c, fmt.Errorf("READ CAPACITY(16): %v", err)
+		}
+
+		// Device claims support for features reported by READ CAPACITY(16), but does not support it
+		return c, nil
+	}
+
+	return c16, nil
+}
+
+// wantsReadCapacity16 reports whether the device supports features which are only reported by
+// READ CAPACITY(16), i.e. protection information or logical block provisioning.
+func (d *SCSIDevice) wantsReadCapacity16() bool {
+	inq, err := d.inquiry()
+	if err == nil && inq.Protect() {
+		return true
+	}
+
+	_, err = d.LogicalBlockProvisioning()
+	return err == nil
+}
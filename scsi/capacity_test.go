@@ -0,0 +1,54 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeReadCapacity10(t *testing.T) {
+	c, err := DecodeReadCapacity10([]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x02, 0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(READ_CAPACITY_10_OVERFLOW), c.LastLBA)
+	assert.Equal(t, uint32(512), c.LogicalBlockSize)
+
+	_, err = DecodeReadCapacity10([]byte{0x00, 0x00})
+	assert.Error(t, err)
+}
+
+func TestDecodeReadCapacity16(t *testing.T) {
+	// 8 TB disk, 512e (4096 byte physical blocks), type 2 protection, LBPME, LBPRZ
+	buf := make([]byte, READ_CAPACITY_16_LEN)
+	copy(buf, []byte{
+		0x00, 0x00, 0x00, 0x03, 0xa3, 0x81, 0x2a, 0xaf, // last LBA
+		0x00, 0x00, 0x02, 0x00, // logical block size
+		0x03,       // P_TYPE = 1, PROT_EN
+		0x03,       // LOGICAL BLOCKS PER PHYSICAL BLOCK EXPONENT
+		0xc0, 0x00, // LBPME, LBPRZ, lowest aligned LBA
+	})
+
+	c, err := DecodeReadCapacity16(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x3a3812aaf), c.LastLBA)
+	assert.Equal(t, uint64(8001563222016), c.Bytes())
+	assert.Equal(t, uint32(4096), c.PhysicalBlockSize())
+	assert.True(t, c.ProtectionEnabled)
+	assert.Equal(t, uint8(2), c.ProtectionType)
+	assert.True(t, c.LBPME)
+	assert.True(t, c.LBPRZ)
+	assert.Equal(t, uint16(0), c.LowestAlignedLBA)
+}
@@ -22,24 +22,47 @@ import (
 
 const (
 	// SCSI commands used by this package
-	SCSI_INQUIRY          = 0x12
-	SCSI_MODE_SENSE_6     = 0x1a
-	SCSI_READ_CAPACITY_10 = 0x25
-	SCSI_ATA_PASSTHRU_16  = 0x85
+	SCSI_REQUEST_SENSE        = 0x03
+	SCSI_INQUIRY              = 0x12
+	SCSI_MODE_SELECT_6        = 0x15
+	SCSI_MODE_SENSE_6         = 0x1a
+	SCSI_START_STOP_UNIT      = 0x1b
+	SCSI_SEND_DIAGNOSTIC      = 0x1d
+	SCSI_READ_CAPACITY_10     = 0x25
+	SCSI_READ_DEFECT_DATA_10  = 0x37
+	SCSI_LOG_SENSE            = 0x4d
+	SCSI_MODE_SELECT_10       = 0x55
+	SCSI_MODE_SENSE_10        = 0x5a
+	SCSI_ATA_PASSTHRU_16      = 0x85
+	SCSI_SERVICE_ACTION_IN_16 = 0x9e
+	SCSI_READ_DEFECT_DATA_12  = 0xb7
+
+	// SERVICE ACTION IN(16) service actions
+	SAI_READ_CAPACITY_16 = 0x10
 
 	// Minimum length of standard INQUIRY response
 	INQ_REPLY_LEN = 36
 
 	// SCSI-3 mode pages
-	RIGID_DISK_DRIVE_GEOMETRY_PAGE = 0x04
+	READ_WRITE_ERROR_RECOVERY_PAGE        = 0x01
+	RIGID_DISK_DRIVE_GEOMETRY_PAGE        = 0x04
+	CACHING_PAGE                          = 0x08
+	CONTROL_PAGE                          = 0x0a
+	POWER_CONDITION_PAGE                  = 0x1a
+	INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE = 0x1c
+	ALL_MODE_PAGES                        = 0x3f
 
 	// Mode page control field
-	MPAGE_CONTROL_DEFAULT = 2
+	MPAGE_CONTROL_CURRENT    = 0
+	MPAGE_CONTROL_CHANGEABLE = 1
+	MPAGE_CONTROL_DEFAULT    = 2
+	MPAGE_CONTROL_SAVED      = 3
 )
 
 // SCSI CDB types
 type CDB6 [6]byte
 type CDB10 [10]byte
+type CDB12 [12]byte
 type CDB16 [16]byte
 
 // SCSI INQUIRY response
@@ -47,12 +70,19 @@ type InquiryResponse struct {
 	Peripheral   byte // peripheral qualifier, device type
 	_            byte
 	Version      byte
-	_            [5]byte
+	_            [2]byte
+	Capabilities byte // SCCS, ACC, TPGS, 3PC, PROTECT
+	_            [2]byte
 	VendorIdent  [8]byte
 	ProductIdent [16]byte
 	ProductRev   [4]byte
 }
 
+// Protect reports whether the device supports protection information.
+func (inq InquiryResponse) Protect() bool {
+	return inq.Capabilities&0x01 != 0
+}
+
 func (inq InquiryResponse) String() string {
 	return fmt.Sprintf("%.8s  %.16s  %.4s", inq.VendorIdent, inq.ProductIdent, inq.ProductRev)
 }
@@ -0,0 +1,294 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI READ DEFECT DATA functions.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Address descriptor formats
+	DEFECT_FORMAT_SHORT_BLOCK     = 0x0
+	DEFECT_FORMAT_EXT_BYTES_INDEX = 0x1
+	DEFECT_FORMAT_EXT_PHYS_SECTOR = 0x2
+	DEFECT_FORMAT_LONG_BLOCK      = 0x3
+	DEFECT_FORMAT_BYTES_INDEX     = 0x4
+	DEFECT_FORMAT_PHYS_SECTOR     = 0x5
+	DEFECT_FORMAT_VENDOR          = 0x6
+
+	// Length of READ DEFECT DATA(10) / READ DEFECT DATA(12) headers
+	DEFECT_HEADER_10_LEN = 4
+	DEFECT_HEADER_12_LEN = 8
+
+	// Request flags of READ DEFECT DATA CDBs
+	defectReqPList = 0x10
+	defectReqGList = 0x08
+)
+
+// DefectListHeader is a decoded READ DEFECT DATA(10) or READ DEFECT DATA(12) header.
+type DefectListHeader struct {
+	PListValid bool
+	GListValid bool
+	Format     uint8  // Address descriptor format of the returned list
+	Length     uint32 // Defect list length, in bytes
+	Truncated  bool   // Length overflowed a READ DEFECT DATA(10) header, so Count is a lower bound
+}
+
+// defectDescLen returns the length of an address descriptor in the specified format, or 0 if the
+// length is not known.
+func defectDescLen(format uint8) int {
+	switch format {
+	case DEFECT_FORMAT_SHORT_BLOCK:
+		return 4
+	case DEFECT_FORMAT_EXT_BYTES_INDEX, DEFECT_FORMAT_EXT_PHYS_SECTOR, DEFECT_FORMAT_LONG_BLOCK,
+		DEFECT_FORMAT_BYTES_INDEX, DEFECT_FORMAT_PHYS_SECTOR:
+		return 8
+	}
+
+	return 0
+}
+
+// Count returns the number of defects in the list.
+func (h DefectListHeader) Count() (int, error) {
+	descLen := defectDescLen(h.Format)
+	if descLen == 0 {
+		return 0, fmt.Errorf("defect list: unsupported address descriptor format %d", h.Format)
+	}
+
+	return int(h.Length) / descLen, nil
+}
+
+// DecodeDefectListHeader decodes the header of a READ DEFECT DATA(10) response, or a READ DEFECT
+// DATA(12) response if twelve is true.
+func DecodeDefectListHeader(buf []byte, twelve bool) (DefectListHeader, error) {
+	var h DefectListHeader
+
+	hdrLen := DEFECT_HEADER_10_LEN
+	if twelve {
+		hdrLen = DEFECT_HEADER_12_LEN
+	}
+
+	if len(buf) < hdrLen {
+		return h, fmt.Errorf("defect list: short header (%d bytes)", len(buf))
+	}
+
+	h.PListValid = buf[1]&defectReqPList != 0
+	h.GListValid = buf[1]&defectReqGList != 0
+	h.Format = buf[1] & 0x07
+
+	if twelve {
+		h.Length = binary.BigEndian.Uint32(buf[4:])
+	} else {
+		h.Length = uint32(binary.BigEndian.Uint16(buf[2:]))
+	}
+
+	return h, nil
+}
+
+// Defect is a decoded defect list address descriptor. Block formats only set LBA, whereas the
+// physical sector and bytes from index formats set the remaining fields.
+type Defect struct {
+	LBA      uint64
+	Cylinder uint32
+	Head     uint8
+	Sector   uint32 // Sector number, or bytes from index
+}
+
+// DecodeDefectList decodes a list of address descriptors in the specified format.
+func DecodeDefectList(format uint8, buf []byte) ([]Defect, error) {
+	descLen := defectDescLen(format)
+	if descLen == 0 {
+		return nil, fmt.Errorf("defect list: unsupported address descriptor format %d", format)
+	}
+
+	defects := make([]Defect, 0, len(buf)/descLen)
+
+	for ; len(buf) >= descLen; buf = buf[descLen:] {
+		switch format {
+		case DEFECT_FORMAT_SHORT_BLOCK:
+			defects = append(defects, Defect{LBA: uint64(binary.BigEndian.Uint32(buf))})
+		case DEFECT_FORMAT_LONG_BLOCK:
+			defects = append(defects, Defect{LBA: binary.BigEndian.Uint64(buf)})
+		default:
+			// Extended formats use the most significant bits of the last field as flags
+			sector := binary.BigEndian.Uint32(buf[4:])
+			if format == DEFECT_FORMAT_EXT_BYTES_INDEX || format == DEFECT_FORMAT_EXT_PHYS_SECTOR {
+				sector &= 0x0fffffff
+			}
+
+			defects = append(defects, Defect{
+				Cylinder: binary.BigEndian.Uint32(buf) >> 8,
+				Head:     buf[3],
+				Sector:   sector,
+			})
+		}
+	}
+
+	return defects, nil
+}
+
+// defectDataError filters the error of a READ DEFECT DATA command. A device which does not support
+// the requested address descriptor format returns the defect list in a format of its choosing,
+// with RECOVERED ERROR sense data, which is not treated as an error.
+func defectDataError(err error) error {
+	if sense, ok := SenseFromError(err); ok && sense.Key == SENSE_KEY_RECOVERED_ERROR {
+		return nil
+	}
+
+	return err
+}
+
+// readDefectData10 sends a SCSI READ DEFECT DATA(10) command to a device.
+func (d *SCSIDevice) readDefectData10(plist bool, format uint8, allocLen uint16) ([]byte, error) {
+	respBuf := make([]byte, allocLen)
+
+	cdb := CDB10{SCSI_READ_DEFECT_DATA_10}
+	cdb[2] = format & 0x07
+	if plist {
+		cdb[2] |= defectReqPList
+	} else {
+		cdb[2] |= defectReqGList
+	}
+	binary.BigEndian.PutUint16(cdb[7:], allocLen)
+
+	if err := defectDataError(d.sendCDB(cdb[:], &respBuf)); err != nil {
+		return nil, fmt.Errorf("READ DEFECT DATA(10): %v", err)
+	}
+
+	return respBuf, nil
+}
+
+// readDefectData12 sends a SCSI READ DEFECT DATA(12) command to a device.
+func (d *SCSIDevice) readDefectData12(plist bool, format uint8, allocLen uint32) ([]byte, error) {
+	respBuf := make([]byte, allocLen)
+
+	cdb := CDB12{SCSI_READ_DEFECT_DATA_12}
+	cdb[1] = format & 0x07
+	if plist {
+		cdb[1] |= defectReqPList
+	} else {
+		cdb[1] |= defectReqGList
+	}
+	binary.BigEndian.PutUint32(cdb[6:], allocLen)
+
+	if err := defectDataError(d.sendCDB(cdb[:], &respBuf)); err != nil {
+		return nil, fmt.Errorf("READ DEFECT DATA(12): %v", err)
+	}
+
+	return respBuf, nil
+}
+
+// defectListHeader requests only the header of the primary or grown defect list, in whichever
+// address descriptor format the device supports. READ DEFECT DATA(10) is tried first, since it is
+// more widely supported. Its 16-bit list length may overflow on drives with many defects, in which
+// case READ DEFECT DATA(12) is used if the device supports it.
+func (d *SCSIDevice) defectListHeader(plist bool) (DefectListHeader, error) {
+	var h10 DefectListHeader
+
+	buf, err10 := d.readDefectData10(plist, DEFECT_FORMAT_LONG_BLOCK, DEFECT_HEADER_10_LEN)
+	if err10 == nil {
+		h10, err10 = DecodeDefectListHeader(buf, false)
+		if err10 == nil && h10.Length < 0xfff8 {
+			return h10, nil
+		}
+	}
+
+	var h12 DefectListHeader
+
+	buf, err12 := d.readDefectData12(plist, DEFECT_FORMAT_LONG_BLOCK, DEFECT_HEADER_12_LEN)
+	if err12 == nil {
+		h12, err12 = DecodeDefectListHeader(buf, true)
+	}
+
+	return pickDefectListHeader(h10, h12, err10, err12)
+}
+
+// pickDefectListHeader chooses between the results of READ DEFECT DATA(10) and (12). The (10)
+// header is only used if the device does not support (12), in which case its list length may have
+// overflowed.
+func pickDefectListHeader(h10, h12 DefectListHeader, err10, err12 error) (DefectListHeader, error) {
+	if err12 == nil {
+		return h12, nil
+	}
+
+	if err10 == nil {
+		h10.Truncated = true
+		return h10, nil
+	}
+
+	return DefectListHeader{}, err10
+}
+
+// GrownDefectCount returns the number of entries in the grown defect list (GLIST) of the device,
+// i.e. the number of defects found since manufacture.
+func (d *SCSIDevice) GrownDefectCount() (int, error) {
+	h, err := d.defectListHeader(false)
+	if err != nil {
+		return 0, err
+	}
+
+	if !h.GListValid {
+		return 0, fmt.Errorf("defect list: grown defect list not available")
+	}
+
+	return h.Count()
+}
+
+// PrimaryDefectCount returns the number of entries in the primary defect list (PLIST) of the
+// device, i.e. the number of defects found during manufacture.
+func (d *SCSIDevice) PrimaryDefectCount() (int, error) {
+	h, err := d.defectListHeader(true)
+	if err != nil {
+		return 0, err
+	}
+
+	if !h.PListValid {
+		return 0, fmt.Errorf("defect list: primary defect list not available")
+	}
+
+	return h.Count()
+}
+
+// GrownDefects returns the address descriptors of the grown defect list of the device.
+func (d *SCSIDevice) GrownDefects() ([]Defect, error) {
+	h, err := d.defectListHeader(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !h.GListValid {
+		return nil, fmt.Errorf("defect list: grown defect list not available")
+	}
+
+	buf, err := d.readDefectData12(false, h.Format, DEFECT_HEADER_12_LEN+h.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	h12, err := DecodeDefectListHeader(buf, true)
+	if err != nil {
+		return nil, err
+	}
+
+	listLen := int(h12.Length)
+	if DEFECT_HEADER_12_LEN+listLen > len(buf) {
+		listLen = len(buf) - DEFECT_HEADER_12_LEN
+	}
+
+	return DecodeDefectList(h12.Format, buf[DEFECT_HEADER_12_LEN:DEFECT_HEADER_12_LEN+listLen])
+}
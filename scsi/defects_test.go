@@ -0,0 +1,104 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeDefectListHeader(t *testing.T) {
+	// READ DEFECT DATA(10): GLIST valid, long block format, 3 descriptors
+	h, err := DecodeDefectListHeader([]byte{0x00, 0x0b, 0x00, 0x18}, false)
+	assert.NoError(t, err)
+	assert.True(t, h.GListValid)
+	assert.False(t, h.PListValid)
+	assert.Equal(t, uint8(DEFECT_FORMAT_LONG_BLOCK), h.Format)
+
+	n, err := h.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// READ DEFECT DATA(12): PLIST valid, device chose physical sector format
+	h, err = DecodeDefectListHeader([]byte{0x00, 0x15, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, true)
+	assert.NoError(t, err)
+	assert.True(t, h.PListValid)
+	assert.Equal(t, uint8(DEFECT_FORMAT_PHYS_SECTOR), h.Format)
+
+	n, err = h.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 8192, n)
+
+	_, err = DecodeDefectListHeader([]byte{0x00, 0x0b, 0x00, 0x18}, true)
+	assert.Error(t, err)
+
+	_, err = DefectListHeader{Format: DEFECT_FORMAT_VENDOR, Length: 16}.Count()
+	assert.Error(t, err)
+}
+
+func TestDecodeDefectList(t *testing.T) {
+	defects, err := DecodeDefectList(DEFECT_FORMAT_LONG_BLOCK,
+		[]byte{0, 0, 0, 0, 0, 0x01, 0x23, 0x45, 0, 0, 0, 0x01, 0, 0, 0, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, []Defect{{LBA: 0x12345}, {LBA: 0x100000000}}, defects)
+
+	defects, err = DecodeDefectList(DEFECT_FORMAT_PHYS_SECTOR, []byte{0x00, 0x12, 0x34, 0x02, 0x00, 0x00, 0x01, 0xf4})
+	assert.NoError(t, err)
+	assert.Equal(t, []Defect{{Cylinder: 0x1234, Head: 2, Sector: 500}}, defects)
+}
+
+func TestDefectDataRecoveredError(t *testing.T) {
+	// Device does not support the requested long block format, and returns a header in physical
+	// sector format with RECOVERED ERROR, DEFECT LIST NOT FOUND.
+	err := sgioError{
+		scsiStatus: 0x02,
+		senseBuf:   []byte{0x70, 0x00, SENSE_KEY_RECOVERED_ERROR, 0, 0, 0, 0, 0x0a, 0, 0, 0, 0, 0x1c, 0x00},
+	}
+	assert.NoError(t, defectDataError(err))
+
+	h, decErr := DecodeDefectListHeader([]byte{0x00, 0x0d, 0x00, 0x10}, false)
+	assert.NoError(t, decErr)
+	assert.Equal(t, uint8(DEFECT_FORMAT_PHYS_SECTOR), h.Format)
+
+	n, decErr := h.Count()
+	assert.NoError(t, decErr)
+	assert.Equal(t, 2, n)
+
+	// Other errors are still reported
+	err.senseBuf[2] = SENSE_KEY_ILLEGAL_REQUEST
+	assert.Error(t, defectDataError(err))
+	assert.NoError(t, defectDataError(nil))
+}
+
+func TestPickDefectListHeader(t *testing.T) {
+	h10 := DefectListHeader{GListValid: true, Format: DEFECT_FORMAT_LONG_BLOCK, Length: 0xfff8}
+	h12 := DefectListHeader{GListValid: true, Format: DEFECT_FORMAT_LONG_BLOCK, Length: 0x10000}
+	errUnsupported := fmt.Errorf("READ DEFECT DATA(12): invalid command operation code")
+
+	h, err := pickDefectListHeader(h10, h12, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, h12, h)
+
+	// READ DEFECT DATA(12) not supported, so the list length may have overflowed
+	h, err = pickDefectListHeader(h10, DefectListHeader{}, nil, errUnsupported)
+	assert.NoError(t, err)
+	assert.True(t, h.Truncated)
+	assert.Equal(t, uint32(0xfff8), h.Length)
+
+	_, err = pickDefectListHeader(DefectListHeader{}, DefectListHeader{}, errUnsupported, errUnsupported)
+	assert.Error(t, err)
+}
@@ -0,0 +1,223 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI error counter log pages.
+
+package scsi
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// Error counter log page codes
+	LOG_WRITE_ERROR_COUNTER  = 0x02
+	LOG_READ_ERROR_COUNTER   = 0x03
+	LOG_VERIFY_ERROR_COUNTER = 0x05
+	LOG_NON_MEDIUM_ERROR     = 0x06
+)
+
+// ErrorCounters is a decoded write, read or verify error counter log page.
+type ErrorCounters struct {
+	CorrectedFast        uint64 // Errors corrected without substantial delay
+	CorrectedDelayed     uint64 // Errors corrected with possible delays
+	Rereads              uint64 // Total rereads / rewrites
+	TotalCorrected       uint64 // Total errors corrected
+	AlgorithmInvocations uint64 // Total times correction algorithm processed
+	BytesProcessed       uint64
+	Uncorrected          uint64 // Total uncorrected errors
+}
+
+// DecodeErrorCounters decodes a write (02h), read (03h) or verify (05h) error counter log page.
+func DecodeErrorCounters(lp LogPage) (ErrorCounters, error) {
+	var ec ErrorCounters
+
+	switch lp.Page {
+	case LOG_WRITE_ERROR_COUNTER, LOG_READ_ERROR_COUNTER, LOG_VERIFY_ERROR_COUNTER:
+	default:
+		return ec, fmt.Errorf("log page %s: not an error counter page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		switch p.Code {
+		case 0x0000:
+			ec.CorrectedFast = p.Uint64()
+		case 0x0001:
+			ec.CorrectedDelayed = p.Uint64()
+		case 0x0002:
+			ec.Rereads = p.Uint64()
+		case 0x0003:
+			ec.TotalCorrected = p.Uint64()
+		case 0x0004:
+			ec.AlgorithmInvocations = p.Uint64()
+		case 0x0005:
+			ec.BytesProcessed = p.Uint64()
+		case 0x0006:
+			ec.Uncorrected = p.Uint64()
+		}
+	}
+
+	return ec, nil
+}
+
+// Print prints the error counters as a single row of the error counter table.
+func (ec ErrorCounters) Print(w io.Writer) {
+	printErrorCounterHeader(w)
+	ec.printRow(w, "")
+}
+
+func printErrorCounterHeader(w io.Writer) {
+	fmt.Fprintln(w, "           Errors Corrected by           Total   Correction     Gigabytes    Total")
+	fmt.Fprintln(w, "               ECC          rereads/    errors   algorithm      processed    uncorrected")
+	fmt.Fprintln(w, "           fast | delayed   rewrites  corrected  invocations   [10^9 bytes]  errors")
+}
+
+func (ec ErrorCounters) printRow(w io.Writer, label string) {
+	fmt.Fprintf(w, "%-8s%8d %8d  %8d  %8d   %8d   %12.3f    %8d\n", label,
+		ec.CorrectedFast, ec.CorrectedDelayed, ec.Rereads, ec.TotalCorrected, ec.AlgorithmInvocations,
+		float64(ec.BytesProcessed)/1e9, ec.Uncorrected)
+}
+
+// NonMediumErrors is a decoded non-medium error log page (06h).
+type NonMediumErrors struct {
+	Count uint64
+}
+
+// DecodeNonMediumErrors decodes a non-medium error log page (06h).
+func DecodeNonMediumErrors(lp LogPage) (NonMediumErrors, error) {
+	var nme NonMediumErrors
+
+	if lp.Page != LOG_NON_MEDIUM_ERROR {
+		return nme, fmt.Errorf("log page %s: not a non-medium error page", lp.LogPageID)
+	}
+
+	if p, ok := lp.Param(0x0000); ok {
+		nme.Count = p.Uint64()
+	}
+
+	return nme, nil
+}
+
+func (nme NonMediumErrors) Print(w io.Writer) {
+	fmt.Fprintf(w, "Non-medium error count: %8d\n", nme.Count)
+}
+
+// ErrorCounterLog combines the error counter log pages of a device. Pages which are not supported by
+// the device are nil.
+type ErrorCounterLog struct {
+	Read      *ErrorCounters
+	Write     *ErrorCounters
+	Verify    *ErrorCounters
+	NonMedium *NonMediumErrors
+}
+
+// Print prints the error counters as an smartctl-style table.
+func (l ErrorCounterLog) Print(w io.Writer) {
+	if l.Read != nil || l.Write != nil || l.Verify != nil {
+		printErrorCounterHeader(w)
+
+		for _, row := range []struct {
+			label string
+			ec    *ErrorCounters
+		}{{"read:", l.Read}, {"write:", l.Write}, {"verify:", l.Verify}} {
+			if row.ec != nil {
+				row.ec.printRow(w, row.label)
+			}
+		}
+	}
+
+	if l.NonMedium != nil {
+		fmt.Fprintln(w)
+		l.NonMedium.Print(w)
+	}
+}
+
+// errorCounters reads and decodes an error counter log page.
+func (d *SCSIDevice) errorCounters(page uint8) (*ErrorCounters, error) {
+	lp, err := d.LogPage(page, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return nil, err
+	}
+
+	ec, err := DecodeErrorCounters(lp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec, nil
+}
+
+// ErrorCounterLog reads the error counter log pages supported by the device.
+func (d *SCSIDevice) ErrorCounterLog(pages []LogPageID) (ErrorCounterLog, error) {
+	var (
+		l   ErrorCounterLog
+		err error
+	)
+
+	supported := make(map[uint8]bool)
+	for _, id := range pages {
+		if id.Subpage == LOG_SUBPAGE_NONE {
+			supported[id.Page] = true
+		}
+	}
+
+	if supported[LOG_READ_ERROR_COUNTER] {
+		if l.Read, err = d.errorCounters(LOG_READ_ERROR_COUNTER); err != nil {
+			return l, err
+		}
+	}
+
+	if supported[LOG_WRITE_ERROR_COUNTER] {
+		if l.Write, err = d.errorCounters(LOG_WRITE_ERROR_COUNTER); err != nil {
+			return l, err
+		}
+	}
+
+	if supported[LOG_VERIFY_ERROR_COUNTER] {
+		if l.Verify, err = d.errorCounters(LOG_VERIFY_ERROR_COUNTER); err != nil {
+			return l, err
+		}
+	}
+
+	if supported[LOG_NON_MEDIUM_ERROR] {
+		lp, err := d.LogPage(LOG_NON_MEDIUM_ERROR, LOG_SUBPAGE_NONE)
+		if err != nil {
+			return l, err
+		}
+
+		nme, err := DecodeNonMediumErrors(lp)
+		if err != nil {
+			return l, err
+		}
+
+		l.NonMedium = &nme
+	}
+
+	return l, nil
+}
+
+func init() {
+	decodeErrorCounters := func(lp LogPage) (LogPagePrinter, error) {
+		return DecodeErrorCounters(lp)
+	}
+
+	RegisterLogPageDecoder(LOG_WRITE_ERROR_COUNTER, LOG_SUBPAGE_NONE, "Write error counter", decodeErrorCounters)
+	RegisterLogPageDecoder(LOG_READ_ERROR_COUNTER, LOG_SUBPAGE_NONE, "Read error counter", decodeErrorCounters)
+	RegisterLogPageDecoder(LOG_VERIFY_ERROR_COUNTER, LOG_SUBPAGE_NONE, "Verify error counter", decodeErrorCounters)
+	RegisterLogPageDecoder(LOG_NON_MEDIUM_ERROR, LOG_SUBPAGE_NONE, "Non-medium error",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeNonMediumErrors(lp)
+		})
+}
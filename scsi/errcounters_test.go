@@ -0,0 +1,50 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCounterLog(t *testing.T) {
+	assert := assert.New(t)
+
+	lp, err := ParseLogPage([]byte{0x03, 0x00, 0x00, 0x1c,
+		0x00, 0x00, 0x02, 0x04, 0x00, 0x00, 0x00, 0x05, // corrected fast
+		0x00, 0x03, 0x02, 0x04, 0x00, 0x00, 0x00, 0x05, // total corrected
+		0x00, 0x05, 0x02, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // bytes processed
+	})
+	assert.NoError(err)
+
+	ec, err := DecodeErrorCounters(lp)
+	assert.NoError(err)
+	assert.Equal(ErrorCounters{CorrectedFast: 5, TotalCorrected: 5, BytesProcessed: 1 << 32}, ec)
+
+	var buf bytes.Buffer
+	ErrorCounterLog{Read: &ec, NonMedium: &NonMediumErrors{Count: 7}}.Print(&buf)
+
+	lines := strings.Split(buf.String(), "\n")
+	if assert.Len(lines, 7) {
+		assert.Equal("read:          5        0         0         5          0          4.295           0", lines[3])
+		assert.Equal("Non-medium error count:        7", lines[5])
+	}
+
+	_, err = DecodeErrorCounters(LogPage{LogPageID: LogPageID{0x0d, 0x00}})
+	assert.Error(err)
+}
@@ -0,0 +1,134 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Seagate Field Accessible Reliability Metrics (FARM) log, via LOG SENSE and SAT.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dswarbrick/smart/ata"
+)
+
+const (
+	// Seagate FARM log page and subpage codes
+	LOG_FARM         = 0x3d
+	LOG_SUBPAGE_FARM = 0x03
+
+	// Number of 512-byte sectors in an ATA FARM log page
+	farmSectorsPerPage = ata.FARM_PAGE_SIZE / 512
+)
+
+// scsiFarmLayout is the layout of the SCSI FARM log page (3Dh/03h). Each FARM page is a log
+// parameter, whose parameter code is the page number. The SCSI flavour does not report head flight
+// hours, and reports temperatures in units of 0.1 °C.
+var scsiFarmLayout = ata.FarmLayout{
+	Heads:           9,
+	PowerOnHours:    16,
+	HeadFlightHours: -1,
+	HeadLoadEvents:  19,
+	PowerCycles:     20,
+	TempDivisor:     10,
+}
+
+// DecodeFarmLogPage decodes the Seagate FARM log page (3Dh/03h). Statistics by head are parameters
+// with codes above the reliability page, and can be retrieved with FarmLog.ByHead.
+func DecodeFarmLogPage(lp LogPage) (ata.FarmLog, error) {
+	if lp.LogPageID != (LogPageID{LOG_FARM, LOG_SUBPAGE_FARM}) {
+		return ata.FarmLog{}, fmt.Errorf("log page %s: not a FARM page", lp.LogPageID)
+	}
+
+	pages := make(map[uint16]ata.FarmPage, len(lp.Params))
+	for _, p := range lp.Params {
+		pages[p.Code] = ata.SplitFarmPage(p.Value, binary.BigEndian)
+	}
+
+	return ata.DecodeFarmPages(pages, scsiFarmLayout)
+}
+
+// FarmLog reads the Seagate FARM log page of the device.
+func (d *SCSIDevice) FarmLog() (ata.FarmLog, error) {
+	lp, err := d.LogPage(LOG_FARM, LOG_SUBPAGE_FARM)
+	if err != nil {
+		return ata.FarmLog{}, err
+	}
+
+	return DecodeFarmLogPage(lp)
+}
+
+// ReadLogExtCDB returns an ATA PASS-THROUGH(16) CDB for an ATA READ LOG EXT command, which reads
+// count sectors of a GP log, starting at the specified page (i.e., 512-byte sector) of the log.
+func ReadLogExtCDB(logAddr uint8, page, count uint16) CDB16 {
+	cdb := CDB16{SCSI_ATA_PASSTHRU_16}
+	cdb[1] = 0x09                  // ATA protocol (4 << 1, PIO data-in), extend
+	cdb[2] = 0x0e                  // BYT_BLOK = 1, T_LENGTH = 2, T_DIR = 1
+	cdb[5] = uint8(count >> 8)     // high sector count
+	cdb[6] = uint8(count)          // low sector count
+	cdb[8] = logAddr               // low lba_low
+	cdb[9] = uint8(page >> 8)      // high lba_mid
+	cdb[10] = uint8(page)          // low lba_mid
+	cdb[14] = ata.ATA_READ_LOG_EXT // command
+
+	return cdb
+}
+
+// ReadFarmLog reads the ATA FARM log via the specified function, which executes an ATA READ LOG
+// EXT CDB and fills buf. The header page is read first, to find the number of supported pages.
+func ReadFarmLog(readLog func(cdb []byte, buf []byte) error) (ata.FarmLog, error) {
+	buf := make([]byte, ata.FARM_PAGE_SIZE)
+
+	cdb := ReadLogExtCDB(ata.FARM_LOG, 0, farmSectorsPerPage)
+	if err := readLog(cdb[:], buf); err != nil {
+		return ata.FarmLog{}, fmt.Errorf("ATA READ LOG EXT: %v", err)
+	}
+
+	hdr, err := ata.DecodeFarmLog(buf)
+	if err != nil {
+		return hdr, err
+	}
+
+	numPages := int(hdr.PagesSupported)
+	if numPages > ata.FARM_PAGES || numPages < 1 {
+		numPages = ata.FARM_PAGES
+	}
+
+	for n := 1; n < numPages; n++ {
+		pageBuf := make([]byte, ata.FARM_PAGE_SIZE)
+
+		cdb := ReadLogExtCDB(ata.FARM_LOG, uint16(n*farmSectorsPerPage), farmSectorsPerPage)
+		if err := readLog(cdb[:], pageBuf); err != nil {
+			return ata.FarmLog{}, fmt.Errorf("ATA READ LOG EXT: %v", err)
+		}
+
+		buf = append(buf, pageBuf...)
+	}
+
+	return ata.DecodeFarmLog(buf)
+}
+
+// FarmLog reads the Seagate FARM log (GP log A6h) of the ATA device.
+func (d *SATDevice) FarmLog() (ata.FarmLog, error) {
+	return ReadFarmLog(func(cdb []byte, buf []byte) error {
+		return d.sendCDB(cdb, &buf)
+	})
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_FARM, LOG_SUBPAGE_FARM, "Seagate FARM",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeFarmLogPage(lp)
+		})
+}
@@ -0,0 +1,68 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/ata"
+)
+
+func TestDecodeFarmLogPage(t *testing.T) {
+	assert := assert.New(t)
+
+	field := func(v uint64) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, v|0xc0<<56)
+		return b
+	}
+
+	param := func(code uint16, fields ...[]byte) []byte {
+		var value []byte
+		for _, f := range fields {
+			value = append(value, f...)
+		}
+		return append([]byte{byte(code >> 8), byte(code), 0x03, byte(len(value))}, value...)
+	}
+
+	hdr := param(0, field(ata.FARM_SIGNATURE), field(4), field(21), field(6), field(0), field(0), field(2))
+
+	info := make([][]byte, scsiFarmLayout.PowerOnHours+1)
+	for i := range info {
+		info[i] = field(0)
+	}
+	info[scsiFarmLayout.Heads] = field(2)
+	info[scsiFarmLayout.PowerOnHours] = field(20000)
+
+	env := param(ata.FARM_PAGE_ENVIRONMENT, field(4), field(0), field(415), field(500), field(200))
+	byHead := param(0x1a, field(1100), field(1200))
+
+	data := append(append(append(hdr, param(ata.FARM_PAGE_DRIVE_INFO, info...)...), env...), byHead...)
+	buf := append([]byte{0x40 | LOG_FARM, LOG_SUBPAGE_FARM, byte(len(data) >> 8), byte(len(data))}, data...)
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	farm, err := DecodeFarmLogPage(lp)
+	assert.NoError(err)
+	assert.Equal(int64(2), farm.Heads)
+	assert.Equal(int64(20000), farm.PowerOnHours)
+	assert.Equal(int64(41), farm.CurrentTemp)
+	assert.Equal(int64(20), farm.LowestTemp)
+	assert.Equal([]int64{1100, 1200}, farm.ByHead(0x1a, 0))
+}
@@ -0,0 +1,272 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI Informational Exceptions (SMART) health status.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dswarbrick/smart/ata"
+	"github.com/dswarbrick/smart/utils"
+)
+
+const (
+	// Informational exceptions log page code
+	LOG_INFORMATIONAL_EXCEPTIONS = 0x2f
+
+	// Additional sense codes reported by informational exceptions
+	ASC_WARNING                   = 0x0b
+	ASC_FAILURE_PREDICTION        = 0x5d
+	ASCQ_FAILURE_PREDICTION_FALSE = 0xff
+
+	// Method of reporting informational exceptions (MRIE)
+	MRIE_NO_REPORTING            = 0x0
+	MRIE_ASYNC_EVENT             = 0x1
+	MRIE_UNIT_ATTENTION          = 0x2
+	MRIE_CONDITIONAL_RECOVERED   = 0x3
+	MRIE_UNCONDITIONAL_RECOVERED = 0x4
+	MRIE_NO_SENSE                = 0x5
+	MRIE_ON_REQUEST              = 0x6
+)
+
+// InformationalExceptions is the decoded informational exceptions log page (2Fh).
+type InformationalExceptions struct {
+	ASC         uint8 // Additional sense code of most recent informational exception, or 0
+	ASCQ        uint8
+	Temperature uint8 // Most recent temperature reading, or TEMPERATURE_NOT_AVAILABLE
+}
+
+// DecodeInformationalExceptions decodes the informational exceptions log page (2Fh).
+func DecodeInformationalExceptions(lp LogPage) (InformationalExceptions, error) {
+	ie := InformationalExceptions{Temperature: TEMPERATURE_NOT_AVAILABLE}
+
+	if lp.LogPageID != (LogPageID{LOG_INFORMATIONAL_EXCEPTIONS, LOG_SUBPAGE_NONE}) {
+		return ie, fmt.Errorf("log page %s: not an informational exceptions page", lp.LogPageID)
+	}
+
+	p, ok := lp.Param(0x0000)
+	if !ok || len(p.Value) < 2 {
+		return ie, fmt.Errorf("log page %s: no general informational exceptions parameter", lp.LogPageID)
+	}
+
+	ie.ASC, ie.ASCQ = p.Value[0], p.Value[1]
+
+	// Older devices do not report a temperature
+	if len(p.Value) >= 3 {
+		ie.Temperature = p.Value[2]
+	}
+
+	return ie, nil
+}
+
+// Health returns the health verdict corresponding to the most recent informational exception.
+func (ie InformationalExceptions) Health() utils.Health {
+	h := utils.Health{Status: utils.HealthPassed, Temperature: -1}
+
+	if ie.Temperature != TEMPERATURE_NOT_AVAILABLE && ie.Temperature != 0 {
+		h.Temperature = int(ie.Temperature)
+	}
+
+	switch {
+	case ie.ASC == ASC_FAILURE_PREDICTION && ie.ASCQ != ASCQ_FAILURE_PREDICTION_FALSE:
+		h.Status = utils.HealthFailed
+		h.Reason = ASCDescription(ie.ASC, ie.ASCQ)
+	case ie.ASC != 0 && ie.ASC != ASC_FAILURE_PREDICTION:
+		h.Status = utils.HealthWarning
+		h.Reason = ASCDescription(ie.ASC, ie.ASCQ)
+	}
+
+	return h
+}
+
+func (ie InformationalExceptions) Print(w io.Writer) {
+	fmt.Fprintf(w, "SMART Health Status: %s\n", ie.Health())
+	fmt.Fprintf(w, "Most recent temperature: %s\n", formatTemperature(ie.Temperature))
+}
+
+// Health returns the health verdict of the device, based on the informational exceptions log page.
+// If the page does not report a temperature, the temperature log page is used instead.
+func (d *SCSIDevice) Health() (utils.Health, error) {
+	lp, err := d.LogPage(LOG_INFORMATIONAL_EXCEPTIONS, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return utils.Health{Temperature: -1}, err
+	}
+
+	ie, err := DecodeInformationalExceptions(lp)
+	if err != nil {
+		return utils.Health{Temperature: -1}, err
+	}
+
+	h := ie.Health()
+
+	if h.Temperature < 0 {
+		if t, err := d.Temperature(); err == nil && t.Current != TEMPERATURE_NOT_AVAILABLE {
+			h.Temperature = int(t.Current)
+		}
+	}
+
+	return h, nil
+}
+
+// Health returns the health verdict of an ATA device, based on the SMART RETURN STATUS command.
+func (d *SATDevice) Health() (utils.Health, error) {
+	h := utils.Health{Temperature: -1}
+
+	cdb := CDB16{SCSI_ATA_PASSTHRU_16}
+	cdb[1] = 0x06                    // ATA protocol (3 << 1, non-data)
+	cdb[2] = 0x20                    // CK_COND = 1, i.e. return ATA registers in sense data
+	cdb[4] = ata.SMART_RETURN_STATUS // feature LSB
+	cdb[10] = 0x4f                   // low lba_mid
+	cdb[12] = 0xc2                   // low lba_high
+	cdb[14] = ata.ATA_SMART          // command
+
+	// With CK_COND set, the SAT layer reports CHECK CONDITION with the ATA registers in the sense
+	// data, even if the command succeeded.
+	err := d.sendCDBDir(cdb[:], nil, SG_DXFER_NONE)
+
+	sense, ok := SenseFromError(err)
+	if !ok {
+		if err == nil {
+			err = fmt.Errorf("no ATA status returned")
+		}
+		return h, fmt.Errorf("SMART RETURN STATUS: %v", err)
+	}
+
+	var lbaMid, lbaHigh uint8
+
+	if desc := sense.Descriptor(SENSE_DESC_ATA_STATUS); len(desc) >= 14 {
+		lbaMid, lbaHigh = desc[9], desc[11]
+	} else if sense.ResponseCode == SENSE_FIXED_CURRENT {
+		// Fixed format: LBA (23:0) is in the last 3 bytes of the command-specific information
+		lbaMid, lbaHigh = uint8(sense.CommandSpecific>>8), uint8(sense.CommandSpecific)
+	} else {
+		return h, fmt.Errorf("SMART RETURN STATUS: %s", sense)
+	}
+
+	switch {
+	case lbaMid == 0x4f && lbaHigh == 0xc2:
+		h.Status = utils.HealthPassed
+	case lbaMid == 0xf4 && lbaHigh == 0x2c:
+		h.Status = utils.HealthFailed
+		h.Reason = "SMART threshold exceeded"
+	default:
+		return h, fmt.Errorf("SMART RETURN STATUS: unexpected LBA mid/high %#02x/%#02x", lbaMid, lbaHigh)
+	}
+
+	return h, nil
+}
+
+// IECModePage is the decoded Informational Exceptions Control mode page (1Ch).
+type IECModePage struct {
+	PERF          bool   // Performance: disallow delays caused by informational exception operations
+	EBF           bool   // Enable background function
+	EWASC         bool   // Enable warning
+	DEXCPT        bool   // Disable exception control, i.e. informational exceptions are disabled
+	TEST          bool   // Generate test informational exceptions
+	EBACKERR      bool   // Enable background error reporting
+	LOGERR        bool   // Log errors
+	MRIE          uint8  // Method of reporting informational exceptions
+	IntervalTimer uint32 // In units of 100 ms
+	ReportCount   uint32
+}
+
+// DecodeIECModePage decodes the Informational Exceptions Control mode page (1Ch).
+func DecodeIECModePage(page []byte) (IECModePage, error) {
+	var iec IECModePage
+
+	if len(page) < 12 {
+		return iec, fmt.Errorf("mode page %02xh: short page (%d bytes)", INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE,
+			len(page))
+	}
+
+	if page[0]&0x3f != INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE || page[0]&0x40 != 0 {
+		return iec, fmt.Errorf("mode page %02xh: not an informational exceptions control page", page[0]&0x3f)
+	}
+
+	iec.PERF = page[2]&0x80 != 0
+	iec.EBF = page[2]&0x20 != 0
+	iec.EWASC = page[2]&0x10 != 0
+	iec.DEXCPT = page[2]&0x08 != 0
+	iec.TEST = page[2]&0x04 != 0
+	iec.EBACKERR = page[2]&0x02 != 0
+	iec.LOGERR = page[2]&0x01 != 0
+	iec.MRIE = page[3] & 0x0f
+	iec.IntervalTimer = binary.BigEndian.Uint32(page[4:])
+	iec.ReportCount = binary.BigEndian.Uint32(page[8:])
+
+	return iec, nil
+}
+
+// encode encodes the IEC mode page settings into an existing mode page.
+func (iec IECModePage) encode(page []byte) {
+	flags := []struct {
+		set bool
+		bit byte
+	}{
+		{iec.PERF, 0x80}, {iec.EBF, 0x20}, {iec.EWASC, 0x10}, {iec.DEXCPT, 0x08}, {iec.TEST, 0x04},
+		{iec.EBACKERR, 0x02}, {iec.LOGERR, 0x01},
+	}
+
+	for _, f := range flags {
+		if f.set {
+			page[2] |= f.bit
+		} else {
+			page[2] &^= f.bit
+		}
+	}
+
+	page[3] = page[3]&0xf0 | iec.MRIE&0x0f
+	binary.BigEndian.PutUint32(page[4:], iec.IntervalTimer)
+	binary.BigEndian.PutUint32(page[8:], iec.ReportCount)
+}
+
+// IECModePage reads the Informational Exceptions Control mode page settings, with the specified
+// page control, e.g. MPAGE_CONTROL_CURRENT.
+func (d *SCSIDevice) IECModePage(pageControl uint8) (IECModePage, error) {
+	page, err := d.ModePage(INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE, 0, pageControl)
+	if err != nil {
+		return IECModePage{}, err
+	}
+
+	return DecodeIECModePage(page)
+}
+
+// SetIECModePage changes the Informational Exceptions Control mode page settings, e.g. to enable
+// informational exceptions by clearing DEXCPT. If save is true, the settings persist across power
+// cycles.
+func (d *SCSIDevice) SetIECModePage(iec IECModePage, save bool) error {
+	page, err := d.ModePage(INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE, 0, MPAGE_CONTROL_CURRENT)
+	if err != nil {
+		return err
+	}
+
+	if _, err := DecodeIECModePage(page); err != nil {
+		return err
+	}
+
+	iec.encode(page)
+
+	return d.setModePage(page, save)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_INFORMATIONAL_EXCEPTIONS, LOG_SUBPAGE_NONE, "Informational exceptions",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeInformationalExceptions(lp)
+		})
+}
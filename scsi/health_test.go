@@ -0,0 +1,102 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/utils"
+)
+
+func TestInformationalExceptionsHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	lp, err := ParseLogPage([]byte{0x2f, 0x00, 0x00, 0x08,
+		0x00, 0x00, 0x03, 0x04, 0x5d, 0x10, 0x26, 0x3c})
+	assert.NoError(err)
+
+	ie, err := DecodeInformationalExceptions(lp)
+	assert.NoError(err)
+
+	h := ie.Health()
+	assert.Equal(utils.HealthFailed, h.Status)
+	assert.Equal(38, h.Temperature)
+	assert.Equal("FAILED (Failure prediction threshold exceeded (ASCQ 10h))", h.String())
+
+	assert.Equal(utils.HealthPassed, InformationalExceptions{ASC: 0x5d, ASCQ: 0xff}.Health().Status)
+	assert.Equal(utils.HealthWarning, InformationalExceptions{ASC: 0x0b, ASCQ: 0x01}.Health().Status)
+	assert.Equal(-1, InformationalExceptions{Temperature: TEMPERATURE_NOT_AVAILABLE}.Health().Temperature)
+}
+
+func TestParseSense(t *testing.T) {
+	assert := assert.New(t)
+
+	// Descriptor format, with ATA status return descriptor (SMART RETURN STATUS, threshold exceeded)
+	sense, ok := ParseSense([]byte{0x72, 0x01, 0x00, 0x1d, 0x00, 0x00, 0x00, 0x0e,
+		0x09, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf4, 0x00, 0x2c, 0x00, 0x50})
+	assert.True(ok)
+	assert.Equal(uint8(SENSE_KEY_RECOVERED_ERROR), sense.Key)
+	assert.Equal("sense key: RECOVERED ERROR, ATA pass through information available", sense.String())
+
+	desc := sense.Descriptor(SENSE_DESC_ATA_STATUS)
+	if assert.Len(desc, 14) {
+		assert.Equal(uint8(0xf4), desc[9])
+		assert.Equal(uint8(0x2c), desc[11])
+	}
+
+	// Fixed format, with progress indication
+	sense, ok = ParseSense([]byte{0x70, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x0a,
+		0x00, 0x00, 0x00, 0x00, 0x04, 0x09, 0x00, 0x80, 0x40, 0x00})
+	assert.True(ok)
+	assert.Equal(uint8(SENSE_KEY_NOT_READY), sense.Key)
+	assert.Equal([]byte{0x80, 0x40, 0x00}, sense.SenseKeySpecific)
+
+	_, ok = ParseSense([]byte{0x00, 0x00})
+	assert.False(ok)
+}
+
+func TestIECModePage(t *testing.T) {
+	assert := assert.New(t)
+
+	// MODE SENSE(10) header with 8 byte block descriptor, followed by IEC mode page
+	buf := []byte{0x00, 0x1e, 0x00, 0x10, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00,
+		0x9c, 0x0a, 0x08, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	mp, err := ParseModeParameters(buf, true)
+	assert.NoError(err)
+	assert.Len(mp.BlockDescriptors, 1)
+
+	page := mp.Page(INFORMATIONAL_EXCEPTIONS_CONTROL_PAGE, 0)
+	assert.Len(page, 12)
+
+	iec, err := DecodeIECModePage(page)
+	assert.NoError(err)
+	assert.True(iec.DEXCPT)
+	assert.Equal(uint8(MRIE_ON_REQUEST), iec.MRIE)
+
+	iec.DEXCPT = false
+	iec.EWASC = true
+	iec.IntervalTimer = 36000
+	iec.encode(page)
+
+	decoded, err := DecodeIECModePage(page)
+	assert.NoError(err)
+	assert.Equal(iec, decoded)
+	assert.Equal(byte(0x10), page[2])
+}
@@ -0,0 +1,375 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI LOG SENSE functions.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// Log page codes
+	LOG_SUPPORTED_PAGES = 0x00
+
+	// Log subpage codes
+	LOG_SUBPAGE_NONE      = 0x00
+	LOG_SUBPAGE_SUPPORTED = 0xff
+
+	// Log page control field
+	LOG_PC_THRESHOLD  = 0
+	LOG_PC_CUMULATIVE = 1
+
+	// Length of log page and log parameter headers
+	LOG_HEADER_LEN       = 4
+	LOG_PARAM_HEADER_LEN = 4
+)
+
+// LogPageID identifies a log page by its page and subpage code.
+type LogPageID struct {
+	Page    uint8
+	Subpage uint8
+}
+
+func (id LogPageID) String() string {
+	if id.Subpage == LOG_SUBPAGE_NONE {
+		return fmt.Sprintf("%02xh", id.Page)
+	}
+
+	return fmt.Sprintf("%02xh/%02xh", id.Page, id.Subpage)
+}
+
+// LogParameter is a single parameter of a log page.
+type LogParameter struct {
+	Code          uint16
+	DU            bool  // Disable update
+	TSD           bool  // Target save disable
+	ETC           bool  // Enable threshold comparison
+	TMC           uint8 // Threshold met criteria
+	FormatLinking uint8 // Format and linking (e.g., 0 = bounded counter, 1 = ASCII, 3 = binary)
+	Value         []byte
+}
+
+// Uint64 returns the value of a counter parameter. Values longer than 8 bytes are truncated to their
+// least significant 8 bytes.
+func (p LogParameter) Uint64() uint64 {
+	var v uint64
+
+	b := p.Value
+	if len(b) > 8 {
+		b = b[len(b)-8:]
+	}
+
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+
+	return v
+}
+
+// LogPage is a log page returned by LOG SENSE, split into its parameters.
+type LogPage struct {
+	LogPageID
+	DS     bool // Disable save
+	SPF    bool // Subpage format
+	Params []LogParameter
+}
+
+// Param returns the parameter with the specified parameter code.
+func (lp *LogPage) Param(code uint16) (LogParameter, bool) {
+	for _, p := range lp.Params {
+		if p.Code == code {
+			return p, true
+		}
+	}
+
+	return LogParameter{}, false
+}
+
+// ParseLogPage parses a LOG SENSE response into its parameters.
+func ParseLogPage(buf []byte) (LogPage, error) {
+	var lp LogPage
+
+	if len(buf) < LOG_HEADER_LEN {
+		return lp, fmt.Errorf("log page: short response (%d bytes)", len(buf))
+	}
+
+	lp.DS = buf[0]&0x80 != 0
+	lp.SPF = buf[0]&0x40 != 0
+	lp.Page = buf[0] & 0x3f
+	lp.Subpage = buf[1]
+
+	pageLen := int(binary.BigEndian.Uint16(buf[2:]))
+	if len(buf) < LOG_HEADER_LEN+pageLen {
+		return lp, fmt.Errorf("log page %s: truncated (%d of %d bytes)", lp.LogPageID, len(buf),
+			LOG_HEADER_LEN+pageLen)
+	}
+
+	data := buf[LOG_HEADER_LEN : LOG_HEADER_LEN+pageLen]
+
+	for len(data) >= LOG_PARAM_HEADER_LEN {
+		paramLen := int(data[3])
+		if len(data) < LOG_PARAM_HEADER_LEN+paramLen {
+			return lp, fmt.Errorf("log page %s: truncated parameter %04xh", lp.LogPageID,
+				binary.BigEndian.Uint16(data))
+		}
+
+		lp.Params = append(lp.Params, LogParameter{
+			Code:          binary.BigEndian.Uint16(data),
+			DU:            data[2]&0x80 != 0,
+			TSD:           data[2]&0x20 != 0,
+			ETC:           data[2]&0x10 != 0,
+			TMC:           (data[2] >> 2) & 0x03,
+			FormatLinking: data[2] & 0x03,
+			Value:         append([]byte{}, data[LOG_PARAM_HEADER_LEN:LOG_PARAM_HEADER_LEN+paramLen]...),
+		})
+
+		data = data[LOG_PARAM_HEADER_LEN+paramLen:]
+	}
+
+	return lp, nil
+}
+
+// DecodeSupportedLogPages decodes the Supported Log Pages (00h/00h) or Supported Log Pages and
+// Subpages (00h/FFh) page. Unlike other log pages, these pages contain a list of page codes, or of
+// page and subpage code pairs, rather than log parameters.
+func DecodeSupportedLogPages(buf []byte) ([]LogPageID, error) {
+	if len(buf) < LOG_HEADER_LEN {
+		return nil, fmt.Errorf("log page 00h: short response (%d bytes)", len(buf))
+	}
+
+	if buf[0]&0x3f != LOG_SUPPORTED_PAGES {
+		return nil, fmt.Errorf("log page 00h: unexpected page code %02xh", buf[0]&0x3f)
+	}
+
+	pageLen := int(binary.BigEndian.Uint16(buf[2:]))
+	if len(buf) < LOG_HEADER_LEN+pageLen {
+		return nil, fmt.Errorf("log page 00h: truncated (%d of %d bytes)", len(buf), LOG_HEADER_LEN+pageLen)
+	}
+
+	data := buf[LOG_HEADER_LEN : LOG_HEADER_LEN+pageLen]
+
+	var pages []LogPageID
+
+	if buf[0]&0x40 != 0 {
+		// SPF set: list of page code / subpage code pairs
+		for i := 0; i+1 < len(data); i += 2 {
+			pages = append(pages, LogPageID{data[i] & 0x3f, data[i+1]})
+		}
+	} else {
+		for _, page := range data {
+			pages = append(pages, LogPageID{page & 0x3f, LOG_SUBPAGE_NONE})
+		}
+	}
+
+	return pages, nil
+}
+
+// LogPagePrinter is implemented by decoded log pages, which can print themselves in a human readable
+// format.
+type LogPagePrinter interface {
+	Print(w io.Writer)
+}
+
+// LogPageDecoder decodes a log page.
+type LogPageDecoder func(LogPage) (LogPagePrinter, error)
+
+type logPageDecoderEntry struct {
+	name   string
+	decode LogPageDecoder
+}
+
+// logPageDecoders is the registry of log page decoders, populated by RegisterLogPageDecoder.
+var logPageDecoders = make(map[LogPageID]logPageDecoderEntry)
+
+// RegisterLogPageDecoder registers a named decoder for a log page. A decoder registered for a page
+// which already has a decoder replaces the existing decoder.
+func RegisterLogPageDecoder(page, subpage uint8, name string, decode LogPageDecoder) {
+	logPageDecoders[LogPageID{page, subpage}] = logPageDecoderEntry{name, decode}
+}
+
+// LogPageName returns the name of a log page, if a decoder has been registered for it.
+func LogPageName(id LogPageID) string {
+	if e, ok := logPageDecoders[id]; ok {
+		return e.name
+	}
+
+	return ""
+}
+
+// DecodeLogPage decodes a log page using its registered decoder.
+func DecodeLogPage(lp LogPage) (LogPagePrinter, error) {
+	e, ok := logPageDecoders[lp.LogPageID]
+	if !ok {
+		return nil, fmt.Errorf("log page %s: no decoder registered", lp.LogPageID)
+	}
+
+	return e.decode(lp)
+}
+
+// truncateLogPage trims a log page which was truncated (by the allocation length, or by a short
+// transfer) to its last complete parameter, and adjusts the page length in the header accordingly.
+func truncateLogPage(buf []byte) []byte {
+	n := LOG_HEADER_LEN
+	for n+LOG_PARAM_HEADER_LEN <= len(buf) {
+		paramLen := LOG_PARAM_HEADER_LEN + int(buf[n+3])
+		if n+paramLen > len(buf) {
+			break
+		}
+		n += paramLen
+	}
+
+	binary.BigEndian.PutUint16(buf[2:], uint16(n-LOG_HEADER_LEN))
+
+	return buf[:n]
+}
+
+// readLogSense reads a complete log page (including header) of cumulative values via the specified
+// function, which executes a SCSI LOG SENSE CDB, fills buf and returns the number of bytes
+// transferred.
+func readLogSense(page, subpage uint8, logSense func(cdb []byte, buf []byte) (int, error)) ([]byte, error) {
+	respBuf := make([]byte, 1024)
+
+	for {
+		cdb := CDB10{SCSI_LOG_SENSE}
+		cdb[2] = (LOG_PC_CUMULATIVE << 6) | (page & 0x3f)
+		cdb[3] = subpage
+		binary.BigEndian.PutUint16(cdb[7:], uint16(len(respBuf)))
+
+		n, err := logSense(cdb[:], respBuf)
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 || n > len(respBuf) {
+			n = len(respBuf)
+		}
+
+		if n < LOG_HEADER_LEN {
+			return nil, fmt.Errorf("log page %s: short response (%d bytes)", LogPageID{page, subpage}, n)
+		}
+
+		pageLen := LOG_HEADER_LEN + int(binary.BigEndian.Uint16(respBuf[2:]))
+		if pageLen <= n {
+			return respBuf[:pageLen], nil
+		}
+
+		// Short transfer, or allocation length (limited to 16 bits) too small for a very long page
+		if n < len(respBuf) || len(respBuf) == 0xffff {
+			return truncateLogPage(respBuf[:n]), nil
+		}
+
+		// Retry with a larger buffer if the page did not fit
+		if pageLen > 0xffff {
+			pageLen = 0xffff
+		}
+
+		respBuf = make([]byte, pageLen)
+	}
+}
+
+// ReadLogPage reads and parses a log page via the specified function, which executes a SCSI LOG
+// SENSE CDB, fills buf and returns the number of bytes transferred. This allows log pages to be
+// read through other transports, e.g. RAID controller pass-through.
+func ReadLogPage(page, subpage uint8, logSense func(cdb []byte, buf []byte) (int, error)) (LogPage, error) {
+	buf, err := readLogSense(page, subpage, logSense)
+	if err != nil {
+		return LogPage{}, err
+	}
+
+	lp, err := ParseLogPage(buf)
+	if err != nil {
+		return lp, err
+	}
+
+	// Devices which do not support subpages may ignore the subpage code
+	if lp.Page != page || (lp.SPF || subpage != LOG_SUBPAGE_NONE) && lp.Subpage != subpage {
+		return lp, fmt.Errorf("log page %s: device returned page %s", LogPageID{page, subpage}, lp.LogPageID)
+	}
+
+	return lp, nil
+}
+
+// sendLogSense sends a LOG SENSE CDB to the device, and returns the number of bytes transferred,
+// excluding the residual count reported by the SG driver.
+func (d *SCSIDevice) sendLogSense(cdb []byte, buf []byte) (int, error) {
+	resid, err := d.sendCDBResid(cdb, &buf, SG_DXFER_FROM_DEV, DEFAULT_TIMEOUT)
+	return len(buf) - resid, err
+}
+
+// logSense sends a SCSI LOG SENSE command to a device, and returns the complete log page (including
+// header) of cumulative values.
+func (d *SCSIDevice) logSense(page, subpage uint8) ([]byte, error) {
+	return readLogSense(page, subpage, d.sendLogSense)
+}
+
+// LogPage reads and parses a log page from the device.
+func (d *SCSIDevice) LogPage(page, subpage uint8) (LogPage, error) {
+	return ReadLogPage(page, subpage, d.sendLogSense)
+}
+
+// SupportedLogPages returns the log pages and subpages supported by the device. Devices which do
+// not support subpages only report the supported page codes.
+func (d *SCSIDevice) SupportedLogPages() ([]LogPageID, error) {
+	buf, err := d.logSense(LOG_SUPPORTED_PAGES, LOG_SUBPAGE_SUPPORTED)
+	if err != nil || buf[0]&0x40 == 0 {
+		// Subpages not supported (or subpage code ignored by the device)
+		if buf, err = d.logSense(LOG_SUPPORTED_PAGES, LOG_SUBPAGE_NONE); err != nil {
+			return nil, err
+		}
+	}
+
+	pages, err := DecodeSupportedLogPages(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Page != pages[j].Page {
+			return pages[i].Page < pages[j].Page
+		}
+		return pages[i].Subpage < pages[j].Subpage
+	})
+
+	return pages, nil
+}
+
+// printLogPages decodes and prints those log pages for which a decoder has been registered, except
+// for pages which have already been printed.
+func (d *SCSIDevice) printLogPages(w io.Writer, pages []LogPageID, printed map[LogPageID]bool) {
+	for _, id := range pages {
+		if _, ok := logPageDecoders[id]; !ok || printed[id] {
+			continue
+		}
+
+		lp, err := d.LogPage(id.Page, id.Subpage)
+		if err != nil {
+			fmt.Fprintf(w, "\nCannot read %s log page (%s): %v\n", LogPageName(id), id, err)
+			continue
+		}
+
+		decoded, err := DecodeLogPage(lp)
+		if err != nil {
+			fmt.Fprintf(w, "\nCannot decode %s log page (%s): %v\n", LogPageName(id), id, err)
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s log page (%s):\n", LogPageName(id), id)
+		decoded.Print(w)
+	}
+}
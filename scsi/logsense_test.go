@@ -0,0 +1,144 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogPage(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{0x02, 0x00, 0x00, 0x11,
+		0x00, 0x00, 0x02, 0x02, 0x01, 0x02, // 2-byte counter
+		0x00, 0x06, 0x03, 0x07, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, // 7-byte counter
+	}
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+	assert.Equal(LogPageID{0x02, 0x00}, lp.LogPageID)
+	assert.False(lp.SPF)
+
+	if assert.Len(lp.Params, 2) {
+		assert.Equal(uint64(0x0102), lp.Params[0].Uint64())
+		assert.Equal(uint8(2), lp.Params[0].FormatLinking)
+
+		p, ok := lp.Param(0x0006)
+		assert.True(ok)
+		assert.Equal(uint64(0x010000), p.Uint64())
+		assert.Equal(uint8(3), p.FormatLinking)
+	}
+
+	// Parameter length exceeds page length
+	buf[13] = 0x08
+	_, err = ParseLogPage(buf)
+	assert.Error(err)
+}
+
+func TestReadLogPage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Page 3Dh/03h with eight 256-byte parameters, which do not fit in the initial allocation length
+	page := []byte{0x7d, 0x03, 0x08, 0x00}
+	for i := 0; i < 8; i++ {
+		page = append(append(page, 0x00, byte(i), 0x03, 0xfc), make([]byte, 0xfc)...)
+	}
+
+	var allocLens []int
+	logSense := func(cdb []byte, buf []byte) (int, error) {
+		allocLens = append(allocLens, int(binary.BigEndian.Uint16(cdb[7:])))
+		return copy(buf, page), nil
+	}
+
+	lp, err := ReadLogPage(LOG_FARM, LOG_SUBPAGE_FARM, logSense)
+	assert.NoError(err)
+	assert.Equal([]int{1024, len(page)}, allocLens)
+	assert.Len(lp.Params, 8)
+
+	// Device ignored the subpage code and returned another subpage
+	_, err = ReadLogPage(LOG_FARM, 0x02, logSense)
+	assert.Error(err)
+
+	// Short transfer, with stale data after the transferred bytes
+	shortXfer := func(cdb []byte, buf []byte) (int, error) {
+		for i := range buf {
+			buf[i] = 0xff
+		}
+		return copy(buf, page[:600]), nil
+	}
+
+	lp, err = ReadLogPage(LOG_FARM, LOG_SUBPAGE_FARM, shortXfer)
+	assert.NoError(err)
+	assert.Len(lp.Params, 2)
+}
+
+func TestTruncateLogPage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Page length exceeds the buffer, which ends partway through the second parameter
+	buf := []byte{0x3d, 0x00, 0xff, 0xfb,
+		0x00, 0x00, 0x03, 0x02, 0x01, 0x02,
+		0x00, 0x01, 0x03, 0x08, 0x00, 0x00,
+	}
+
+	buf = truncateLogPage(buf)
+	assert.Len(buf, 10)
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+	assert.Len(lp.Params, 1)
+}
+
+func TestDecodeSupportedLogPages(t *testing.T) {
+	assert := assert.New(t)
+
+	pages, err := DecodeSupportedLogPages([]byte{0x00, 0x00, 0x00, 0x03, 0x00, 0x02, 0x0d})
+	assert.NoError(err)
+	assert.Equal([]LogPageID{{0x00, 0x00}, {0x02, 0x00}, {0x0d, 0x00}}, pages)
+
+	pages, err = DecodeSupportedLogPages([]byte{0x40, 0xff, 0x00, 0x06, 0x00, 0x00, 0x0d, 0x00, 0x0d, 0x01})
+	assert.NoError(err)
+	assert.Equal([]LogPageID{{0x00, 0x00}, {0x0d, 0x00}, {0x0d, 0x01}}, pages)
+	assert.Equal("0dh/01h", pages[2].String())
+}
+
+type testLogPage int
+
+func (p testLogPage) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d parameters\n", int(p))
+}
+
+func TestLogPageDecoderRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterLogPageDecoder(0x3e, 0x01, "Test", func(lp LogPage) (LogPagePrinter, error) {
+		return testLogPage(len(lp.Params)), nil
+	})
+	defer delete(logPageDecoders, LogPageID{0x3e, 0x01})
+
+	assert.Equal("Test", LogPageName(LogPageID{0x3e, 0x01}))
+
+	decoded, err := DecodeLogPage(LogPage{LogPageID: LogPageID{0x3e, 0x01}, Params: make([]LogParameter, 3)})
+	assert.NoError(err)
+	assert.Equal(testLogPage(3), decoded)
+
+	_, err = DecodeLogPage(LogPage{LogPageID: LogPageID{0x3e, 0x02}})
+	assert.Error(err)
+}
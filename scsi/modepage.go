@@ -0,0 +1,263 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI MODE SENSE / MODE SELECT functions.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Length of MODE SENSE(6) / MODE SENSE(10) / MODE SELECT(10) parameter headers
+	MODE_HEADER_6_LEN  = 4
+	MODE_HEADER_10_LEN = 8
+
+	// Length of short and long LBA block descriptors
+	BLOCK_DESC_LEN      = 8
+	LONG_BLOCK_DESC_LEN = 16
+
+	// Subpage code requesting all subpages of a mode page
+	MPAGE_SUBPAGE_ALL = 0xff
+)
+
+// ModeHeader is a decoded mode parameter header.
+type ModeHeader struct {
+	MediumType     uint8
+	DeviceSpecific uint8 // e.g., WP (bit 7) and DPOFUA (bit 4) for direct access block devices
+	LongLBA        bool  // Block descriptors are in long LBA format (MODE SENSE(10) only)
+}
+
+// WriteProtected reports whether the medium is write protected.
+func (h ModeHeader) WriteProtected() bool {
+	return h.DeviceSpecific&0x80 != 0
+}
+
+// BlockDescriptor is a decoded short or long LBA mode parameter block descriptor of a direct access
+// block device.
+type BlockDescriptor struct {
+	Blocks      uint64 // Number of logical blocks
+	BlockLength uint32 // Logical block length in bytes
+}
+
+// ModeParameters is a decoded mode parameter list, as returned by MODE SENSE(6) or MODE SENSE(10).
+type ModeParameters struct {
+	Header           ModeHeader
+	BlockDescriptors []BlockDescriptor
+	Pages            [][]byte // Mode pages, including their page headers
+}
+
+// Page returns the mode page with the specified page and subpage code, or nil if the parameter
+// list does not contain it.
+func (mp ModeParameters) Page(pageNum, subPageNum uint8) []byte {
+	for _, page := range mp.Pages {
+		spf := page[0]&0x40 != 0
+
+		if page[0]&0x3f == pageNum && (!spf && subPageNum == 0 || spf && page[1] == subPageNum) {
+			return page
+		}
+	}
+
+	return nil
+}
+
+// ParseModeParameters decodes a mode parameter list returned by MODE SENSE(6) (if ten is false),
+// or MODE SENSE(10).
+func ParseModeParameters(buf []byte, ten bool) (ModeParameters, error) {
+	var (
+		mp                     ModeParameters
+		dataLen, hdrLen, bdLen int
+	)
+
+	if ten {
+		hdrLen = MODE_HEADER_10_LEN
+		if len(buf) < hdrLen {
+			return mp, fmt.Errorf("mode parameter list: short header (%d bytes)", len(buf))
+		}
+
+		dataLen = 2 + int(binary.BigEndian.Uint16(buf))
+		mp.Header = ModeHeader{MediumType: buf[2], DeviceSpecific: buf[3], LongLBA: buf[4]&0x01 != 0}
+		bdLen = int(binary.BigEndian.Uint16(buf[6:]))
+	} else {
+		hdrLen = MODE_HEADER_6_LEN
+		if len(buf) < hdrLen {
+			return mp, fmt.Errorf("mode parameter list: short header (%d bytes)", len(buf))
+		}
+
+		dataLen = 1 + int(buf[0])
+		mp.Header = ModeHeader{MediumType: buf[1], DeviceSpecific: buf[2]}
+		bdLen = int(buf[3])
+	}
+
+	// Mode data length may exceed the allocation length, in which case the list is truncated
+	if dataLen > len(buf) {
+		dataLen = len(buf)
+	}
+
+	if hdrLen+bdLen > dataLen {
+		return mp, fmt.Errorf("mode parameter list: truncated block descriptors")
+	}
+
+	descLen := BLOCK_DESC_LEN
+	if mp.Header.LongLBA {
+		descLen = LONG_BLOCK_DESC_LEN
+	}
+
+	for bd := buf[hdrLen : hdrLen+bdLen]; len(bd) >= descLen; bd = bd[descLen:] {
+		if mp.Header.LongLBA {
+			mp.BlockDescriptors = append(mp.BlockDescriptors, BlockDescriptor{
+				Blocks:      binary.BigEndian.Uint64(bd),
+				BlockLength: binary.BigEndian.Uint32(bd[12:]),
+			})
+		} else {
+			mp.BlockDescriptors = append(mp.BlockDescriptors, BlockDescriptor{
+				Blocks:      uint64(binary.BigEndian.Uint32(bd)),
+				BlockLength: binary.BigEndian.Uint32(bd[4:]) & 0xffffff,
+			})
+		}
+	}
+
+	for pages := buf[hdrLen+bdLen : dataLen]; len(pages) >= 2; {
+		pageLen := 2 + int(pages[1])
+
+		// Subpage format
+		if pages[0]&0x40 != 0 {
+			if len(pages) < 4 {
+				break
+			}
+			pageLen = 4 + int(binary.BigEndian.Uint16(pages[2:]))
+		}
+
+		if pageLen > len(pages) {
+			break
+		}
+
+		mp.Pages = append(mp.Pages, pages[:pageLen])
+		pages = pages[pageLen:]
+	}
+
+	return mp, nil
+}
+
+// modeSense sends a SCSI MODE SENSE(10) (or MODE SENSE(6), if ten is false) command to a device,
+// and returns the mode parameter list (i.e., header, block descriptors and mode pages).
+func (d *SCSIDevice) modeSense(ten bool, pageNum, subPageNum, pageControl uint8) ([]byte, error) {
+	var (
+		respBuf []byte
+		err     error
+	)
+
+	if ten {
+		respBuf = make([]byte, 512)
+
+		cdb := CDB10{SCSI_MODE_SENSE_10}
+		cdb[2] = (pageControl << 6) | (pageNum & 0x3f)
+		cdb[3] = subPageNum
+		binary.BigEndian.PutUint16(cdb[7:], uint16(len(respBuf)))
+
+		err = d.sendCDB(cdb[:], &respBuf)
+	} else {
+		respBuf = make([]byte, 252)
+
+		cdb := CDB6{SCSI_MODE_SENSE_6}
+		cdb[2] = (pageControl << 6) | (pageNum & 0x3f)
+		cdb[3] = subPageNum
+		cdb[4] = uint8(len(respBuf))
+
+		err = d.sendCDB(cdb[:], &respBuf)
+	}
+
+	return respBuf, err
+}
+
+// ModeSense reads a mode page (or all mode pages, if pageNum is 3Fh) from the device, with the
+// specified page control, e.g. MPAGE_CONTROL_CHANGEABLE. MODE SENSE(10) is used, falling back to
+// MODE SENSE(6) for devices which do not support it.
+func (d *SCSIDevice) ModeSense(pageNum, subPageNum, pageControl uint8) (ModeParameters, error) {
+	if !d.modeSense6Only {
+		buf, err := d.modeSense(true, pageNum, subPageNum, pageControl)
+		if err == nil {
+			return ParseModeParameters(buf, true)
+		}
+
+		// Only fall back if the device rejected the command itself
+		sense, ok := SenseFromError(err)
+		if !ok || sense.Key != SENSE_KEY_ILLEGAL_REQUEST || sense.ASC != 0x20 {
+			return ModeParameters{}, fmt.Errorf("MODE SENSE(10): %v", err)
+		}
+
+		d.modeSense6Only = true
+	}
+
+	buf, err := d.modeSense(false, pageNum, subPageNum, pageControl)
+	if err != nil {
+		return ModeParameters{}, fmt.Errorf("MODE SENSE(6): %v", err)
+	}
+
+	return ParseModeParameters(buf, false)
+}
+
+// ModePage reads a single mode page from the device, including its page header.
+func (d *SCSIDevice) ModePage(pageNum, subPageNum, pageControl uint8) ([]byte, error) {
+	mp, err := d.ModeSense(pageNum, subPageNum, pageControl)
+	if err != nil {
+		return nil, err
+	}
+
+	page := mp.Page(pageNum, subPageNum)
+	if page == nil {
+		return nil, fmt.Errorf("mode page %02xh/%02xh: not returned by device", pageNum, subPageNum)
+	}
+
+	return page, nil
+}
+
+// modeSelect sends a SCSI MODE SELECT(10) (or MODE SELECT(6), if ten is false) command with the
+// specified mode parameter list to a device. If save is true, the device also saves the mode pages
+// to non-volatile storage.
+func (d *SCSIDevice) modeSelect(ten bool, params []byte, save bool) error {
+	var flags uint8 = 0x10 // PF (page format)
+	if save {
+		flags |= 0x01
+	}
+
+	if ten {
+		cdb := CDB10{SCSI_MODE_SELECT_10, flags}
+		binary.BigEndian.PutUint16(cdb[7:], uint16(len(params)))
+
+		return d.sendCDBDir(cdb[:], &params, SG_DXFER_TO_DEV)
+	}
+
+	cdb := CDB6{SCSI_MODE_SELECT_6, flags}
+	cdb[4] = uint8(len(params))
+
+	return d.sendCDBDir(cdb[:], &params, SG_DXFER_TO_DEV)
+}
+
+// setModePage writes a mode page, previously read with ModePage and modified, back to the device.
+// The mode parameter list has no block descriptors, and uses the same header format as ModeSense.
+func (d *SCSIDevice) setModePage(page []byte, save bool) error {
+	hdrLen := MODE_HEADER_10_LEN
+	if d.modeSense6Only {
+		hdrLen = MODE_HEADER_6_LEN
+	}
+
+	// Mode data length is reserved for MODE SELECT, as is the PS bit of the mode page
+	params := append(make([]byte, hdrLen), page...)
+	params[hdrLen] &^= 0x80
+
+	return d.modeSelect(!d.modeSense6Only, params, save)
+}
@@ -0,0 +1,92 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Caching mode page with WCE set and read-ahead disabled
+var testCachingPage = []byte{
+	0x88, 0x12, 0x04, 0x00, 0xff, 0xff, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x20, 0x14, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+func TestParseModeParameters6(t *testing.T) {
+	buf := append([]byte{0x00, 0x00, 0x10, 0x08, 0x00, 0x12, 0x34, 0x56, 0x00, 0x00, 0x02, 0x00},
+		testCachingPage...)
+	buf[0] = byte(len(buf) - 1)
+
+	mp, err := ParseModeParameters(buf, false)
+	assert.NoError(t, err)
+	assert.False(t, mp.Header.WriteProtected())
+	assert.Equal(t, []BlockDescriptor{{Blocks: 0x123456, BlockLength: 512}}, mp.BlockDescriptors)
+	assert.Len(t, mp.Pages, 1)
+
+	cache, err := DecodeCachingPage(mp.Page(CACHING_PAGE, 0))
+	assert.NoError(t, err)
+	assert.True(t, cache.WCE)
+	assert.False(t, cache.RCD)
+	assert.True(t, cache.DRA)
+	assert.Equal(t, uint8(0x14), cache.NumCacheSegments)
+
+	assert.Nil(t, mp.Page(CONTROL_PAGE, 0))
+}
+
+func TestParseModeParameters10(t *testing.T) {
+	control := []byte{0x0a, 0x0a, 0x04, 0x10, 0x00, 0x40, 0xff, 0xff, 0x00, 0x00, 0x1c, 0x20}
+
+	// Long LBA block descriptor
+	buf := []byte{0x00, 0x00, 0x00, 0x80, 0x01, 0x00, 0x00, 0x10,
+		0x00, 0x00, 0x00, 0x03, 0xa3, 0x81, 0x2a, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00}
+	buf = append(buf, control...)
+	buf[1] = byte(len(buf) - 2)
+
+	mp, err := ParseModeParameters(buf, true)
+	assert.NoError(t, err)
+	assert.True(t, mp.Header.LongLBA)
+	assert.True(t, mp.Header.WriteProtected())
+	assert.Equal(t, []BlockDescriptor{{Blocks: 0x3a3812ab0, BlockLength: 4096}}, mp.BlockDescriptors)
+
+	ctl, err := DecodeControlPage(mp.Page(CONTROL_PAGE, 0))
+	assert.NoError(t, err)
+	assert.True(t, ctl.DSense)
+	assert.True(t, ctl.TAS)
+	assert.Equal(t, uint8(1), ctl.QueueAlgorithmModifier)
+	assert.Equal(t, uint16(7200), ctl.ExtendedSelfTestSeconds)
+
+	// Truncated block descriptors
+	_, err = ParseModeParameters(buf[:12], true)
+	assert.Error(t, err)
+}
+
+func TestDecodePowerConditionPage(t *testing.T) {
+	page := make([]byte, 40)
+	copy(page, []byte{0x1a, 0x26, 0x40, 0x03, 0x00, 0x00, 0x00, 0x32, 0x00, 0x00, 0x23, 0x28})
+
+	pc, err := DecodePowerConditionPage(page)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(1), pc.PMBGPrecedence)
+	assert.True(t, pc.IdleA)
+	assert.True(t, pc.StandbyZ)
+	assert.False(t, pc.IdleB)
+	assert.Equal(t, uint32(50), pc.IdleATimer)
+	assert.Equal(t, uint32(9000), pc.StandbyZTimer)
+
+	_, err = DecodePowerConditionPage(testCachingPage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,266 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Decoders for common SCSI mode pages.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// checkModePage verifies the page code of a (page_0 format) mode page and its minimum length.
+func checkModePage(page []byte, pageNum uint8, minLen int) error {
+	if len(page) < 2 {
+		return fmt.Errorf("mode page %02xh: short page (%d bytes)", pageNum, len(page))
+	}
+
+	if page[0]&0x3f != pageNum || page[0]&0x40 != 0 {
+		return fmt.Errorf("mode page %02xh: device returned page %02xh", pageNum, page[0]&0x3f)
+	}
+
+	if len(page) < minLen {
+		return fmt.Errorf("mode page %02xh: short page (%d bytes)", pageNum, len(page))
+	}
+
+	return nil
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "Enabled"
+	}
+
+	return "Disabled"
+}
+
+// ReadWriteErrorRecoveryPage is the decoded Read-Write Error Recovery mode page (01h).
+type ReadWriteErrorRecoveryPage struct {
+	AWRE              bool // Automatic write reallocation enabled
+	ARRE              bool // Automatic read reallocation enabled
+	TB                bool // Transfer block
+	RC                bool // Read continuous
+	EER               bool // Enable early recovery
+	PER               bool // Post error
+	DTE               bool // Data terminate on error
+	DCR               bool // Disable correction
+	ReadRetryCount    uint8
+	WriteRetryCount   uint8
+	RecoveryTimeLimit uint16 // In ms
+}
+
+// DecodeReadWriteErrorRecoveryPage decodes the Read-Write Error Recovery mode page (01h).
+func DecodeReadWriteErrorRecoveryPage(page []byte) (ReadWriteErrorRecoveryPage, error) {
+	var p ReadWriteErrorRecoveryPage
+
+	if err := checkModePage(page, READ_WRITE_ERROR_RECOVERY_PAGE, 12); err != nil {
+		return p, err
+	}
+
+	p.AWRE = page[2]&0x80 != 0
+	p.ARRE = page[2]&0x40 != 0
+	p.TB = page[2]&0x20 != 0
+	p.RC = page[2]&0x10 != 0
+	p.EER = page[2]&0x08 != 0
+	p.PER = page[2]&0x04 != 0
+	p.DTE = page[2]&0x02 != 0
+	p.DCR = page[2]&0x01 != 0
+	p.ReadRetryCount = page[3]
+	p.WriteRetryCount = page[8]
+	p.RecoveryTimeLimit = binary.BigEndian.Uint16(page[10:])
+
+	return p, nil
+}
+
+// CachingPage is the decoded Caching mode page (08h).
+type CachingPage struct {
+	IC    bool // Initiator control
+	ABPF  bool // Abort pre-fetch
+	CAP   bool // Caching analysis permitted
+	DISC  bool // Discontinuity
+	SIZE  bool // Size enable
+	WCE   bool // Write cache enable
+	MF    bool // Multiplication factor
+	RCD   bool // Read cache disable
+	FSW   bool // Force sequential write
+	LBCSS bool // Logical block cache segment size
+	DRA   bool // Disable read-ahead
+	NVDIS bool // Non-volatile cache disabled
+
+	DemandReadRetention uint8
+	WriteRetention      uint8
+	DisablePrefetchLen  uint16 // Disable pre-fetch transfer length
+	MinPrefetch         uint16
+	MaxPrefetch         uint16
+	MaxPrefetchCeiling  uint16
+	NumCacheSegments    uint8
+	CacheSegmentSize    uint16
+}
+
+// DecodeCachingPage decodes the Caching mode page (08h).
+func DecodeCachingPage(page []byte) (CachingPage, error) {
+	var p CachingPage
+
+	if err := checkModePage(page, CACHING_PAGE, 20); err != nil {
+		return p, err
+	}
+
+	p.IC = page[2]&0x80 != 0
+	p.ABPF = page[2]&0x40 != 0
+	p.CAP = page[2]&0x20 != 0
+	p.DISC = page[2]&0x10 != 0
+	p.SIZE = page[2]&0x08 != 0
+	p.WCE = page[2]&0x04 != 0
+	p.MF = page[2]&0x02 != 0
+	p.RCD = page[2]&0x01 != 0
+	p.DemandReadRetention = page[3] >> 4
+	p.WriteRetention = page[3] & 0x0f
+	p.DisablePrefetchLen = binary.BigEndian.Uint16(page[4:])
+	p.MinPrefetch = binary.BigEndian.Uint16(page[6:])
+	p.MaxPrefetch = binary.BigEndian.Uint16(page[8:])
+	p.MaxPrefetchCeiling = binary.BigEndian.Uint16(page[10:])
+	p.FSW = page[12]&0x80 != 0
+	p.LBCSS = page[12]&0x40 != 0
+	p.DRA = page[12]&0x20 != 0
+	p.NVDIS = page[12]&0x01 != 0
+	p.NumCacheSegments = page[13]
+	p.CacheSegmentSize = binary.BigEndian.Uint16(page[14:])
+
+	return p, nil
+}
+
+// ControlPage is the decoded Control mode page (0Ah).
+type ControlPage struct {
+	TST                     uint8 // Task set type
+	TMFOnly                 bool  // Allow task management functions only
+	DPICZ                   bool  // Disable protection information check if protect field is zero
+	DSense                  bool  // Descriptor format sense data
+	GLTSD                   bool  // Global logging target save disable
+	RLEC                    bool  // Report log exception condition
+	QueueAlgorithmModifier  uint8
+	QErr                    uint8  // Queue error management
+	ATO                     bool   // Application tag owner
+	TAS                     bool   // Task aborted status
+	BusyTimeout             uint16 // In units of 100 ms, FFFFh = unlimited
+	ExtendedSelfTestSeconds uint16 // Extended self-test completion time, in seconds
+}
+
+// DecodeControlPage decodes the Control mode page (0Ah).
+func DecodeControlPage(page []byte) (ControlPage, error) {
+	var p ControlPage
+
+	if err := checkModePage(page, CONTROL_PAGE, 12); err != nil {
+		return p, err
+	}
+
+	p.TST = page[2] >> 5
+	p.TMFOnly = page[2]&0x10 != 0
+	p.DPICZ = page[2]&0x08 != 0
+	p.DSense = page[2]&0x04 != 0
+	p.GLTSD = page[2]&0x02 != 0
+	p.RLEC = page[2]&0x01 != 0
+	p.QueueAlgorithmModifier = page[3] >> 4
+	p.QErr = (page[3] >> 1) & 0x03
+	p.ATO = page[5]&0x80 != 0
+	p.TAS = page[5]&0x40 != 0
+	p.BusyTimeout = binary.BigEndian.Uint16(page[8:])
+	p.ExtendedSelfTestSeconds = binary.BigEndian.Uint16(page[10:])
+
+	return p, nil
+}
+
+// PowerConditionPage is the decoded Power Condition mode page (1Ah). Timers are in units of
+// 100 ms.
+type PowerConditionPage struct {
+	PMBGPrecedence uint8 // Power management / background functions precedence
+	StandbyY       bool
+	IdleC          bool
+	IdleB          bool
+	IdleA          bool
+	StandbyZ       bool
+	IdleATimer     uint32
+	StandbyZTimer  uint32
+	IdleBTimer     uint32
+	IdleCTimer     uint32
+	StandbyYTimer  uint32
+}
+
+// DecodePowerConditionPage decodes the Power Condition mode page (1Ah). Older devices only report
+// the idle and standby (i.e., idle_a and standby_z) conditions.
+func DecodePowerConditionPage(page []byte) (PowerConditionPage, error) {
+	var p PowerConditionPage
+
+	if err := checkModePage(page, POWER_CONDITION_PAGE, 12); err != nil {
+		return p, err
+	}
+
+	p.PMBGPrecedence = page[2] >> 6
+	p.StandbyY = page[2]&0x01 != 0
+	p.IdleC = page[3]&0x08 != 0
+	p.IdleB = page[3]&0x04 != 0
+	p.IdleA = page[3]&0x02 != 0
+	p.StandbyZ = page[3]&0x01 != 0
+	p.IdleATimer = binary.BigEndian.Uint32(page[4:])
+	p.StandbyZTimer = binary.BigEndian.Uint32(page[8:])
+
+	if len(page) >= 24 {
+		p.IdleBTimer = binary.BigEndian.Uint32(page[12:])
+		p.IdleCTimer = binary.BigEndian.Uint32(page[16:])
+		p.StandbyYTimer = binary.BigEndian.Uint32(page[20:])
+	}
+
+	return p, nil
+}
+
+// ReadWriteErrorRecoveryPage reads the Read-Write Error Recovery mode page with the specified page
+// control, e.g. MPAGE_CONTROL_CURRENT.
+func (d *SCSIDevice) ReadWriteErrorRecoveryPage(pageControl uint8) (ReadWriteErrorRecoveryPage, error) {
+	page, err := d.ModePage(READ_WRITE_ERROR_RECOVERY_PAGE, 0, pageControl)
+	if err != nil {
+		return ReadWriteErrorRecoveryPage{}, err
+	}
+
+	return DecodeReadWriteErrorRecoveryPage(page)
+}
+
+// CachingPage reads the Caching mode page with the specified page control.
+func (d *SCSIDevice) CachingPage(pageControl uint8) (CachingPage, error) {
+	page, err := d.ModePage(CACHING_PAGE, 0, pageControl)
+	if err != nil {
+		return CachingPage{}, err
+	}
+
+	return DecodeCachingPage(page)
+}
+
+// ControlPage reads the Control mode page with the specified page control.
+func (d *SCSIDevice) ControlPage(pageControl uint8) (ControlPage, error) {
+	page, err := d.ModePage(CONTROL_PAGE, 0, pageControl)
+	if err != nil {
+		return ControlPage{}, err
+	}
+
+	return DecodeControlPage(page)
+}
+
+// PowerConditionPage reads the Power Condition mode page with the specified page control.
+func (d *SCSIDevice) PowerConditionPage(pageControl uint8) (PowerConditionPage, error) {
+	page, err := d.ModePage(POWER_CONDITION_PAGE, 0, pageControl)
+	if err != nil {
+		return PowerConditionPage{}, err
+	}
+
+	return DecodePowerConditionPage(page)
+}
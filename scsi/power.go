@@ -0,0 +1,222 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI power conditions.
+
+package scsi
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// Power condition transitions log page code
+	LOG_POWER_CONDITION_TRANSITIONS = 0x1a
+
+	// START STOP UNIT power conditions
+	POWER_CONDITION_START_VALID     = 0x0
+	POWER_CONDITION_ACTIVE          = 0x1
+	POWER_CONDITION_IDLE            = 0x2
+	POWER_CONDITION_STANDBY         = 0x3
+	POWER_CONDITION_LU_CONTROL      = 0x7
+	POWER_CONDITION_FORCE_IDLE_0    = 0xa
+	POWER_CONDITION_FORCE_STANDBY_0 = 0xb
+
+	// START STOP UNIT power condition modifiers
+	POWER_MODIFIER_IDLE_A    = 0x0
+	POWER_MODIFIER_IDLE_B    = 0x1
+	POWER_MODIFIER_IDLE_C    = 0x2
+	POWER_MODIFIER_STANDBY_Z = 0x0
+	POWER_MODIFIER_STANDBY_Y = 0x1
+
+	// Additional sense code reported by REQUEST SENSE in low power conditions
+	ASC_LOW_POWER_CONDITION = 0x5e
+
+	// Spinning up a drive may take considerably longer than the default timeout
+	startStopTimeout = 2 * 60 * 1000
+)
+
+// PowerState is the power condition of a device, as reported by REQUEST SENSE.
+type PowerState int
+
+const (
+	PowerStateUnknown PowerState = iota
+	PowerStateActive
+	PowerStateIdleA
+	PowerStateIdleB
+	PowerStateIdleC
+	PowerStateStandbyY
+	PowerStateStandbyZ
+)
+
+func (s PowerState) String() string {
+	switch s {
+	case PowerStateActive:
+		return "active"
+	case PowerStateIdleA:
+		return "idle_a"
+	case PowerStateIdleB:
+		return "idle_b"
+	case PowerStateIdleC:
+		return "idle_c"
+	case PowerStateStandbyY:
+		return "standby_y"
+	case PowerStateStandbyZ:
+		return "standby_z"
+	}
+
+	return "unknown"
+}
+
+// PowerState returns the power condition indicated by sense data returned by REQUEST SENSE.
+func (s SenseData) PowerState() PowerState {
+	if s.Key != SENSE_KEY_NO_SENSE {
+		return PowerStateUnknown
+	}
+
+	if s.ASC != ASC_LOW_POWER_CONDITION {
+		return PowerStateActive
+	}
+
+	switch s.ASCQ {
+	case 0x01, 0x03:
+		return PowerStateIdleA
+	case 0x02, 0x04:
+		return PowerStateStandbyZ
+	case 0x05, 0x06:
+		return PowerStateIdleB
+	case 0x07, 0x08:
+		return PowerStateIdleC
+	case 0x09, 0x0a:
+		return PowerStateStandbyY
+	}
+
+	return PowerStateUnknown
+}
+
+// PowerState returns the current power condition of the device. REQUEST SENSE does not cause the
+// device to leave a low power condition, so this does not wake a drive in standby.
+func (d *SCSIDevice) PowerState() (PowerState, error) {
+	sense, err := d.RequestSense()
+	if err != nil {
+		return PowerStateUnknown, err
+	}
+
+	return sense.PowerState(), nil
+}
+
+// StartStopUnit sends a SCSI START STOP UNIT command to a device, to change its power condition,
+// e.g. POWER_CONDITION_STANDBY with POWER_MODIFIER_STANDBY_Z. If condition is
+// POWER_CONDITION_START_VALID, start specifies whether to spin up or spin down the device instead.
+func (d *SCSIDevice) StartStopUnit(condition, modifier uint8, start bool) error {
+	cdb := CDB6{SCSI_START_STOP_UNIT}
+	cdb[3] = modifier & 0x0f
+	cdb[4] = condition << 4
+	if start {
+		cdb[4] |= 0x01
+	}
+
+	if err := d.sendCDBTimeout(cdb[:], nil, SG_DXFER_NONE, startStopTimeout); err != nil {
+		return fmt.Errorf("START STOP UNIT: %v", err)
+	}
+
+	return nil
+}
+
+// Standby puts the device into the standby_z power condition, i.e. spins it down.
+func (d *SCSIDevice) Standby() error {
+	return d.StartStopUnit(POWER_CONDITION_STANDBY, POWER_MODIFIER_STANDBY_Z, false)
+}
+
+// PowerConditionTransitions is the decoded power condition transitions log page (1Ah).
+type PowerConditionTransitions struct {
+	Active   uint32 // Accumulated transitions to active
+	IdleA    uint32
+	IdleB    uint32
+	IdleC    uint32
+	StandbyZ uint32
+	StandbyY uint32
+}
+
+// DecodePowerConditionTransitions decodes the power condition transitions log page (1Ah).
+func DecodePowerConditionTransitions(lp LogPage) (PowerConditionTransitions, error) {
+	var pct PowerConditionTransitions
+
+	if lp.LogPageID != (LogPageID{LOG_POWER_CONDITION_TRANSITIONS, LOG_SUBPAGE_NONE}) {
+		return pct, fmt.Errorf("log page %s: not a power condition transitions page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		switch p.Code {
+		case 0x0001:
+			pct.Active = uint32(p.Uint64())
+		case 0x0002:
+			pct.IdleA = uint32(p.Uint64())
+		case 0x0003:
+			pct.IdleB = uint32(p.Uint64())
+		case 0x0004:
+			pct.IdleC = uint32(p.Uint64())
+		case 0x0008:
+			pct.StandbyZ = uint32(p.Uint64())
+		case 0x0009:
+			pct.StandbyY = uint32(p.Uint64())
+		}
+	}
+
+	return pct, nil
+}
+
+func (pct PowerConditionTransitions) Print(w io.Writer) {
+	fmt.Fprintf(w, "Accumulated transitions to active: %d\n", pct.Active)
+	fmt.Fprintf(w, "Accumulated transitions to idle_a: %d\n", pct.IdleA)
+	fmt.Fprintf(w, "Accumulated transitions to idle_b: %d\n", pct.IdleB)
+	fmt.Fprintf(w, "Accumulated transitions to idle_c: %d\n", pct.IdleC)
+	fmt.Fprintf(w, "Accumulated transitions to standby_z: %d\n", pct.StandbyZ)
+	fmt.Fprintf(w, "Accumulated transitions to standby_y: %d\n", pct.StandbyY)
+}
+
+// PowerConditionTransitions reads the power condition transition counters of the device.
+func (d *SCSIDevice) PowerConditionTransitions() (PowerConditionTransitions, error) {
+	lp, err := d.LogPage(LOG_POWER_CONDITION_TRANSITIONS, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return PowerConditionTransitions{}, err
+	}
+
+	return DecodePowerConditionTransitions(lp)
+}
+
+// formatPowerTimer formats a power condition timer (in units of 100 ms).
+func formatPowerTimer(enabled bool, timer uint32) string {
+	if !enabled {
+		return "disabled"
+	}
+
+	return fmt.Sprintf("%.1f s", float64(timer)/10)
+}
+
+func (p PowerConditionPage) Print(w io.Writer) {
+	fmt.Fprintf(w, "idle_a timer: %s\n", formatPowerTimer(p.IdleA, p.IdleATimer))
+	fmt.Fprintf(w, "idle_b timer: %s\n", formatPowerTimer(p.IdleB, p.IdleBTimer))
+	fmt.Fprintf(w, "idle_c timer: %s\n", formatPowerTimer(p.IdleC, p.IdleCTimer))
+	fmt.Fprintf(w, "standby_y timer: %s\n", formatPowerTimer(p.StandbyY, p.StandbyYTimer))
+	fmt.Fprintf(w, "standby_z timer: %s\n", formatPowerTimer(p.StandbyZ, p.StandbyZTimer))
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_POWER_CONDITION_TRANSITIONS, LOG_SUBPAGE_NONE, "Power condition transitions",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodePowerConditionTransitions(lp)
+		})
+}
@@ -0,0 +1,54 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerState(t *testing.T) {
+	assert := assert.New(t)
+
+	// NO SENSE, standby condition activated by command
+	sense, ok := ParseSense([]byte{0x70, 0x00, 0x00, 0, 0, 0, 0, 0x0a, 0, 0, 0, 0, 0x5e, 0x04, 0x00, 0x00, 0x00, 0x00})
+	assert.True(ok)
+	assert.Equal(PowerStateStandbyZ, sense.PowerState())
+
+	sense.ASC, sense.ASCQ = 0, 0
+	assert.Equal(PowerStateActive, sense.PowerState())
+
+	sense.Key = SENSE_KEY_NOT_READY
+	assert.Equal(PowerStateUnknown, sense.PowerState())
+}
+
+func TestDecodePowerConditionTransitions(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{
+		LOG_POWER_CONDITION_TRANSITIONS, 0x00, 0x00, 0x18,
+		0x00, 0x01, 0x03, 0x04, 0x00, 0x00, 0x01, 0x00,
+		0x00, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x20,
+		0x00, 0x08, 0x03, 0x04, 0x00, 0x00, 0x00, 0x05,
+	}
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	pct, err := DecodePowerConditionTransitions(lp)
+	assert.NoError(err)
+	assert.Equal(PowerConditionTransitions{Active: 256, IdleA: 32, StandbyZ: 5}, pct)
+}
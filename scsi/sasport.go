@@ -0,0 +1,197 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI protocol-specific port log page (SAS).
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// Protocol-specific port log page code
+	LOG_PROTOCOL_SPECIFIC_PORT = 0x18
+
+	// Protocol identifier of SAS (SPL)
+	PROTOCOL_ID_SAS = 0x6
+)
+
+const (
+	// Minimum length of SAS phy log descriptor, including 4 byte header
+	sasPhyDescLen = 48
+)
+
+var sasDeviceTypeNames = []string{
+	"no device attached",
+	"SAS or SATA device",
+	"expander device",
+	"expander device (fanout)",
+}
+
+var sasLinkRateNames = map[uint8]string{
+	0x0: "phy enabled; unknown",
+	0x1: "phy disabled",
+	0x2: "phy enabled; speed negotiation failed",
+	0x3: "phy enabled; SATA spinup hold state",
+	0x4: "phy enabled; port selector",
+	0x5: "phy enabled; reset in progress",
+	0x6: "phy enabled; unsupported phy attached",
+	0x8: "phy enabled; 1.5 Gbps",
+	0x9: "phy enabled; 3 Gbps",
+	0xa: "phy enabled; 6 Gbps",
+	0xb: "phy enabled; 12 Gbps",
+	0xc: "phy enabled; 22.5 Gbps",
+}
+
+// SASPhy is a SAS phy log descriptor of the protocol-specific port log page (18h).
+type SASPhy struct {
+	ID                   uint8
+	AttachedDeviceType   uint8
+	AttachedReason       uint8
+	Reason               uint8
+	LinkRate             uint8 // Negotiated logical link rate
+	AttachedInitiators   uint8 // Attached SSP (bit 3), STP (bit 2) and SMP (bit 1) initiator ports
+	AttachedTargets      uint8 // Attached SSP (bit 3), STP (bit 2) and SMP (bit 1) target ports
+	SASAddress           uint64
+	AttachedSASAddress   uint64
+	AttachedPhyID        uint8
+	InvalidDwords        uint32
+	RunningDisparityErrs uint32
+	LossOfDwordSync      uint32
+	PhyResetProblems     uint32
+}
+
+// LinkRateString returns a description of the negotiated logical link rate.
+func (p SASPhy) LinkRateString() string {
+	if s, ok := sasLinkRateNames[p.LinkRate]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("reserved [%d]", p.LinkRate)
+}
+
+// AttachedDeviceTypeString returns a description of the attached device type.
+func (p SASPhy) AttachedDeviceTypeString() string {
+	if int(p.AttachedDeviceType) < len(sasDeviceTypeNames) {
+		return sasDeviceTypeNames[p.AttachedDeviceType]
+	}
+
+	return fmt.Sprintf("reserved [%d]", p.AttachedDeviceType)
+}
+
+// SASPort is a port parameter of the protocol-specific port log page (18h).
+type SASPort struct {
+	RelativeTargetPort uint16
+	GenerationCode     uint8
+	Phys               []SASPhy
+}
+
+// SASPortLog is the decoded protocol-specific port log page (18h) of a SAS device.
+type SASPortLog []SASPort
+
+// DecodeSASPortLog decodes the protocol-specific port log page (18h). It returns an error if the
+// page does not describe SAS ports.
+func DecodeSASPortLog(lp LogPage) (SASPortLog, error) {
+	var ports SASPortLog
+
+	if lp.LogPageID != (LogPageID{LOG_PROTOCOL_SPECIFIC_PORT, LOG_SUBPAGE_NONE}) {
+		return nil, fmt.Errorf("log page %s: not a protocol-specific port page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		v := p.Value
+
+		if len(v) < 4 {
+			return nil, fmt.Errorf("log page %s: short port parameter %04xh", lp.LogPageID, p.Code)
+		}
+
+		if v[0]&0x0f != PROTOCOL_ID_SAS {
+			return nil, fmt.Errorf("log page %s: unsupported protocol identifier %d", lp.LogPageID, v[0]&0x0f)
+		}
+
+		port := SASPort{RelativeTargetPort: p.Code, GenerationCode: v[2]}
+		numPhys := int(v[3])
+
+		for desc := v[4:]; len(port.Phys) < numPhys && len(desc) >= 4; {
+			descLen := 4 + int(desc[3])
+			if descLen < sasPhyDescLen || descLen > len(desc) {
+				return nil, fmt.Errorf("log page %s: truncated phy descriptor", lp.LogPageID)
+			}
+
+			port.Phys = append(port.Phys, SASPhy{
+				ID:                   desc[1],
+				AttachedDeviceType:   (desc[4] >> 4) & 0x07,
+				AttachedReason:       desc[4] & 0x0f,
+				Reason:               desc[5] >> 4,
+				LinkRate:             desc[5] & 0x0f,
+				AttachedInitiators:   desc[6] & 0x0e,
+				AttachedTargets:      desc[7] & 0x0e,
+				SASAddress:           binary.BigEndian.Uint64(desc[8:]),
+				AttachedSASAddress:   binary.BigEndian.Uint64(desc[16:]),
+				AttachedPhyID:        desc[24],
+				InvalidDwords:        binary.BigEndian.Uint32(desc[32:]),
+				RunningDisparityErrs: binary.BigEndian.Uint32(desc[36:]),
+				LossOfDwordSync:      binary.BigEndian.Uint32(desc[40:]),
+				PhyResetProblems:     binary.BigEndian.Uint32(desc[44:]),
+			})
+
+			desc = desc[descLen:]
+		}
+
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+func (l SASPortLog) Print(w io.Writer) {
+	for _, port := range l {
+		fmt.Fprintf(w, "relative target port id = %d\n", port.RelativeTargetPort)
+		fmt.Fprintf(w, "  generation code = %d\n", port.GenerationCode)
+		fmt.Fprintf(w, "  number of phys = %d\n", len(port.Phys))
+
+		for _, phy := range port.Phys {
+			fmt.Fprintf(w, "  phy identifier = %d\n", phy.ID)
+			fmt.Fprintf(w, "    attached device type: %s\n", phy.AttachedDeviceTypeString())
+			fmt.Fprintf(w, "    negotiated logical link rate: %s\n", phy.LinkRateString())
+			fmt.Fprintf(w, "    SAS address = 0x%x\n", phy.SASAddress)
+			fmt.Fprintf(w, "    attached SAS address = 0x%x\n", phy.AttachedSASAddress)
+			fmt.Fprintf(w, "    attached phy identifier = %d\n", phy.AttachedPhyID)
+			fmt.Fprintf(w, "    Invalid DWORD count = %d\n", phy.InvalidDwords)
+			fmt.Fprintf(w, "    Running disparity error count = %d\n", phy.RunningDisparityErrs)
+			fmt.Fprintf(w, "    Loss of DWORD synchronization = %d\n", phy.LossOfDwordSync)
+			fmt.Fprintf(w, "    Phy reset problem = %d\n", phy.PhyResetProblems)
+		}
+	}
+}
+
+// SASPortLog reads the SAS phy error counters of the device.
+func (d *SCSIDevice) SASPortLog() (SASPortLog, error) {
+	lp, err := d.LogPage(LOG_PROTOCOL_SPECIFIC_PORT, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeSASPortLog(lp)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_PROTOCOL_SPECIFIC_PORT, LOG_SUBPAGE_NONE, "Protocol-specific port",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeSASPortLog(lp)
+		})
+}
@@ -0,0 +1,68 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSASPortLog(t *testing.T) {
+	assert := assert.New(t)
+
+	phy := make([]byte, 48)
+	phy[1] = 0x00                                            // phy identifier
+	phy[3] = 0x2c                                            // descriptor length
+	phy[4] = 0x10                                            // end device attached
+	phy[5] = 0x0b                                            // 12 Gbps
+	binary.BigEndian.PutUint64(phy[8:], 0x5000c500a1b2c3d5)  // SAS address
+	binary.BigEndian.PutUint64(phy[16:], 0x500605b00d1e2f30) // attached SAS address
+	phy[24] = 0x04                                           // attached phy identifier
+	binary.BigEndian.PutUint32(phy[32:], 17)                 // invalid dwords
+	binary.BigEndian.PutUint32(phy[36:], 11)                 // running disparity errors
+	binary.BigEndian.PutUint32(phy[40:], 2)                  // loss of dword sync
+	binary.BigEndian.PutUint32(phy[44:], 1)                  // phy reset problems
+
+	param := append([]byte{0x00, 0x01, 0x03, byte(4 + len(phy)), PROTOCOL_ID_SAS, 0x00, 0x00, 0x01}, phy...)
+	buf := append([]byte{LOG_PROTOCOL_SPECIFIC_PORT, 0x00, 0x00, byte(len(param))}, param...)
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	ports, err := DecodeSASPortLog(lp)
+	assert.NoError(err)
+	assert.Len(ports, 1)
+	assert.Equal(uint16(1), ports[0].RelativeTargetPort)
+	assert.Len(ports[0].Phys, 1)
+
+	p := ports[0].Phys[0]
+	assert.Equal("SAS or SATA device", p.AttachedDeviceTypeString())
+	assert.Equal("phy enabled; 12 Gbps", p.LinkRateString())
+	assert.Equal(uint64(0x5000c500a1b2c3d5), p.SASAddress)
+	assert.Equal(uint64(0x500605b00d1e2f30), p.AttachedSASAddress)
+	assert.Equal(uint8(4), p.AttachedPhyID)
+	assert.Equal(uint32(17), p.InvalidDwords)
+	assert.Equal(uint32(11), p.RunningDisparityErrs)
+	assert.Equal(uint32(2), p.LossOfDwordSync)
+	assert.Equal(uint32(1), p.PhyResetProblems)
+
+	// Non-SAS protocol
+	buf[8] = 0x0
+	lp, _ = ParseLogPage(buf)
+	_, err = DecodeSASPortLog(lp)
+	assert.Error(err)
+}
@@ -33,6 +33,65 @@ type SATDevice struct {
 	SCSIDevice
 }
 
+// ATAInformation is the decoded ATA Information VPD page (89h), which a SAT layer populates with the
+// identity of the translation layer and the IDENTIFY data of the ATA device behind it.
+type ATAInformation struct {
+	SATVendor    string // SAT layer vendor identification
+	SATProduct   string // SAT layer product identification
+	SATRevision  string // SAT layer product revision level
+	Signature    [20]byte
+	CommandCode  uint8 // Command used to obtain IdentifyData (ECh = IDENTIFY DEVICE)
+	IdentifyData ata.IdentifyDeviceData
+}
+
+// SATIdentity returns the vendor, product and revision of the SAT layer.
+func (a ATAInformation) SATIdentity() string {
+	return fmt.Sprintf("%s %s %s", a.SATVendor, a.SATProduct, a.SATRevision)
+}
+
+// DecodeATAInformation decodes the ATA Information VPD page (89h).
+func DecodeATAInformation(buf []byte) (ATAInformation, error) {
+	var info ATAInformation
+
+	data, err := checkVPDPage(buf, VPD_ATA_INFORMATION)
+	if err != nil {
+		return info, err
+	}
+
+	// Payload is 4 reserved bytes, SAT identity, device signature, command code, 3 reserved bytes,
+	// followed by 512 bytes of IDENTIFY data.
+	if len(data) < 568 {
+		return info, fmt.Errorf("VPD page %#02x: short page (%d bytes)", VPD_ATA_INFORMATION, len(data))
+	}
+
+	info.SATVendor = string(bytes.TrimSpace(data[4:12]))
+	info.SATProduct = string(bytes.TrimSpace(data[12:28]))
+	info.SATRevision = string(bytes.TrimSpace(data[28:32]))
+	copy(info.Signature[:], data[32:52])
+	info.CommandCode = data[52]
+
+	binary.Read(bytes.NewBuffer(data[56:568]), utils.NativeEndian, &info.IdentifyData)
+
+	return info, nil
+}
+
+// ATAInformation returns the ATA Information VPD page of the device.
+func (d *SCSIDevice) ATAInformation() (ATAInformation, error) {
+	buf, err := d.inquiryVPD(VPD_ATA_INFORMATION)
+	if err != nil {
+		return ATAInformation{}, err
+	}
+
+	return DecodeATAInformation(buf)
+}
+
+// sameDevice reports whether two sets of IDENTIFY data describe the same device.
+func sameDevice(a, b *ata.IdentifyDeviceData) bool {
+	return bytes.Equal(bytes.TrimSpace(a.ModelNumber()), bytes.TrimSpace(b.ModelNumber())) &&
+		bytes.Equal(bytes.TrimSpace(a.SerialNumber()), bytes.TrimSpace(b.SerialNumber()))
+}
+
+// identify sends an ATA IDENTIFY DEVICE command to the device via SCSI pass-through.
 func (d *SATDevice) identify() (ata.IdentifyDeviceData, error) {
 	var identBuf ata.IdentifyDeviceData
 
@@ -82,11 +141,29 @@ func (d *SATDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
 
 	fmt.Fprintln(w, "SCSI INQUIRY:", inqResp)
 
+	// SAT layers which support the ATA Information VPD page also tell us who they are, and have a
+	// cached copy of the IDENTIFY data, which is useful if pass-through is unreliable.
+	ataInfo, vpdErr := d.ATAInformation()
+	if vpdErr == nil {
+		fmt.Fprintln(w, "SAT layer:", ataInfo.SATIdentity())
+	}
+
 	identBuf, err := d.identify()
 	if err != nil {
-		return err
+		if vpdErr != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "ATA IDENTIFY failed (%v), using IDENTIFY data from ATA Information VPD page\n", err)
+		identBuf = ataInfo.IdentifyData
+	} else if vpdErr == nil && !sameDevice(&identBuf, &ataInfo.IdentifyData) {
+		fmt.Fprintln(w, "==> WARNING: ATA IDENTIFY data does not match ATA Information VPD page")
 	}
 
+	// Look up the drive before fixing any byte-swapped IDENTIFY strings
+	thisDrive := db.LookupDrive(identBuf.ModelNumber(), identBuf.FirmwareRevision())
+	identBuf.FixFirmwareBugs(thisDrive)
+
 	fmt.Fprintln(w, "\nATA IDENTIFY data follows:")
 	fmt.Fprintf(w, "Serial Number: %s\n", identBuf.SerialNumber())
 	fmt.Fprintln(w, "LU WWN Device Id:", identBuf.WWN())
@@ -99,8 +176,15 @@ func (d *SATDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
 	fmt.Fprintln(w, "ATA Minor Version:", identBuf.ATAMinorVersion())
 	fmt.Fprintln(w, "Transport:", identBuf.Transport())
 
-	thisDrive := db.LookupDrive(identBuf.ModelNumber())
-	fmt.Fprintf(w, "Drive DB contains %d entries. Using model: %s\n", len(db.Drives), thisDrive.Family)
+	if health, err := d.Health(); err == nil {
+		fmt.Fprintln(w, "SMART Health Status:", health)
+	}
+
+	fmt.Fprintf(w, "Drive DB contains %d entries. Using model: %s (from %s)\n", len(db.Drives), thisDrive.Family, thisDrive.Source)
+
+	if thisDrive.WarningMsg != "" {
+		fmt.Fprintf(w, "\n==> WARNING: %s\n", thisDrive.WarningMsg)
+	}
 
 	// FIXME: Check that device supports SMART before trying to read data page
 
@@ -123,37 +207,55 @@ func (d *SATDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
 
 	smart := ata.SmartPage{}
 	binary.Read(bytes.NewBuffer(respBuf[:362]), utils.NativeEndian, &smart)
-	ata.PrintSMARTPage(smart, thisDrive, w)
+	ata.PrintSMARTPage(smart, thisDrive, identBuf.DriveType(), w)
 
-	// Read SMART log directory
-	logBuf, err := d.readSMARTLog(0x00)
-	if err != nil {
-		return err
-	}
+	fmt.Fprintf(w, "\nSelf-test execution status: %#02x\n", ata.DecodeSelfTestStatus(respBuf, thisDrive))
 
-	smartLogDir := ata.SmartLogDirectory{}
-	binary.Read(bytes.NewBuffer(logBuf), utils.NativeEndian, &smartLogDir)
-	fmt.Fprintf(w, "\nSMART log directory: %+v\n", smartLogDir)
+	// Some drives misbehave when the SMART log directory is read
+	if !thisDrive.HasFirmwareBug(drivedb.FirmwareBugNoLogDir) {
+		logBuf, err := d.readSMARTLog(0x00)
+		if err != nil {
+			return err
+		}
+
+		smartLogDir := ata.SmartLogDirectory{}
+		binary.Read(bytes.NewBuffer(logBuf), utils.NativeEndian, &smartLogDir)
+		fmt.Fprintf(w, "\nSMART log directory: %+v\n", smartLogDir)
+	}
 
 	// Read SMART error log
-	logBuf, err = d.readSMARTLog(0x01)
+	logBuf, err := d.readSMARTLog(0x01)
 	if err != nil {
 		return err
 	}
 
-	sumErrLog := ata.SmartSummaryErrorLog{}
-	binary.Read(bytes.NewBuffer(logBuf), utils.NativeEndian, &sumErrLog)
+	sumErrLog := ata.DecodeSummaryErrorLog(logBuf, thisDrive)
 	fmt.Fprintf(w, "\nSummary SMART error log: %+v\n", sumErrLog)
 
+	// Extended comprehensive SMART error log is only available via GP logging
+	extLogBuf := make([]byte, 512)
+	cdb = ReadLogExtCDB(ata.EXT_ERROR_LOG, 0, 1)
+	if err := d.sendCDB(cdb[:], &extLogBuf); err == nil {
+		extErrLog := ata.DecodeExtErrorLog(extLogBuf, thisDrive)
+		fmt.Fprintf(w, "\nExtended comprehensive SMART error log: %+v\n", extErrLog)
+	}
+
 	// Read SMART self-test log
 	logBuf, err = d.readSMARTLog(0x06)
 	if err != nil {
 		return err
 	}
 
-	selfTestLog := ata.SmartSelfTestLog{}
-	binary.Read(bytes.NewBuffer(logBuf), utils.NativeEndian, &selfTestLog)
+	selfTestLog := ata.DecodeSelfTestLog(logBuf, thisDrive)
 	fmt.Fprintf(w, "\nSMART self-test log: %+v\n", selfTestLog)
 
+	// Only Seagate drives have a FARM log
+	if bytes.HasPrefix(identBuf.ModelNumber(), []byte("ST")) {
+		if farm, err := d.FarmLog(); err == nil {
+			fmt.Fprintln(w, "\nSeagate FARM log:")
+			farm.Print(w)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,49 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dswarbrick/smart/ata"
+)
+
+func TestDecodeATAInformation(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := make([]byte, 572)
+	copy(buf, []byte{0x00, 0x89, 0x02, 0x38})
+	copy(buf[8:], "LSI     LSI SATL        0008")
+	buf[56] = ata.ATA_IDENTIFY_DEVICE
+
+	// IDENTIFY strings are byte-swapped; model number starts at word 27
+	copy(buf[60+54:], "TS0400MN")
+
+	info, err := DecodeATAInformation(buf)
+	assert.NoError(err)
+	assert.Equal("LSI SATL", info.SATProduct)
+	assert.Equal("LSI LSI SATL 0008", info.SATIdentity())
+	assert.Equal(uint8(ata.ATA_IDENTIFY_DEVICE), info.CommandCode)
+	assert.Equal("ST4000NM", string(info.IdentifyData.ModelNumber()[:8]))
+
+	var other ata.IdentifyDeviceData
+	assert.False(sameDevice(&info.IdentifyData, &other))
+	assert.True(sameDevice(&info.IdentifyData, &info.IdentifyData))
+
+	_, err = DecodeATAInformation(buf[:100])
+	assert.Error(err)
+}
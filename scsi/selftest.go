@@ -0,0 +1,280 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI self-test functions.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// SEND DIAGNOSTIC self-test codes
+	SELF_TEST_DEFAULT             = 0x0
+	SELF_TEST_BACKGROUND_SHORT    = 0x1
+	SELF_TEST_BACKGROUND_EXTENDED = 0x2
+	SELF_TEST_ABORT_BACKGROUND    = 0x4
+	SELF_TEST_FOREGROUND_SHORT    = 0x5
+	SELF_TEST_FOREGROUND_EXTENDED = 0x6
+
+	// Self-test results log page code
+	LOG_SELF_TEST_RESULTS = 0x10
+
+	// Self-test result values
+	SELF_TEST_RESULT_COMPLETED   = 0x0
+	SELF_TEST_RESULT_IN_PROGRESS = 0xf
+
+	// Short self-tests complete within two minutes
+	shortSelfTestTimeout = 2 * 60 * 1000
+
+	// Foreground extended self-test timeout, if the device does not report a completion time
+	extendedSelfTestTimeout = 24 * 60 * 60 * 1000
+
+	// Length of REQUEST SENSE response
+	REQUEST_SENSE_LEN = 252
+)
+
+var selfTestCodeNames = map[uint8]string{
+	SELF_TEST_DEFAULT:             "Default",
+	SELF_TEST_BACKGROUND_SHORT:    "Background short",
+	SELF_TEST_BACKGROUND_EXTENDED: "Background long",
+	SELF_TEST_ABORT_BACKGROUND:    "Abort background",
+	SELF_TEST_FOREGROUND_SHORT:    "Foreground short",
+	SELF_TEST_FOREGROUND_EXTENDED: "Foreground long",
+}
+
+var selfTestResultNames = [16]string{
+	"Completed",
+	"Aborted (by user command)",
+	"Aborted (device reset ?)",
+	"Unknown error, incomplete",
+	"Completed, segment failed",
+	"Failed in first segment",
+	"Failed in second segment",
+	"Failed in segment -->",
+	"Reserved(8)", "Reserved(9)", "Reserved(10)", "Reserved(11)", "Reserved(12)", "Reserved(13)",
+	"Reserved(14)",
+	"Self test in progress ...",
+}
+
+// SelfTestEntry is a single entry of the self-test results log page (10h).
+type SelfTestEntry struct {
+	Number       int   // Entry number, 1 being the most recent
+	Code         uint8 // Self-test code, e.g. SELF_TEST_BACKGROUND_SHORT
+	Result       uint8
+	Segment      uint8  // Number of the segment which failed, if any
+	PowerOnHours uint16 // Accumulated power-on hours when the self-test completed
+	FirstFailure uint64 // LBA of first failure, if any
+	SenseKey     uint8
+	ASC          uint8
+	ASCQ         uint8
+}
+
+// Failed reports whether the self-test failed.
+func (e SelfTestEntry) Failed() bool {
+	return e.Result >= 3 && e.Result <= 7
+}
+
+// DecodeSelfTestResults decodes the self-test results log page (10h). Unused entries are omitted.
+func DecodeSelfTestResults(lp LogPage) ([]SelfTestEntry, error) {
+	var entries []SelfTestEntry
+
+	if lp.LogPageID != (LogPageID{LOG_SELF_TEST_RESULTS, LOG_SUBPAGE_NONE}) {
+		return nil, fmt.Errorf("log page %s: not a self-test results page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		if p.Code < 0x0001 || p.Code > 0x0014 || len(p.Value) < 15 {
+			continue
+		}
+
+		v := p.Value
+
+		// Unused entries are all zero
+		if v[0] == 0 && v[1] == 0 && binary.BigEndian.Uint16(v[2:]) == 0 {
+			continue
+		}
+
+		entries = append(entries, SelfTestEntry{
+			Number:       int(p.Code),
+			Code:         v[0] >> 5,
+			Result:       v[0] & 0x0f,
+			Segment:      v[1],
+			PowerOnHours: binary.BigEndian.Uint16(v[2:]),
+			FirstFailure: binary.BigEndian.Uint64(v[4:]),
+			SenseKey:     v[12] & 0x0f,
+			ASC:          v[13],
+			ASCQ:         v[14],
+		})
+	}
+
+	return entries, nil
+}
+
+// SelfTestLog is the decoded self-test results log page (10h).
+type SelfTestLog []SelfTestEntry
+
+func (l SelfTestLog) Print(w io.Writer) {
+	if len(l) == 0 {
+		fmt.Fprintln(w, "No self-tests have been logged")
+		return
+	}
+
+	fmt.Fprintln(w, "Num  Test              Status                 segment  LifeTime  LBA_first_err [SK ASC ASQ]")
+	fmt.Fprintln(w, "     Description                              number   (hours)")
+
+	for _, e := range l {
+		name, ok := selfTestCodeNames[e.Code]
+		if !ok {
+			name = fmt.Sprintf("Reserved(%d)", e.Code)
+		}
+
+		segment := "-"
+		if e.Segment != 0 {
+			segment = fmt.Sprintf("%d", e.Segment)
+		}
+
+		lba := "-"
+		if e.Failed() && e.FirstFailure != 0xffffffffffffffff {
+			lba = fmt.Sprintf("%d", e.FirstFailure)
+		}
+
+		sense := "[-   -    -]"
+		if e.SenseKey != 0 || e.ASC != 0 || e.ASCQ != 0 {
+			sense = fmt.Sprintf("[0x%x 0x%02x 0x%02x]", e.SenseKey, e.ASC, e.ASCQ)
+		}
+
+		fmt.Fprintf(w, "#%2d  %-16s  %-25s %4s  %8d  %13s %s\n", e.Number, name, selfTestResultNames[e.Result],
+			segment, e.PowerOnHours, lba, sense)
+	}
+}
+
+// Progress returns the progress indication of a long-running operation (e.g., a self-test or
+// format), in percent, if the sense data contains one.
+func (s SenseData) Progress() (float64, bool) {
+	if s.SenseKeySpecific == nil || (s.Key != SENSE_KEY_NO_SENSE && s.Key != SENSE_KEY_NOT_READY) {
+		return 0, false
+	}
+
+	return float64(binary.BigEndian.Uint16(s.SenseKeySpecific[1:])) * 100 / 65536, true
+}
+
+// RequestSense sends a SCSI REQUEST SENSE command to a device, and returns the sense data, e.g. to
+// poll the progress of a self-test.
+func (d *SCSIDevice) RequestSense() (SenseData, error) {
+	respBuf := make([]byte, REQUEST_SENSE_LEN)
+
+	cdb := CDB6{SCSI_REQUEST_SENSE}
+	cdb[4] = uint8(len(respBuf))
+
+	if err := d.sendCDB(cdb[:], &respBuf); err != nil {
+		return SenseData{}, err
+	}
+
+	sense, ok := ParseSense(respBuf)
+	if !ok {
+		return sense, fmt.Errorf("REQUEST SENSE: invalid sense data (response code %#02x)", respBuf[0]&0x7f)
+	}
+
+	return sense, nil
+}
+
+// SelfTestProgress reports whether a self-test is in progress, and if so, its progress in percent.
+func (d *SCSIDevice) SelfTestProgress() (bool, float64, error) {
+	sense, err := d.RequestSense()
+	if err != nil {
+		return false, 0, err
+	}
+
+	// LOGICAL UNIT NOT READY, SELF-TEST IN PROGRESS (foreground), or NO SENSE with progress
+	// indication (background)
+	inProgress := sense.ASC == 0x04 && sense.ASCQ == 0x09 ||
+		sense.Key == SENSE_KEY_NO_SENSE && sense.SenseKeySpecific != nil
+
+	if !inProgress {
+		return false, 0, nil
+	}
+
+	progress, _ := sense.Progress()
+
+	return true, progress, nil
+}
+
+// selfTestTimeout returns the command timeout in milliseconds for a self-test. Background tests
+// return immediately, whereas foreground tests only complete when the self-test has completed.
+func (d *SCSIDevice) selfTestTimeout(code uint8) uint32 {
+	switch code {
+	case SELF_TEST_FOREGROUND_SHORT:
+		return shortSelfTestTimeout + DEFAULT_TIMEOUT
+	case SELF_TEST_FOREGROUND_EXTENDED:
+		if ext, err := d.ExtendedInquiry(); err == nil && ext.ExtendedSelfTestMinutes != 0 {
+			// Allow twice the completion time reported by the device
+			return uint32(ext.ExtendedSelfTestMinutes)*2*60*1000 + DEFAULT_TIMEOUT
+		}
+		return extendedSelfTestTimeout
+	}
+
+	return DEFAULT_TIMEOUT
+}
+
+// StartSelfTest sends a SCSI SEND DIAGNOSTIC command to start (or abort) a self-test. Background
+// self-tests run after the command returns, and can be polled with SelfTestProgress. Foreground
+// self-tests block until the self-test has completed.
+//
+// SAT layers translate self-tests to ATA SMART EXECUTE OFF-LINE IMMEDIATE, so this also works for
+// SATA drives.
+func (d *SCSIDevice) StartSelfTest(code uint8) error {
+	if _, ok := selfTestCodeNames[code]; !ok {
+		return fmt.Errorf("invalid self-test code %d", code)
+	}
+
+	cdb := CDB6{SCSI_SEND_DIAGNOSTIC}
+	if code == SELF_TEST_DEFAULT {
+		cdb[1] = 0x04 // SELFTEST
+	} else {
+		cdb[1] = code << 5
+	}
+
+	if err := d.sendCDBTimeout(cdb[:], nil, SG_DXFER_NONE, d.selfTestTimeout(code)); err != nil {
+		return fmt.Errorf("SEND DIAGNOSTIC: %v", err)
+	}
+
+	return nil
+}
+
+// AbortSelfTest aborts a running background self-test.
+func (d *SCSIDevice) AbortSelfTest() error {
+	return d.StartSelfTest(SELF_TEST_ABORT_BACKGROUND)
+}
+
+// SelfTestLog reads the self-test results log of the device.
+func (d *SCSIDevice) SelfTestLog() (SelfTestLog, error) {
+	lp, err := d.LogPage(LOG_SELF_TEST_RESULTS, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeSelfTestResults(lp)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_SELF_TEST_RESULTS, LOG_SUBPAGE_NONE, "Self-test results",
+		func(lp LogPage) (LogPagePrinter, error) {
+			entries, err := DecodeSelfTestResults(lp)
+			return SelfTestLog(entries), err
+		})
+}
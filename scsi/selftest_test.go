@@ -0,0 +1,70 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSelfTestResults(t *testing.T) {
+	assert := assert.New(t)
+
+	entry := func(code uint16, v ...byte) []byte {
+		p := []byte{byte(code >> 8), byte(code), 0x03, 0x10}
+		val := make([]byte, 16)
+		copy(val, v)
+		return append(p, val...)
+	}
+
+	var params []byte
+	params = append(params, entry(0x0001, 0x27, 0x00, 0x12, 0x34, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)...)
+	params = append(params, entry(0x0002, 0x47, 0x03, 0x00, 0x10, 0, 0, 0, 0, 0, 0, 0x10, 0x00, 0x03, 0x11, 0x00)...)
+	params = append(params, entry(0x0003)...)
+
+	buf := append([]byte{LOG_SELF_TEST_RESULTS, 0x00, 0x00, byte(len(params))}, params...)
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	entries, err := DecodeSelfTestResults(lp)
+	assert.NoError(err)
+	assert.Len(entries, 2)
+
+	assert.Equal(SelfTestEntry{Number: 1, Code: SELF_TEST_BACKGROUND_SHORT, Result: 7, PowerOnHours: 0x1234,
+		FirstFailure: 0xffffffffffffffff}, entries[0])
+	assert.True(entries[0].Failed())
+
+	assert.Equal(uint8(SELF_TEST_BACKGROUND_EXTENDED), entries[1].Code)
+	assert.Equal(uint8(3), entries[1].Segment)
+	assert.Equal(uint64(0x1000), entries[1].FirstFailure)
+	assert.Equal(uint8(SENSE_KEY_MEDIUM_ERROR), entries[1].SenseKey)
+	assert.Equal(uint8(0x11), entries[1].ASC)
+}
+
+func TestSenseProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	// Fixed format sense data, NOT READY, self-test in progress, 50% complete
+	buf := []byte{0x70, 0x00, 0x02, 0, 0, 0, 0, 0x0a, 0, 0, 0, 0, 0x04, 0x09, 0x00, 0x80, 0x80, 0x00}
+
+	sense, ok := ParseSense(buf)
+	assert.True(ok)
+
+	progress, ok := sense.Progress()
+	assert.True(ok)
+	assert.Equal(50.0, progress)
+}
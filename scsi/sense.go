@@ -0,0 +1,217 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI sense data.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Sense data response codes
+	SENSE_FIXED_CURRENT       = 0x70
+	SENSE_FIXED_DEFERRED      = 0x71
+	SENSE_DESCRIPTOR_CURRENT  = 0x72
+	SENSE_DESCRIPTOR_DEFERRED = 0x73
+
+	// Sense keys
+	SENSE_KEY_NO_SENSE        = 0x0
+	SENSE_KEY_RECOVERED_ERROR = 0x1
+	SENSE_KEY_NOT_READY       = 0x2
+	SENSE_KEY_MEDIUM_ERROR    = 0x3
+	SENSE_KEY_HARDWARE_ERROR  = 0x4
+	SENSE_KEY_ILLEGAL_REQUEST = 0x5
+	SENSE_KEY_UNIT_ATTENTION  = 0x6
+	SENSE_KEY_DATA_PROTECT    = 0x7
+	SENSE_KEY_ABORTED_COMMAND = 0xb
+
+	// Sense data descriptor types
+	SENSE_DESC_INFORMATION  = 0x00
+	SENSE_DESC_KEY_SPECIFIC = 0x02
+	SENSE_DESC_ATA_STATUS   = 0x09
+)
+
+var senseKeyNames = [16]string{
+	"NO SENSE", "RECOVERED ERROR", "NOT READY", "MEDIUM ERROR", "HARDWARE ERROR", "ILLEGAL REQUEST",
+	"UNIT ATTENTION", "DATA PROTECT", "BLANK CHECK", "VENDOR SPECIFIC", "COPY ABORTED",
+	"ABORTED COMMAND", "RESERVED", "VOLUME OVERFLOW", "MISCOMPARE", "COMPLETED",
+}
+
+// Descriptions of additional sense codes / qualifiers (ASC << 8 | ASCQ) of interest.
+var ascDescriptions = map[uint16]string{
+	0x0000: "No additional sense information",
+	0x001d: "ATA pass through information available",
+	0x0400: "Logical unit not ready, cause not reportable",
+	0x0401: "Logical unit is in process of becoming ready",
+	0x0402: "Logical unit not ready, initializing command required",
+	0x0404: "Logical unit not ready, format in progress",
+	0x0409: "Logical unit not ready, self-test in progress",
+	0x0b00: "Warning",
+	0x0b01: "Warning - specified temperature exceeded",
+	0x0b02: "Warning - enclosure degraded",
+	0x0b03: "Warning - background self-test failed",
+	0x0b04: "Warning - background pre-scan detected medium error",
+	0x0b05: "Warning - background medium scan detected medium error",
+	0x0b06: "Warning - non-volatile cache now volatile",
+	0x0b07: "Warning - degraded power to non-volatile cache",
+	0x0b08: "Warning - power loss expected",
+	0x0b09: "Warning - device statistics notification active",
+	0x0b0a: "Warning - high critical temperature limit exceeded",
+	0x0b0b: "Warning - low critical temperature limit exceeded",
+	0x0b0c: "Warning - high operating temperature limit exceeded",
+	0x0b0d: "Warning - low operating temperature limit exceeded",
+	0x0b0e: "Warning - high critical humidity limit exceeded",
+	0x0b0f: "Warning - low critical humidity limit exceeded",
+	0x0b10: "Warning - high operating humidity limit exceeded",
+	0x0b11: "Warning - low operating humidity limit exceeded",
+	0x1100: "Unrecovered read error",
+	0x2000: "Invalid command operation code",
+	0x2400: "Invalid field in CDB",
+	0x2500: "Logical unit not supported",
+	0x2600: "Invalid field in parameter list",
+	0x2900: "Power on, reset, or bus device reset occurred",
+	0x2a01: "Mode parameters changed",
+	0x3a00: "Medium not present",
+	0x5d00: "Failure prediction threshold exceeded",
+	0x5dff: "Failure prediction threshold exceeded (false)",
+	0x5e00: "Low power condition on",
+	0x5e01: "Idle condition activated by timer",
+	0x5e02: "Standby condition activated by timer",
+	0x5e03: "Idle condition activated by command",
+	0x5e04: "Standby condition activated by command",
+	0x5e05: "Idle_b condition activated by timer",
+	0x5e06: "Idle_b condition activated by command",
+	0x5e07: "Idle_c condition activated by timer",
+	0x5e08: "Idle_c condition activated by command",
+	0x5e09: "Standby_y condition activated by timer",
+	0x5e0a: "Standby_y condition activated by command",
+}
+
+// ASCDescription returns a description of an additional sense code and qualifier.
+func ASCDescription(asc, ascq uint8) string {
+	if s, ok := ascDescriptions[uint16(asc)<<8|uint16(ascq)]; ok {
+		return s
+	}
+
+	// ASCQs 10h-6Ch of ASC 5Dh describe the impending failure in more detail
+	if asc == 0x5d {
+		return fmt.Sprintf("Failure prediction threshold exceeded (ASCQ %02xh)", ascq)
+	}
+
+	return fmt.Sprintf("ASC %02xh, ASCQ %02xh", asc, ascq)
+}
+
+// SenseData is decoded fixed or descriptor format sense data.
+type SenseData struct {
+	ResponseCode     uint8
+	Key              uint8
+	ASC              uint8
+	ASCQ             uint8
+	Information      uint64 // e.g., the LBA of a medium error
+	InformationValid bool
+	CommandSpecific  uint32 // Command-specific information (fixed format only)
+	SenseKeySpecific []byte // 3 bytes of sense key specific information, or nil if not valid
+	Descriptors      []byte // Sense data descriptors (descriptor format only)
+}
+
+// ParseSense decodes fixed or descriptor format sense data. It returns false if buf does not
+// contain valid sense data.
+func ParseSense(buf []byte) (SenseData, bool) {
+	var s SenseData
+
+	if len(buf) < 8 {
+		return s, false
+	}
+
+	s.ResponseCode = buf[0] & 0x7f
+
+	switch s.ResponseCode {
+	case SENSE_FIXED_CURRENT, SENSE_FIXED_DEFERRED:
+		s.Key = buf[2] & 0x0f
+		s.Information = uint64(binary.BigEndian.Uint32(buf[3:]))
+		s.InformationValid = buf[0]&0x80 != 0
+
+		if len(buf) >= 14 {
+			s.CommandSpecific = binary.BigEndian.Uint32(buf[8:])
+			s.ASC, s.ASCQ = buf[12], buf[13]
+		}
+
+		if len(buf) >= 18 && buf[15]&0x80 != 0 {
+			s.SenseKeySpecific = append([]byte{}, buf[15:18]...)
+		}
+	case SENSE_DESCRIPTOR_CURRENT, SENSE_DESCRIPTOR_DEFERRED:
+		s.Key = buf[1] & 0x0f
+		s.ASC, s.ASCQ = buf[2], buf[3]
+
+		end := 8 + int(buf[7])
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		s.Descriptors = append([]byte{}, buf[8:end]...)
+
+		if d := s.Descriptor(SENSE_DESC_INFORMATION); len(d) >= 12 {
+			s.Information = binary.BigEndian.Uint64(d[4:])
+			s.InformationValid = d[2]&0x80 != 0
+		}
+
+		if d := s.Descriptor(SENSE_DESC_KEY_SPECIFIC); len(d) >= 7 && d[4]&0x80 != 0 {
+			s.SenseKeySpecific = append([]byte{}, d[4:7]...)
+		}
+	default:
+		return s, false
+	}
+
+	return s, true
+}
+
+// Descriptor returns the first sense data descriptor of the specified type (including its 2 byte
+// header), or nil if there is no such descriptor.
+func (s SenseData) Descriptor(descType uint8) []byte {
+	d := s.Descriptors
+
+	for len(d) >= 2 {
+		n := 2 + int(d[1])
+		if n > len(d) {
+			break
+		}
+
+		if d[0] == descType {
+			return d[:n]
+		}
+
+		d = d[n:]
+	}
+
+	return nil
+}
+
+func (s SenseData) String() string {
+	return fmt.Sprintf("sense key: %s, %s", senseKeyNames[s.Key], ASCDescription(s.ASC, s.ASCQ))
+}
+
+// SenseFromError returns the sense data carried by an error returned by a SCSI command, if any.
+func SenseFromError(err error) (SenseData, bool) {
+	var sgErr sgioError
+
+	if errors.As(err, &sgErr) {
+		return ParseSense(sgErr.senseBuf)
+	}
+
+	return SenseData{}, false
+}
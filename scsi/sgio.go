@@ -75,12 +75,18 @@ type sgioError struct {
 	scsiStatus   uint8
 	hostStatus   uint16
 	driverStatus uint16
-	senseBuf     [32]byte // FIXME: This is not yet populated by anything
+	senseBuf     []byte // Sense data returned by the device, if any
 }
 
 func (e sgioError) Error() string {
-	return fmt.Sprintf("SCSI status: %#02x, host status: %#02x, driver status: %#02x",
+	s := fmt.Sprintf("SCSI status: %#02x, host status: %#02x, driver status: %#02x",
 		e.scsiStatus, e.hostStatus, e.driverStatus)
+
+	if sense, ok := ParseSense(e.senseBuf); ok {
+		s += ", " + sense.String()
+	}
+
+	return s
 }
 
 // Top-level device interface. All supported device types must implement these methods.
@@ -94,6 +100,8 @@ type Device interface {
 type SCSIDevice struct {
 	Name string
 	fd   int
+
+	modeSense6Only bool // Device does not support MODE SENSE(10)
 }
 
 func (d *SCSIDevice) Open() (err error) {
@@ -105,7 +113,7 @@ func (d *SCSIDevice) Close() error {
 	return unix.Close(d.fd)
 }
 
-func (d *SCSIDevice) execGenericIO(hdr *sgIoHdr) error {
+func (d *SCSIDevice) execGenericIO(hdr *sgIoHdr, senseBuf []byte) error {
 	if err := ioctl.Ioctl(uintptr(d.fd), SG_IO, uintptr(unsafe.Pointer(hdr))); err != nil {
 		return err
 	}
@@ -116,6 +124,7 @@ func (d *SCSIDevice) execGenericIO(hdr *sgIoHdr) error {
 			scsiStatus:   hdr.status,
 			hostStatus:   hdr.host_status,
 			driverStatus: hdr.driver_status,
+			senseBuf:     append([]byte{}, senseBuf[:hdr.sb_len_wr]...),
 		}
 		return err
 	}
@@ -123,8 +132,8 @@ func (d *SCSIDevice) execGenericIO(hdr *sgIoHdr) error {
 	return nil
 }
 
-// inquiry sends a SCSI INQUIRY command to a device and returns an InquiryResponse struct.
-// TODO: Add support for Vital Product Data (VPD)
+// inquiry sends a SCSI INQUIRY command to a device and returns an InquiryResponse struct. See
+// inquiryVPD for Vital Product Data (VPD) pages.
 func (d *SCSIDevice) inquiry() (InquiryResponse, error) {
 	var resp InquiryResponse
 
@@ -144,77 +153,131 @@ func (d *SCSIDevice) inquiry() (InquiryResponse, error) {
 
 // sendCDB sends a SCSI Command Descriptor Block to the device and writes the response into the
 // supplied []byte pointer.
-// TODO: Return SCSI status code, sense buf etc as part of error
 func (d *SCSIDevice) sendCDB(cdb []byte, respBuf *[]byte) error {
+	return d.sendCDBDir(cdb, respBuf, SG_DXFER_FROM_DEV)
+}
+
+// sendCDBDir sends a SCSI Command Descriptor Block to the device, transferring data to or from
+// the supplied []byte pointer, depending on the transfer direction. Errors reported by the device
+// carry its sense data, which can be retrieved with SenseFromError.
+func (d *SCSIDevice) sendCDBDir(cdb []byte, buf *[]byte, dxferDir int32) error {
+	return d.sendCDBTimeout(cdb, buf, dxferDir, DEFAULT_TIMEOUT)
+}
+
+// sendCDBTimeout is like sendCDBDir, but with a command timeout in milliseconds, for commands
+// which take a long time to complete.
+func (d *SCSIDevice) sendCDBTimeout(cdb []byte, buf *[]byte, dxferDir int32, timeout uint32) error {
+	_, err := d.sendCDBResid(cdb, buf, dxferDir, timeout)
+	return err
+}
+
+// sendCDBResid is like sendCDBTimeout, but also returns the residual count, i.e. the number of bytes
+// of buf which were not transferred.
+func (d *SCSIDevice) sendCDBResid(cdb []byte, buf *[]byte, dxferDir int32, timeout uint32) (int, error) {
 	senseBuf := make([]byte, 32)
 
 	// Populate required fields of "sg_io_hdr_t" struct
 	hdr := sgIoHdr{
 		interface_id:    'S',
-		dxfer_direction: SG_DXFER_FROM_DEV,
-		timeout:         DEFAULT_TIMEOUT,
+		dxfer_direction: dxferDir,
+		timeout:         timeout,
 		cmd_len:         uint8(len(cdb)),
 		mx_sb_len:       uint8(len(senseBuf)),
-		dxfer_len:       uint32(len(*respBuf)),
-		dxferp:          uintptr(unsafe.Pointer(&(*respBuf)[0])),
 		cmdp:            uintptr(unsafe.Pointer(&cdb[0])),
 		sbp:             uintptr(unsafe.Pointer(&senseBuf[0])),
 	}
 
-	return d.execGenericIO(&hdr)
+	if buf == nil || len(*buf) == 0 {
+		hdr.dxfer_direction = SG_DXFER_NONE
+	} else {
+		hdr.dxfer_len = uint32(len(*buf))
+		hdr.dxferp = uintptr(unsafe.Pointer(&(*buf)[0]))
+	}
+
+	err := d.execGenericIO(&hdr, senseBuf)
+
+	return int(hdr.resid), err
 }
 
-// modeSense sends a SCSI MODE SENSE(6) command to a device.
-func (d *SCSIDevice) modeSense(pageNum, subPageNum, pageControl uint8) ([]byte, error) {
-	respBuf := make([]byte, 64)
+// Regular SCSI (including SAS, but excluding SATA) SMART functions not yet fully implemented.
+func (d *SCSIDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
+	if inq, err := d.inquiry(); err == nil {
+		fmt.Fprintln(w, "SCSI INQUIRY:", inq)
+	}
 
-	cdb := CDB6{SCSI_MODE_SENSE_6}
-	cdb[2] = (pageControl << 6) | (pageNum & 0x3f)
-	cdb[3] = subPageNum
-	cdb[4] = uint8(len(respBuf))
+	// Query the power state before anything else, since subsequent commands may wake the device
+	if state, err := d.PowerState(); err == nil {
+		fmt.Fprintf(w, "Power state: %s\n", state)
+	}
 
-	if err := d.sendCDB(cdb[:], &respBuf); err != nil {
-		return respBuf, err
+	if serial, err := d.SerialNumber(); err == nil {
+		fmt.Fprintf(w, "Serial Number: %s\n", serial)
 	}
 
-	return respBuf, nil
-}
+	if id, err := d.DeviceIdentification(); err == nil && id.WWN() != "" {
+		fmt.Fprintln(w, "LU WWN Device Id:", id.WWN())
+	}
 
-// readCapacity sends a SCSI READ CAPACITY(10) command to a device and returns the capacity in bytes.
-func (d *SCSIDevice) readCapacity() (uint64, error) {
-	respBuf := make([]byte, 8)
-	cdb := CDB10{SCSI_READ_CAPACITY_10}
+	if capacity, err := d.ReadCapacity(); err == nil {
+		capacity.Print(w)
+	}
 
-	if err := d.sendCDB(cdb[:], &respBuf); err != nil {
-		return 0, err
+	if media, err := d.Media(); err == nil {
+		media.Print(w)
+	}
+
+	if grown, err := d.GrownDefectCount(); err == nil {
+		fmt.Fprintf(w, "Elements in grown defect list: %d\n", grown)
+	}
+
+	if cache, err := d.CachingPage(MPAGE_CONTROL_CURRENT); err == nil {
+		fmt.Fprintf(w, "Read Cache is: %s\n", enabledString(!cache.RCD))
+		fmt.Fprintf(w, "Writeback Cache is: %s\n", enabledString(cache.WCE))
+	}
+
+	if pc, err := d.PowerConditionPage(MPAGE_CONTROL_CURRENT); err == nil {
+		fmt.Fprintln(w, "\nPower condition timers:")
+		pc.Print(w)
+	}
+
+	// Log pages are skipped if the device does not support LOG SENSE
+	if pages, err := d.SupportedLogPages(); err == nil {
+		d.printSupportedLogPages(w, pages)
 	}
 
-	lastLBA := binary.BigEndian.Uint32(respBuf[0:]) // max. addressable LBA
-	LBsize := binary.BigEndian.Uint32(respBuf[4:])  // logical block (i.e., sector) size
-	capacity := (uint64(lastLBA) + 1) * uint64(LBsize)
+	if running, progress, err := d.SelfTestProgress(); err == nil && running {
+		fmt.Fprintf(w, "\nSelf-test in progress: %.0f%% complete\n", progress)
+	}
 
-	return capacity, nil
+	return nil
 }
 
-// Regular SCSI (including SAS, but excluding SATA) SMART functions not yet fully implemented.
-func (d *SCSIDevice) PrintSMART(db *drivedb.DriveDb, w io.Writer) error {
-	capacity, _ := d.readCapacity()
-	fmt.Fprintf(w, "Capacity: %d bytes (%s)\n", capacity, utils.FormatBytes(capacity))
+// printSupportedLogPages prints the list of supported log pages, followed by the decoded log pages.
+func (d *SCSIDevice) printSupportedLogPages(w io.Writer, pages []LogPageID) {
+	fmt.Fprint(w, "\nSupported log pages:")
+	for _, id := range pages {
+		fmt.Fprintf(w, " %s", id)
+	}
+	fmt.Fprintln(w)
 
-	// WIP
-	resp, _ := d.modeSense(RIGID_DISK_DRIVE_GEOMETRY_PAGE, 0, MPAGE_CONTROL_DEFAULT)
-	fmt.Fprintf(w, "MODE SENSE buf: % x\n", resp)
+	printed := make(map[LogPageID]bool)
 
-	// TODO: Handle this elegantly for MODE SENSE(10) also
-	respLen := resp[0] + 1
-	bdLen := resp[3]
-	offset := bdLen + 4
-	fmt.Fprintf(w, "respLen: %d, bdLen: %d, offset: %d\n",
-		respLen, bdLen, offset)
+	if errLog, err := d.ErrorCounterLog(pages); err != nil {
+		fmt.Fprintf(w, "\nCannot read error counter log: %v\n", err)
+	} else {
+		fmt.Fprintln(w, "\nError counter log:")
+		errLog.Print(w)
+	}
 
-	fmt.Fprintf(w, "RPM: %d\n", binary.BigEndian.Uint16(resp[offset+20:]))
+	for _, page := range []uint8{LOG_WRITE_ERROR_COUNTER, LOG_READ_ERROR_COUNTER, LOG_VERIFY_ERROR_COUNTER,
+		LOG_NON_MEDIUM_ERROR} {
+		printed[LogPageID{page, LOG_SUBPAGE_NONE}] = true
+	}
 
-	return nil
+	// Already printed with the medium type
+	printed[LogPageID{LOG_SOLID_STATE_MEDIA, LOG_SUBPAGE_NONE}] = true
+
+	d.printLogPages(w, pages, printed)
 }
 
 func OpenSCSIAutodetect(name string) (Device, error) {
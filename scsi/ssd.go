@@ -0,0 +1,132 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI solid state media log page and medium type.
+
+package scsi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// Solid state media log page code
+	LOG_SOLID_STATE_MEDIA = 0x11
+
+	// Rotation rate of non-rotating media (VPD page B1h)
+	ROTATION_RATE_NON_ROTATING = 0x0001
+)
+
+// SolidStateMedia is the decoded solid state media log page (11h).
+type SolidStateMedia struct {
+	PercentageUsed int // Percentage used endurance indicator, or -1 if not reported
+}
+
+// DecodeSolidStateMedia decodes the solid state media log page (11h).
+func DecodeSolidStateMedia(lp LogPage) (SolidStateMedia, error) {
+	ssm := SolidStateMedia{PercentageUsed: -1}
+
+	if lp.LogPageID != (LogPageID{LOG_SOLID_STATE_MEDIA, LOG_SUBPAGE_NONE}) {
+		return ssm, fmt.Errorf("log page %s: not a solid state media page", lp.LogPageID)
+	}
+
+	// Percentage used endurance indicator is the last byte of a 4 byte parameter
+	if p, ok := lp.Param(0x0001); ok && len(p.Value) >= 4 {
+		ssm.PercentageUsed = int(p.Value[3])
+	}
+
+	return ssm, nil
+}
+
+func (ssm SolidStateMedia) Print(w io.Writer) {
+	if ssm.PercentageUsed >= 0 {
+		fmt.Fprintf(w, "Percentage used endurance indicator: %d%%\n", ssm.PercentageUsed)
+	}
+}
+
+// Media describes the medium type and, for solid state devices, the endurance of a device.
+type Media struct {
+	RotationRate   uint16 // As reported in VPD page B1h, 0 if not reported
+	PercentageUsed int    // Percentage used endurance indicator, or -1 if not reported
+}
+
+// SolidState reports whether the device has non-rotating (i.e., solid state) media.
+func (m Media) SolidState() bool {
+	return m.RotationRate == ROTATION_RATE_NON_ROTATING
+}
+
+// RotationRateString returns the rotation rate in smartctl style, e.g. "Solid State Device".
+func (m Media) RotationRateString() string {
+	switch m.RotationRate {
+	case 0:
+		return "not reported"
+	case ROTATION_RATE_NON_ROTATING:
+		return "Solid State Device"
+	}
+
+	return fmt.Sprintf("%d rpm", m.RotationRate)
+}
+
+func (m Media) Print(w io.Writer) {
+	fmt.Fprintf(w, "Rotation Rate: %s\n", m.RotationRateString())
+
+	if m.PercentageUsed >= 0 {
+		fmt.Fprintf(w, "Percentage used endurance indicator: %d%%\n", m.PercentageUsed)
+	}
+}
+
+// SolidStateMedia reads the solid state media log page of the device.
+func (d *SCSIDevice) SolidStateMedia() (SolidStateMedia, error) {
+	lp, err := d.LogPage(LOG_SOLID_STATE_MEDIA, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return SolidStateMedia{PercentageUsed: -1}, err
+	}
+
+	return DecodeSolidStateMedia(lp)
+}
+
+// Media returns the rotation rate of the device from VPD page B1h (or mode page 04h), and the
+// endurance indicator from the solid state media log page if the device supports it. HDDs do not
+// support the latter, so an error is only returned if neither page could be read.
+func (d *SCSIDevice) Media() (Media, error) {
+	m := Media{PercentageUsed: -1}
+
+	bdc, bdcErr := d.BlockDeviceCharacteristics()
+	if bdcErr == nil {
+		m.RotationRate = bdc.RotationRate
+	} else if page, err := d.ModePage(RIGID_DISK_DRIVE_GEOMETRY_PAGE, 0, MPAGE_CONTROL_CURRENT); err == nil &&
+		len(page) >= 22 {
+		// Older devices only report the rotation rate in the Rigid Disk Drive Geometry mode page
+		m.RotationRate = binary.BigEndian.Uint16(page[20:])
+		bdcErr = nil
+	}
+
+	ssm, err := d.SolidStateMedia()
+	if err == nil {
+		m.PercentageUsed = ssm.PercentageUsed
+	} else if bdcErr != nil {
+		return m, bdcErr
+	}
+
+	return m, nil
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_SOLID_STATE_MEDIA, LOG_SUBPAGE_NONE, "Solid state media",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeSolidStateMedia(lp)
+		})
+}
@@ -0,0 +1,39 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSolidStateMedia(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{LOG_SOLID_STATE_MEDIA, 0x00, 0x00, 0x08, 0x00, 0x01, 0x03, 0x04, 0x00, 0x00, 0x00, 0x07}
+
+	lp, err := ParseLogPage(buf)
+	assert.NoError(err)
+
+	ssm, err := DecodeSolidStateMedia(lp)
+	assert.NoError(err)
+	assert.Equal(7, ssm.PercentageUsed)
+
+	m := Media{RotationRate: ROTATION_RATE_NON_ROTATING, PercentageUsed: ssm.PercentageUsed}
+	assert.True(m.SolidState())
+	assert.Equal("Solid State Device", m.RotationRateString())
+	assert.Equal("7200 rpm", Media{RotationRate: 7200}.RotationRateString())
+}
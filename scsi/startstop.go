@@ -0,0 +1,171 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI start-stop cycle counter and utilization log pages.
+
+package scsi
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// Start-stop cycle counter log page code and subpage codes
+	LOG_START_STOP_CYCLE    = 0x0e
+	LOG_SUBPAGE_UTILIZATION = 0x01
+)
+
+// StartStopCycles is the decoded start-stop cycle counter log page (0Eh). Dates are in the form
+// "YYYY week WW", or empty if not reported.
+type StartStopCycles struct {
+	ManufactureDate       string
+	AccountingDate        string
+	SpecifiedStartStop    uint32 // Specified cycle count over device lifetime
+	AccumulatedStartStop  uint32
+	SpecifiedLoadUnload   uint32 // Specified load-unload count over device lifetime
+	AccumulatedLoadUnload uint32
+}
+
+// formatYearWeek formats a 6 byte ASCII "YYYYWW" date.
+func formatYearWeek(b []byte) string {
+	if len(b) < 6 {
+		return ""
+	}
+
+	year, week := strings.TrimSpace(string(b[:4])), strings.TrimSpace(string(b[4:6]))
+	if year == "" || week == "" || week == "00" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s week %s", year, week)
+}
+
+// DecodeStartStopCycles decodes the start-stop cycle counter log page (0Eh).
+func DecodeStartStopCycles(lp LogPage) (StartStopCycles, error) {
+	var ssc StartStopCycles
+
+	if lp.LogPageID != (LogPageID{LOG_START_STOP_CYCLE, LOG_SUBPAGE_NONE}) {
+		return ssc, fmt.Errorf("log page %s: not a start-stop cycle counter page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		switch p.Code {
+		case 0x0001:
+			ssc.ManufactureDate = formatYearWeek(p.Value)
+		case 0x0002:
+			ssc.AccountingDate = formatYearWeek(p.Value)
+		case 0x0003:
+			ssc.SpecifiedStartStop = uint32(p.Uint64())
+		case 0x0004:
+			ssc.AccumulatedStartStop = uint32(p.Uint64())
+		case 0x0005:
+			ssc.SpecifiedLoadUnload = uint32(p.Uint64())
+		case 0x0006:
+			ssc.AccumulatedLoadUnload = uint32(p.Uint64())
+		}
+	}
+
+	return ssc, nil
+}
+
+func (ssc StartStopCycles) Print(w io.Writer) {
+	if ssc.ManufactureDate != "" {
+		fmt.Fprintf(w, "Manufactured in %s\n", ssc.ManufactureDate)
+	}
+
+	if ssc.AccountingDate != "" {
+		fmt.Fprintf(w, "Accounting date: %s\n", ssc.AccountingDate)
+	}
+
+	if ssc.SpecifiedStartStop != 0 || ssc.AccumulatedStartStop != 0 {
+		fmt.Fprintf(w, "Specified cycle count over device lifetime:  %d\n", ssc.SpecifiedStartStop)
+		fmt.Fprintf(w, "Accumulated start-stop cycles:  %d\n", ssc.AccumulatedStartStop)
+	}
+
+	if ssc.SpecifiedLoadUnload != 0 || ssc.AccumulatedLoadUnload != 0 {
+		fmt.Fprintf(w, "Specified load-unload count over device lifetime:  %d\n", ssc.SpecifiedLoadUnload)
+		fmt.Fprintf(w, "Accumulated load-unload cycles:  %d\n", ssc.AccumulatedLoadUnload)
+	}
+}
+
+// Utilization is the decoded utilization log page (0Eh/01h). Negative values are not reported by
+// the device.
+type Utilization struct {
+	Workload  float64 // Workload utilization, in percent of the specified workload rating
+	UsageRate int     // Usage rate based on date and time, in percent
+}
+
+// DecodeUtilization decodes the utilization log page (0Eh/01h).
+func DecodeUtilization(lp LogPage) (Utilization, error) {
+	u := Utilization{-1, -1}
+
+	if lp.LogPageID != (LogPageID{LOG_START_STOP_CYCLE, LOG_SUBPAGE_UTILIZATION}) {
+		return u, fmt.Errorf("log page %s: not a utilization page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		switch p.Code {
+		case 0x0000:
+			// Units of 0.01 percent
+			u.Workload = float64(p.Uint64()) / 100
+		case 0x0001:
+			u.UsageRate = int(p.Uint64())
+		}
+	}
+
+	return u, nil
+}
+
+func (u Utilization) Print(w io.Writer) {
+	if u.Workload >= 0 {
+		fmt.Fprintf(w, "Workload utilization:  %.2f%%\n", u.Workload)
+	}
+
+	if u.UsageRate >= 0 {
+		fmt.Fprintf(w, "Utilization usage rate:  %d%%\n", u.UsageRate)
+	}
+}
+
+// StartStopCycles reads the start-stop and load-unload cycle counters of the device.
+func (d *SCSIDevice) StartStopCycles() (StartStopCycles, error) {
+	lp, err := d.LogPage(LOG_START_STOP_CYCLE, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return StartStopCycles{}, err
+	}
+
+	return DecodeStartStopCycles(lp)
+}
+
+// Utilization reads the utilization of the device.
+func (d *SCSIDevice) Utilization() (Utilization, error) {
+	lp, err := d.LogPage(LOG_START_STOP_CYCLE, LOG_SUBPAGE_UTILIZATION)
+	if err != nil {
+		return Utilization{}, err
+	}
+
+	return DecodeUtilization(lp)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_START_STOP_CYCLE, LOG_SUBPAGE_NONE, "Start-stop cycle counter",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeStartStopCycles(lp)
+		})
+	RegisterLogPageDecoder(LOG_START_STOP_CYCLE, LOG_SUBPAGE_UTILIZATION, "Utilization",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeUtilization(lp)
+		})
+}
@@ -0,0 +1,319 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI temperature and environmental log pages.
+
+package scsi
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// Temperature log page code and subpage codes
+	LOG_TEMPERATURE           = 0x0d
+	LOG_SUBPAGE_ENV_REPORTING = 0x01
+	LOG_SUBPAGE_ENV_LIMITS    = 0x02
+
+	// Invalid temperature / humidity values
+	TEMPERATURE_NOT_AVAILABLE     = 0xff // Temperature log page (0Dh)
+	ENV_TEMPERATURE_NOT_AVAILABLE = -128 // Environmental pages (0Dh/01h, 0Dh/02h)
+	ENV_HUMIDITY_NOT_AVAILABLE    = 0xff
+)
+
+const (
+	// Environmental page parameter codes 0000h-00FFh are temperature, 0100h-01FFh are humidity
+	envTemperatureParamCodeMax = 0x00ff
+	envHumidityParamCodeMax    = 0x01ff
+
+	// Minimum environmental page parameter lengths
+	envReportingParamLen = 6
+	envLimitsParamLen    = 8
+)
+
+func formatTemperature(t uint8) string {
+	if t == TEMPERATURE_NOT_AVAILABLE {
+		return "not available"
+	}
+
+	return fmt.Sprintf("%d C", t)
+}
+
+func formatEnvTemperature(t int8) string {
+	if t == ENV_TEMPERATURE_NOT_AVAILABLE {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%d C", t)
+}
+
+func formatHumidity(h uint8) string {
+	if h == ENV_HUMIDITY_NOT_AVAILABLE || h > 100 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%d%%", h)
+}
+
+// envValue converts an environmental page value, depending on the parameter code. Temperatures
+// are signed, humidity is unsigned.
+func envValue(code uint16, b byte) int16 {
+	if code > envTemperatureParamCodeMax {
+		return int16(b)
+	}
+
+	return int16(int8(b))
+}
+
+// Temperature is the decoded temperature log page (0Dh). Temperatures are in degrees Celsius, or
+// TEMPERATURE_NOT_AVAILABLE.
+type Temperature struct {
+	Current   uint8
+	Reference uint8 // Maximum reported sensor temperature at which the device operates continuously
+}
+
+// DecodeTemperature decodes the temperature log page (0Dh).
+func DecodeTemperature(lp LogPage) (Temperature, error) {
+	t := Temperature{TEMPERATURE_NOT_AVAILABLE, TEMPERATURE_NOT_AVAILABLE}
+
+	if lp.LogPageID != (LogPageID{LOG_TEMPERATURE, LOG_SUBPAGE_NONE}) {
+		return t, fmt.Errorf("log page %s: not a temperature page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		if len(p.Value) < 2 {
+			continue
+		}
+
+		switch p.Code {
+		case 0x0000:
+			t.Current = p.Value[1]
+		case 0x0001:
+			t.Reference = p.Value[1]
+		}
+	}
+
+	return t, nil
+}
+
+func (t Temperature) Print(w io.Writer) {
+	fmt.Fprintf(w, "Current Drive Temperature:     %s\n", formatTemperature(t.Current))
+	fmt.Fprintf(w, "Drive Trip Temperature:        %s\n", formatTemperature(t.Reference))
+}
+
+// EnvReport is a single temperature or relative humidity report from the environmental reporting
+// log page (0Dh/01h). Temperatures are in degrees Celsius, humidity in percent.
+type EnvReport struct {
+	ParamCode       uint16
+	Current         int16
+	LifetimeMax     int16
+	LifetimeMin     int16
+	MaxSincePowerOn int16
+	MinSincePowerOn int16
+}
+
+// IsHumidity reports whether the report is a relative humidity (rather than temperature) report.
+func (r EnvReport) IsHumidity() bool {
+	return r.ParamCode > envTemperatureParamCodeMax
+}
+
+func (r EnvReport) format(v int16) string {
+	if r.IsHumidity() {
+		return formatHumidity(uint8(v))
+	}
+
+	return formatEnvTemperature(int8(v))
+}
+
+// EnvReporting is the decoded environmental reporting log page (0Dh/01h).
+type EnvReporting struct {
+	Temperatures []EnvReport
+	Humidity     []EnvReport
+}
+
+// DecodeEnvReporting decodes the environmental reporting log page (0Dh/01h).
+func DecodeEnvReporting(lp LogPage) (EnvReporting, error) {
+	var env EnvReporting
+
+	if lp.LogPageID != (LogPageID{LOG_TEMPERATURE, LOG_SUBPAGE_ENV_REPORTING}) {
+		return env, fmt.Errorf("log page %s: not an environmental reporting page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		if p.Code > envHumidityParamCodeMax || len(p.Value) < envReportingParamLen {
+			continue
+		}
+
+		r := EnvReport{
+			ParamCode:       p.Code,
+			Current:         envValue(p.Code, p.Value[1]),
+			LifetimeMax:     envValue(p.Code, p.Value[2]),
+			LifetimeMin:     envValue(p.Code, p.Value[3]),
+			MaxSincePowerOn: envValue(p.Code, p.Value[4]),
+			MinSincePowerOn: envValue(p.Code, p.Value[5]),
+		}
+
+		if r.IsHumidity() {
+			env.Humidity = append(env.Humidity, r)
+		} else {
+			env.Temperatures = append(env.Temperatures, r)
+		}
+	}
+
+	return env, nil
+}
+
+func (env EnvReporting) all() []EnvReport {
+	return append(append([]EnvReport{}, env.Temperatures...), env.Humidity...)
+}
+
+func (env EnvReporting) Print(w io.Writer) {
+	fmt.Fprintln(w, "Sensor  Type         Current  Lifetime max/min  Since power on max/min")
+
+	for _, r := range env.all() {
+		kind := "temperature"
+		if r.IsHumidity() {
+			kind = "humidity"
+		}
+
+		fmt.Fprintf(w, "%04xh   %-11s  %7s  %8s/%-8s  %8s/%-8s\n", r.ParamCode, kind, r.format(r.Current),
+			r.format(r.LifetimeMax), r.format(r.LifetimeMin), r.format(r.MaxSincePowerOn),
+			r.format(r.MinSincePowerOn))
+	}
+}
+
+// EnvLimit is a single temperature or relative humidity limit from the environmental limits log
+// page (0Dh/02h).
+type EnvLimit struct {
+	ParamCode            uint16
+	HighCriticalTrigger  int16
+	HighCriticalReset    int16
+	LowCriticalTrigger   int16
+	LowCriticalReset     int16
+	HighOperatingTrigger int16
+	HighOperatingReset   int16
+	LowOperatingTrigger  int16
+	LowOperatingReset    int16
+}
+
+// IsHumidity reports whether the limit is a relative humidity (rather than temperature) limit.
+func (l EnvLimit) IsHumidity() bool {
+	return l.ParamCode > envTemperatureParamCodeMax
+}
+
+// EnvLimits is the decoded environmental limits log page (0Dh/02h).
+type EnvLimits struct {
+	Temperatures []EnvLimit
+	Humidity     []EnvLimit
+}
+
+// DecodeEnvLimits decodes the environmental limits log page (0Dh/02h).
+func DecodeEnvLimits(lp LogPage) (EnvLimits, error) {
+	var env EnvLimits
+
+	if lp.LogPageID != (LogPageID{LOG_TEMPERATURE, LOG_SUBPAGE_ENV_LIMITS}) {
+		return env, fmt.Errorf("log page %s: not an environmental limits page", lp.LogPageID)
+	}
+
+	for _, p := range lp.Params {
+		if p.Code > envHumidityParamCodeMax || len(p.Value) < envLimitsParamLen {
+			continue
+		}
+
+		l := EnvLimit{
+			ParamCode:            p.Code,
+			HighCriticalTrigger:  envValue(p.Code, p.Value[0]),
+			HighCriticalReset:    envValue(p.Code, p.Value[1]),
+			LowCriticalTrigger:   envValue(p.Code, p.Value[2]),
+			LowCriticalReset:     envValue(p.Code, p.Value[3]),
+			HighOperatingTrigger: envValue(p.Code, p.Value[4]),
+			HighOperatingReset:   envValue(p.Code, p.Value[5]),
+			LowOperatingTrigger:  envValue(p.Code, p.Value[6]),
+			LowOperatingReset:    envValue(p.Code, p.Value[7]),
+		}
+
+		if l.IsHumidity() {
+			env.Humidity = append(env.Humidity, l)
+		} else {
+			env.Temperatures = append(env.Temperatures, l)
+		}
+	}
+
+	return env, nil
+}
+
+func (env EnvLimits) all() []EnvLimit {
+	return append(append([]EnvLimit{}, env.Temperatures...), env.Humidity...)
+}
+
+func (env EnvLimits) Print(w io.Writer) {
+	fmt.Fprintln(w, "Sensor  Type         Critical high/low  Operating high/low")
+
+	for _, l := range env.all() {
+		kind, format := "temperature", func(v int16) string { return formatEnvTemperature(int8(v)) }
+		if l.IsHumidity() {
+			kind, format = "humidity", func(v int16) string { return formatHumidity(uint8(v)) }
+		}
+
+		fmt.Fprintf(w, "%04xh   %-11s  %8s/%-8s  %8s/%-8s\n", l.ParamCode, kind,
+			format(l.HighCriticalTrigger), format(l.LowCriticalTrigger),
+			format(l.HighOperatingTrigger), format(l.LowOperatingTrigger))
+	}
+}
+
+// Temperature reads the current and reference temperature of the device.
+func (d *SCSIDevice) Temperature() (Temperature, error) {
+	lp, err := d.LogPage(LOG_TEMPERATURE, LOG_SUBPAGE_NONE)
+	if err != nil {
+		return Temperature{}, err
+	}
+
+	return DecodeTemperature(lp)
+}
+
+// EnvReporting reads the environmental (temperature and humidity) reports of the device.
+func (d *SCSIDevice) EnvReporting() (EnvReporting, error) {
+	lp, err := d.LogPage(LOG_TEMPERATURE, LOG_SUBPAGE_ENV_REPORTING)
+	if err != nil {
+		return EnvReporting{}, err
+	}
+
+	return DecodeEnvReporting(lp)
+}
+
+// EnvLimits reads the environmental (temperature and humidity) limits of the device.
+func (d *SCSIDevice) EnvLimits() (EnvLimits, error) {
+	lp, err := d.LogPage(LOG_TEMPERATURE, LOG_SUBPAGE_ENV_LIMITS)
+	if err != nil {
+		return EnvLimits{}, err
+	}
+
+	return DecodeEnvLimits(lp)
+}
+
+func init() {
+	RegisterLogPageDecoder(LOG_TEMPERATURE, LOG_SUBPAGE_NONE, "Temperature",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeTemperature(lp)
+		})
+	RegisterLogPageDecoder(LOG_TEMPERATURE, LOG_SUBPAGE_ENV_REPORTING, "Environmental reporting",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeEnvReporting(lp)
+		})
+	RegisterLogPageDecoder(LOG_TEMPERATURE, LOG_SUBPAGE_ENV_LIMITS, "Environmental limits",
+		func(lp LogPage) (LogPagePrinter, error) {
+			return DecodeEnvLimits(lp)
+		})
+}
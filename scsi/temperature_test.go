@@ -0,0 +1,62 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironmentLogPages(t *testing.T) {
+	assert := assert.New(t)
+
+	lp, err := ParseLogPage([]byte{0x0d, 0x00, 0x00, 0x0c,
+		0x00, 0x00, 0x03, 0x02, 0x00, 0x24,
+		0x00, 0x01, 0x03, 0x02, 0x00, 0x44,
+	})
+	assert.NoError(err)
+
+	temp, err := DecodeTemperature(lp)
+	assert.NoError(err)
+	assert.Equal(Temperature{Current: 36, Reference: 68}, temp)
+
+	lp, err = ParseLogPage([]byte{0x4d, 0x01, 0x00, 0x18,
+		0x00, 0x00, 0x01, 0x08, 0x00, 0x24, 0x3c, 0xfb, 0x2a, 0x80, 0x00, 0x00,
+		0x01, 0x00, 0x01, 0x08, 0x00, 0x28, 0x50, 0x0a, 0xff, 0xff, 0x00, 0x00,
+	})
+	assert.NoError(err)
+
+	env, err := DecodeEnvReporting(lp)
+	assert.NoError(err)
+	if assert.Len(env.Temperatures, 1) && assert.Len(env.Humidity, 1) {
+		assert.Equal(EnvReport{ParamCode: 0, Current: 36, LifetimeMax: 60, LifetimeMin: -5, MaxSincePowerOn: 42,
+			MinSincePowerOn: ENV_TEMPERATURE_NOT_AVAILABLE}, env.Temperatures[0])
+		assert.Equal(int16(40), env.Humidity[0].Current)
+		assert.Equal("n/a", env.Humidity[0].format(env.Humidity[0].MaxSincePowerOn))
+	}
+
+	lp, err = ParseLogPage([]byte{0x0e, 0x00, 0x00, 0x1a,
+		0x00, 0x01, 0x01, 0x06, '2', '0', '1', '7', '4', '2',
+		0x00, 0x03, 0x03, 0x04, 0x00, 0x00, 0xc3, 0x50,
+		0x00, 0x04, 0x03, 0x04, 0x00, 0x00, 0x00, 0x2a,
+	})
+	assert.NoError(err)
+
+	ssc, err := DecodeStartStopCycles(lp)
+	assert.NoError(err)
+	assert.Equal(StartStopCycles{ManufactureDate: "2017 week 42", SpecifiedStartStop: 50000, AccumulatedStartStop: 42},
+		ssc)
+}
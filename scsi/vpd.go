@@ -0,0 +1,527 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCSI Vital Product Data (VPD) pages.
+
+package scsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// VPD page codes
+	VPD_SUPPORTED_PAGES              = 0x00
+	VPD_UNIT_SERIAL_NUMBER           = 0x80
+	VPD_DEVICE_IDENTIFICATION        = 0x83
+	VPD_EXTENDED_INQUIRY             = 0x86
+	VPD_ATA_INFORMATION              = 0x89
+	VPD_BLOCK_LIMITS                 = 0xb0
+	VPD_BLOCK_DEVICE_CHARACTERISTICS = 0xb1
+	VPD_LOGICAL_BLOCK_PROVISIONING   = 0xb2
+
+	// Length of VPD page header
+	VPD_HEADER_LEN = 4
+
+	// Device identification designator association
+	ASSOC_LOGICAL_UNIT  = 0
+	ASSOC_TARGET_PORT   = 1
+	ASSOC_TARGET_DEVICE = 2
+
+	// Device identification designator types
+	DESIG_VENDOR_SPECIFIC    = 0x0
+	DESIG_T10_VENDOR_ID      = 0x1
+	DESIG_EUI64              = 0x2
+	DESIG_NAA                = 0x3
+	DESIG_RELATIVE_PORT      = 0x4
+	DESIG_TARGET_PORT_GROUP  = 0x5
+	DESIG_LOGICAL_UNIT_GROUP = 0x6
+	DESIG_MD5_LOGICAL_UNIT   = 0x7
+	DESIG_SCSI_NAME_STRING   = 0x8
+	DESIG_PROTOCOL_PORT      = 0x9
+	DESIG_UUID               = 0xa
+
+	// Device identification designator code sets
+	CODE_SET_BINARY = 0x1
+	CODE_SET_ASCII  = 0x2
+	CODE_SET_UTF8   = 0x3
+)
+
+// checkVPDPage checks that buf contains a complete VPD page with the expected page code, and returns
+// the page payload (i.e., excluding the header).
+func checkVPDPage(buf []byte, page uint8) ([]byte, error) {
+	if len(buf) < VPD_HEADER_LEN {
+		return nil, fmt.Errorf("VPD page %#02x: short response (%d bytes)", page, len(buf))
+	}
+
+	if buf[1] != page {
+		return nil, fmt.Errorf("VPD page %#02x: unexpected page code %#02x", page, buf[1])
+	}
+
+	pageLen := int(binary.BigEndian.Uint16(buf[2:]))
+	if len(buf) < VPD_HEADER_LEN+pageLen {
+		return nil, fmt.Errorf("VPD page %#02x: truncated (%d of %d bytes)", page, len(buf),
+			VPD_HEADER_LEN+pageLen)
+	}
+
+	return buf[VPD_HEADER_LEN : VPD_HEADER_LEN+pageLen], nil
+}
+
+// DecodeSupportedVPDPages decodes the Supported VPD Pages page (00h).
+func DecodeSupportedVPDPages(buf []byte) ([]uint8, error) {
+	data, err := checkVPDPage(buf, VPD_SUPPORTED_PAGES)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]uint8{}, data...), nil
+}
+
+// DecodeUnitSerialNumber decodes the Unit Serial Number page (80h).
+func DecodeUnitSerialNumber(buf []byte) (string, error) {
+	data, err := checkVPDPage(buf, VPD_UNIT_SERIAL_NUMBER)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.Trim(data, " \x00")), nil
+}
+
+// Designator is a single designation descriptor from the Device Identification page (83h).
+type Designator struct {
+	ProtocolID  uint8 // Protocol identifier (only valid if PIV is set)
+	CodeSet     uint8
+	PIV         bool // Protocol identifier valid
+	Association uint8
+	Type        uint8
+	Value       []byte
+}
+
+// String returns the designator value in a human readable format, depending on its type.
+func (d Designator) String() string {
+	switch d.Type {
+	case DESIG_NAA, DESIG_EUI64:
+		return "0x" + hex.EncodeToString(d.Value)
+	case DESIG_RELATIVE_PORT, DESIG_TARGET_PORT_GROUP, DESIG_LOGICAL_UNIT_GROUP:
+		if len(d.Value) >= 4 {
+			return strconv.Itoa(int(binary.BigEndian.Uint16(d.Value[2:])))
+		}
+	case DESIG_UUID:
+		if len(d.Value) == 18 {
+			u := hex.EncodeToString(d.Value[2:])
+			return u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:]
+		}
+	}
+
+	if d.CodeSet == CODE_SET_ASCII || d.CodeSet == CODE_SET_UTF8 {
+		return string(bytes.TrimRight(d.Value, " \x00"))
+	}
+
+	return "0x" + hex.EncodeToString(d.Value)
+}
+
+// DeviceIdentification is the list of designators from the Device Identification page (83h).
+type DeviceIdentification []Designator
+
+// Find returns the first designator with the specified association and type.
+func (id DeviceIdentification) Find(association, desigType uint8) (Designator, bool) {
+	for _, d := range id {
+		if d.Association == association && d.Type == desigType {
+			return d, true
+		}
+	}
+
+	return Designator{}, false
+}
+
+// WWN returns the logical unit World Wide Name, i.e. its NAA designator (or EUI-64 designator if
+// the device has no NAA designator), or an empty string if the device reports neither.
+func (id DeviceIdentification) WWN() string {
+	if d, ok := id.Find(ASSOC_LOGICAL_UNIT, DESIG_NAA); ok {
+		return d.String()
+	}
+
+	if d, ok := id.Find(ASSOC_LOGICAL_UNIT, DESIG_EUI64); ok {
+		return d.String()
+	}
+
+	return ""
+}
+
+// DecodeDeviceIdentification decodes the Device Identification page (83h).
+func DecodeDeviceIdentification(buf []byte) (DeviceIdentification, error) {
+	data, err := checkVPDPage(buf, VPD_DEVICE_IDENTIFICATION)
+	if err != nil {
+		return nil, err
+	}
+
+	var id DeviceIdentification
+
+	for len(data) >= 4 {
+		desigLen := int(data[3])
+		if len(data) < 4+desigLen {
+			return id, fmt.Errorf("VPD page %#02x: truncated designator", VPD_DEVICE_IDENTIFICATION)
+		}
+
+		id = append(id, Designator{
+			ProtocolID:  data[0] >> 4,
+			CodeSet:     data[0] & 0x0f,
+			PIV:         data[1]&0x80 != 0,
+			Association: (data[1] >> 4) & 0x03,
+			Type:        data[1] & 0x0f,
+			Value:       append([]byte{}, data[4:4+desigLen]...),
+		})
+
+		data = data[4+desigLen:]
+	}
+
+	return id, nil
+}
+
+// ExtendedInquiry is the decoded Extended INQUIRY Data page (86h).
+type ExtendedInquiry struct {
+	ActivateMicrocode       uint8 // When activated microcode takes effect
+	SPT                     uint8 // Supported protection types
+	GuardCheck              bool  // GRD_CHK
+	AppTagCheck             bool  // APP_CHK
+	RefTagCheck             bool  // REF_CHK
+	HeadOfQueue             bool  // HEADSUP
+	OrderedTask             bool  // ORDSUP
+	SimpleTask              bool  // SIMPSUP
+	WriteUncorrectable      bool  // WU_SUP
+	CorrectionDisable       bool  // CRD_SUP
+	NonVolatileCache        bool  // NV_SUP
+	VolatileCache           bool  // V_SUP
+	ProtectionInfoInterval  bool  // P_I_I_SUP
+	LUICLR                  bool  // Logical unit I_T nexus clear
+	ExtendedSelfTestMinutes uint16
+	MaxSenseLength          uint8
+}
+
+// DecodeExtendedInquiry decodes the Extended INQUIRY Data page (86h).
+func DecodeExtendedInquiry(buf []byte) (ExtendedInquiry, error) {
+	var ext ExtendedInquiry
+
+	data, err := checkVPDPage(buf, VPD_EXTENDED_INQUIRY)
+	if err != nil {
+		return ext, err
+	}
+
+	if len(data) < 8 {
+		return ext, fmt.Errorf("VPD page %#02x: short page (%d bytes)", VPD_EXTENDED_INQUIRY, len(data))
+	}
+
+	ext.ActivateMicrocode = data[0] >> 6
+	ext.SPT = (data[0] >> 3) & 0x07
+	ext.GuardCheck = data[0]&0x04 != 0
+	ext.AppTagCheck = data[0]&0x02 != 0
+	ext.RefTagCheck = data[0]&0x01 != 0
+	ext.HeadOfQueue = data[1]&0x04 != 0
+	ext.OrderedTask = data[1]&0x02 != 0
+	ext.SimpleTask = data[1]&0x01 != 0
+	ext.WriteUncorrectable = data[2]&0x08 != 0
+	ext.CorrectionDisable = data[2]&0x04 != 0
+	ext.NonVolatileCache = data[2]&0x02 != 0
+	ext.VolatileCache = data[2]&0x01 != 0
+	ext.ProtectionInfoInterval = data[3]&0x10 != 0
+	ext.LUICLR = data[3]&0x01 != 0
+	ext.ExtendedSelfTestMinutes = binary.BigEndian.Uint16(data[6:])
+
+	if len(data) >= 10 {
+		ext.MaxSenseLength = data[9]
+	}
+
+	return ext, nil
+}
+
+// BlockLimits is the decoded Block Limits page (B0h). Lengths are in logical blocks, zero meaning
+// not reported / no limit.
+type BlockLimits struct {
+	WriteSameNonZero               bool  // WSNZ
+	MaxCompareAndWriteLength       uint8 // Maximum COMPARE AND WRITE length
+	OptimalTransferGranularity     uint16
+	MaxTransferLength              uint32
+	OptimalTransferLength          uint32
+	MaxPrefetchLength              uint32
+	MaxUnmapLBACount               uint32
+	MaxUnmapDescriptorCount        uint32
+	OptimalUnmapGranularity        uint32
+	UnmapGranularityAlignmentValid bool
+	UnmapGranularityAlignment      uint32
+	MaxWriteSameLength             uint64
+}
+
+// DecodeBlockLimits decodes the Block Limits page (B0h).
+func DecodeBlockLimits(buf []byte) (BlockLimits, error) {
+	var bl BlockLimits
+
+	data, err := checkVPDPage(buf, VPD_BLOCK_LIMITS)
+	if err != nil {
+		return bl, err
+	}
+
+	// Early SBC-3 devices report a shorter page (length 0Ch), without unmap and write same fields.
+	if len(data) < 0x0c {
+		return bl, fmt.Errorf("VPD page %#02x: short page (%d bytes)", VPD_BLOCK_LIMITS, len(data))
+	}
+
+	bl.WriteSameNonZero = data[0]&0x01 != 0
+	bl.MaxCompareAndWriteLength = data[1]
+	bl.OptimalTransferGranularity = binary.BigEndian.Uint16(data[2:])
+	bl.MaxTransferLength = binary.BigEndian.Uint32(data[4:])
+	bl.OptimalTransferLength = binary.BigEndian.Uint32(data[8:])
+
+	if len(data) >= 0x28 {
+		bl.MaxPrefetchLength = binary.BigEndian.Uint32(data[12:])
+		bl.MaxUnmapLBACount = binary.BigEndian.Uint32(data[16:])
+		bl.MaxUnmapDescriptorCount = binary.BigEndian.Uint32(data[20:])
+		bl.OptimalUnmapGranularity = binary.BigEndian.Uint32(data[24:])
+		bl.UnmapGranularityAlignmentValid = data[28]&0x80 != 0
+		bl.UnmapGranularityAlignment = binary.BigEndian.Uint32(data[28:]) & 0x7fffffff
+		bl.MaxWriteSameLength = binary.BigEndian.Uint64(data[32:])
+	}
+
+	return bl, nil
+}
+
+// BlockDeviceCharacteristics is the decoded Block Device Characteristics page (B1h).
+type BlockDeviceCharacteristics struct {
+	RotationRate uint16 // 0 = not reported, 1 = non-rotating medium (e.g. SSD), else RPM
+	ProductType  uint8
+	FormFactor   uint8 // Nominal form factor
+	Zoned        uint8
+	FUAB         bool
+	VBULS        bool
+}
+
+// FormFactorString returns the nominal form factor as a string.
+func (c BlockDeviceCharacteristics) FormFactorString() string {
+	switch c.FormFactor {
+	case 1:
+		return "5.25 inches"
+	case 2:
+		return "3.5 inches"
+	case 3:
+		return "2.5 inches"
+	case 4:
+		return "1.8 inches"
+	case 5:
+		return "< 1.8 inches"
+	}
+
+	return "not reported"
+}
+
+// DecodeBlockDeviceCharacteristics decodes the Block Device Characteristics page (B1h).
+func DecodeBlockDeviceCharacteristics(buf []byte) (BlockDeviceCharacteristics, error) {
+	var bdc BlockDeviceCharacteristics
+
+	data, err := checkVPDPage(buf, VPD_BLOCK_DEVICE_CHARACTERISTICS)
+	if err != nil {
+		return bdc, err
+	}
+
+	if len(data) < 5 {
+		return bdc, fmt.Errorf("VPD page %#02x: short page (%d bytes)", VPD_BLOCK_DEVICE_CHARACTERISTICS,
+			len(data))
+	}
+
+	bdc.RotationRate = binary.BigEndian.Uint16(data[0:])
+	bdc.ProductType = data[2]
+	bdc.FormFactor = data[3] & 0x0f
+	bdc.Zoned = (data[4] >> 4) & 0x03
+	bdc.FUAB = data[4]&0x02 != 0
+	bdc.VBULS = data[4]&0x01 != 0
+
+	return bdc, nil
+}
+
+// LogicalBlockProvisioning is the decoded Logical Block Provisioning page (B2h).
+type LogicalBlockProvisioning struct {
+	ThresholdExponent uint8
+	LBPU              bool  // UNMAP command supported
+	LBPWS             bool  // WRITE SAME(16) with UNMAP bit supported
+	LBPWS10           bool  // WRITE SAME(10) with UNMAP bit supported
+	LBPRZ             uint8 // Logical block provisioning read zeros
+	ANCSupported      bool  // Anchor supported
+	DP                bool  // Provisioning group descriptor present
+	ProvisioningType  uint8 // 0 = not reported / fully provisioned, 1 = resource, 2 = thin
+}
+
+// ProvisioningTypeString returns the provisioning type as a string.
+func (p LogicalBlockProvisioning) ProvisioningTypeString() string {
+	switch p.ProvisioningType {
+	case 0:
+		return "fully provisioned"
+	case 1:
+		return "resource provisioned"
+	case 2:
+		return "thin provisioned"
+	}
+
+	return fmt.Sprintf("reserved (%d)", p.ProvisioningType)
+}
+
+// DecodeLogicalBlockProvisioning decodes the Logical Block Provisioning page (B2h).
+func DecodeLogicalBlockProvisioning(buf []byte) (LogicalBlockProvisioning, error) {
+	var lbp LogicalBlockProvisioning
+
+	data, err := checkVPDPage(buf, VPD_LOGICAL_BLOCK_PROVISIONING)
+	if err != nil {
+		return lbp, err
+	}
+
+	if len(data) < 3 {
+		return lbp, fmt.Errorf("VPD page %#02x: short page (%d bytes)", VPD_LOGICAL_BLOCK_PROVISIONING,
+			len(data))
+	}
+
+	lbp.ThresholdExponent = data[0]
+	lbp.LBPU = data[1]&0x80 != 0
+	lbp.LBPWS = data[1]&0x40 != 0
+	lbp.LBPWS10 = data[1]&0x20 != 0
+	lbp.LBPRZ = (data[1] >> 2) & 0x07
+	lbp.ANCSupported = data[1]&0x02 != 0
+	lbp.DP = data[1]&0x01 != 0
+	lbp.ProvisioningType = data[2] & 0x07
+
+	return lbp, nil
+}
+
+// truncateVPDPage trims a VPD page which was truncated by the allocation length, and adjusts the page
+// length in the header accordingly. Device Identification pages are trimmed to their last complete
+// designation descriptor; other pages are either fixed length or lists of single byte entries.
+func truncateVPDPage(buf []byte) []byte {
+	n := len(buf)
+
+	if buf[1] == VPD_DEVICE_IDENTIFICATION {
+		n = VPD_HEADER_LEN
+		for n+4 <= len(buf) && n+4+int(buf[n+3]) <= len(buf) {
+			n += 4 + int(buf[n+3])
+		}
+	}
+
+	binary.BigEndian.PutUint16(buf[2:], uint16(n-VPD_HEADER_LEN))
+
+	return buf[:n]
+}
+
+// inquiryVPD sends a SCSI INQUIRY command with the EVPD bit set to a device, and returns the
+// complete VPD page (including header).
+func (d *SCSIDevice) inquiryVPD(page uint8) ([]byte, error) {
+	respBuf := make([]byte, 252)
+
+	for {
+		cdb := CDB6{SCSI_INQUIRY}
+		cdb[1] = 0x01 // EVPD
+		cdb[2] = page
+		binary.BigEndian.PutUint16(cdb[3:], uint16(len(respBuf)))
+
+		if err := d.sendCDB(cdb[:], &respBuf); err != nil {
+			return nil, err
+		}
+
+		// Retry with a larger buffer if the page did not fit
+		pageLen := VPD_HEADER_LEN + int(binary.BigEndian.Uint16(respBuf[2:]))
+		if pageLen <= len(respBuf) {
+			return respBuf[:pageLen], nil
+		}
+
+		// Allocation length is limited to 16 bits, so very long pages may be truncated
+		if len(respBuf) == 0xffff {
+			return truncateVPDPage(respBuf), nil
+		}
+
+		if pageLen > 0xffff {
+			pageLen = 0xffff
+		}
+
+		respBuf = make([]byte, pageLen)
+	}
+}
+
+// SupportedVPDPages returns the VPD page codes supported by the device.
+func (d *SCSIDevice) SupportedVPDPages() ([]uint8, error) {
+	buf, err := d.inquiryVPD(VPD_SUPPORTED_PAGES)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeSupportedVPDPages(buf)
+}
+
+// SerialNumber returns the unit serial number of the device.
+func (d *SCSIDevice) SerialNumber() (string, error) {
+	buf, err := d.inquiryVPD(VPD_UNIT_SERIAL_NUMBER)
+	if err != nil {
+		return "", err
+	}
+
+	return DecodeUnitSerialNumber(buf)
+}
+
+// DeviceIdentification returns the designators (e.g., WWN, target ports) of the device.
+func (d *SCSIDevice) DeviceIdentification() (DeviceIdentification, error) {
+	buf, err := d.inquiryVPD(VPD_DEVICE_IDENTIFICATION)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeDeviceIdentification(buf)
+}
+
+// ExtendedInquiry returns the extended INQUIRY data of the device.
+func (d *SCSIDevice) ExtendedInquiry() (ExtendedInquiry, error) {
+	buf, err := d.inquiryVPD(VPD_EXTENDED_INQUIRY)
+	if err != nil {
+		return ExtendedInquiry{}, err
+	}
+
+	return DecodeExtendedInquiry(buf)
+}
+
+// BlockLimits returns the block limits of the device.
+func (d *SCSIDevice) BlockLimits() (BlockLimits, error) {
+	buf, err := d.inquiryVPD(VPD_BLOCK_LIMITS)
+	if err != nil {
+		return BlockLimits{}, err
+	}
+
+	return DecodeBlockLimits(buf)
+}
+
+// BlockDeviceCharacteristics returns the block device characteristics (e.g., rotation rate, form
+// factor) of the device.
+func (d *SCSIDevice) BlockDeviceCharacteristics() (BlockDeviceCharacteristics, error) {
+	buf, err := d.inquiryVPD(VPD_BLOCK_DEVICE_CHARACTERISTICS)
+	if err != nil {
+		return BlockDeviceCharacteristics{}, err
+	}
+
+	return DecodeBlockDeviceCharacteristics(buf)
+}
+
+// LogicalBlockProvisioning returns the logical block provisioning parameters of the device.
+func (d *SCSIDevice) LogicalBlockProvisioning() (LogicalBlockProvisioning, error) {
+	buf, err := d.inquiryVPD(VPD_LOGICAL_BLOCK_PROVISIONING)
+	if err != nil {
+		return LogicalBlockProvisioning{}, err
+	}
+
+	return DecodeLogicalBlockProvisioning(buf)
+}
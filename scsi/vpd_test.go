@@ -0,0 +1,136 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scsi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeVPDPages(t *testing.T) {
+	assert := assert.New(t)
+
+	pages, err := DecodeSupportedVPDPages([]byte{0x00, 0x00, 0x00, 0x04, 0x00, 0x80, 0x83, 0xb1})
+	assert.NoError(err)
+	assert.Equal([]uint8{0x00, 0x80, 0x83, 0xb1}, pages)
+
+	serial, err := DecodeUnitSerialNumber([]byte{0x00, 0x80, 0x00, 0x0a,
+		' ', ' ', 'Z', '1', 'X', '2', 'A', 'B', 'C', 'D'})
+	assert.NoError(err)
+	assert.Equal("Z1X2ABCD", serial)
+
+	// Wrong page code, truncated page
+	_, err = DecodeUnitSerialNumber([]byte{0x00, 0x83, 0x00, 0x00})
+	assert.Error(err)
+	_, err = DecodeUnitSerialNumber([]byte{0x00, 0x80, 0x00, 0x08, 'Z'})
+	assert.Error(err)
+}
+
+func TestDecodeDeviceIdentification(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := []byte{0x00, 0x83, 0x00, 0x28,
+		// NAA, logical unit
+		0x01, 0x03, 0x00, 0x08, 0x50, 0x00, 0xc5, 0x00, 0x12, 0x34, 0x56, 0x78,
+		// NAA, target port, SAS
+		0x61, 0x93, 0x00, 0x08, 0x50, 0x00, 0xc5, 0x00, 0x12, 0x34, 0x56, 0x79,
+		// Relative target port
+		0x61, 0x94, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01,
+		// SCSI name string, target device
+		0x03, 0xa8, 0x00, 0x04, 'n', 'a', 'a', 0x00,
+	}
+
+	id, err := DecodeDeviceIdentification(buf)
+	assert.NoError(err)
+
+	if assert.Len(id, 4) {
+		assert.Equal("0x5000c50012345678", id.WWN())
+
+		port, ok := id.Find(ASSOC_TARGET_PORT, DESIG_NAA)
+		assert.True(ok)
+		assert.True(port.PIV)
+		assert.Equal(uint8(6), port.ProtocolID)
+		assert.Equal("0x5000c50012345679", port.String())
+
+		assert.Equal("1", id[2].String())
+		assert.Equal(uint8(ASSOC_TARGET_DEVICE), id[3].Association)
+		assert.Equal("naa", id[3].String())
+	}
+}
+
+func TestTruncateVPDPage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Device Identification page longer than the maximum allocation length, which ends partway
+	// through a designation descriptor
+	buf := []byte{0x00, 0x83, 0xff, 0xff}
+	for len(buf) < 0xffff {
+		buf = append(buf, 0x01, 0x03, 0x00, 0x08, 0x50, 0x00, 0xc5, 0x00, 0x12, 0x34, 0x56, 0x78)
+	}
+	buf = buf[:0xffff]
+
+	_, err := DecodeDeviceIdentification(buf)
+	assert.Error(err)
+
+	id, err := DecodeDeviceIdentification(truncateVPDPage(buf))
+	assert.NoError(err)
+	assert.Len(id, (0xffff-VPD_HEADER_LEN)/12)
+
+	// Pages without descriptors are clamped to the allocation length
+	buf = append([]byte{0x00, 0x00, 0xff, 0xff}, make([]byte, 0xffff-VPD_HEADER_LEN)...)
+
+	pages, err := DecodeSupportedVPDPages(truncateVPDPage(buf))
+	assert.NoError(err)
+	assert.Len(pages, 0xffff-VPD_HEADER_LEN)
+}
+
+func TestDecodeBlockDevicePages(t *testing.T) {
+	assert := assert.New(t)
+
+	bdc, err := DecodeBlockDeviceCharacteristics([]byte{0x00, 0xb1, 0x00, 0x3c,
+		0x1c, 0x20, 0x00, 0x02, 0x00})
+	if assert.Error(err) {
+		// Page claims 0x3c bytes, but only 5 were returned
+		bdc, err = DecodeBlockDeviceCharacteristics([]byte{0x00, 0xb1, 0x00, 0x05,
+			0x1c, 0x20, 0x00, 0x02, 0x00})
+	}
+	assert.NoError(err)
+	assert.Equal(uint16(7200), bdc.RotationRate)
+	assert.Equal("3.5 inches", bdc.FormFactorString())
+
+	lbp, err := DecodeLogicalBlockProvisioning([]byte{0x00, 0xb2, 0x00, 0x04, 0x00, 0xe4, 0x02, 0x00})
+	assert.NoError(err)
+	assert.True(lbp.LBPU)
+	assert.True(lbp.LBPWS)
+	assert.True(lbp.LBPWS10)
+	assert.Equal(uint8(1), lbp.LBPRZ)
+	assert.Equal("thin provisioned", lbp.ProvisioningTypeString())
+
+	buf := make([]byte, 0x40)
+	copy(buf, []byte{0x00, 0xb0, 0x00, 0x3c, 0x00, 0x01, 0x00, 0x08, 0x00, 0x00, 0xff, 0xff})
+	buf[0x17] = 0x40 // max unmap LBA count
+	buf[0x1b] = 0x01 // max unmap block descriptor count
+	buf[0x20] = 0x80 // UGAVALID
+
+	bl, err := DecodeBlockLimits(buf)
+	assert.NoError(err)
+	assert.Equal(uint8(1), bl.MaxCompareAndWriteLength)
+	assert.Equal(uint16(8), bl.OptimalTransferGranularity)
+	assert.Equal(uint32(0xffff), bl.MaxTransferLength)
+	assert.Equal(uint32(0x40), bl.MaxUnmapLBACount)
+	assert.Equal(uint32(1), bl.MaxUnmapDescriptorCount)
+	assert.True(bl.UnmapGranularityAlignmentValid)
+}
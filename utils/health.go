@@ -0,0 +1,59 @@
+// Copyright 2017-18 Daniel Swarbrick. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Device health verdict.
+
+package utils
+
+import (
+	"fmt"
+)
+
+// HealthStatus is the overall health verdict of a device.
+type HealthStatus int
+
+const (
+	HealthUnknown HealthStatus = iota
+	HealthPassed
+	HealthWarning // Device is operational, but reports a warning condition (e.g., temperature)
+	HealthFailed  // Device predicts its own failure
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthPassed:
+		return "PASSED"
+	case HealthWarning:
+		return "WARNING"
+	case HealthFailed:
+		return "FAILED"
+	}
+
+	return "UNKNOWN"
+}
+
+// Health is the health verdict of a device, common to SCSI, ATA and NVMe devices.
+type Health struct {
+	Status      HealthStatus
+	Reason      string // Reason for warning or failure, if any
+	Temperature int    // Most recent temperature in degrees Celsius, or -1 if not known
+}
+
+func (h Health) String() string {
+	if h.Reason != "" {
+		return fmt.Sprintf("%s (%s)", h.Status, h.Reason)
+	}
+
+	return h.Status.String()
+}